@@ -3,12 +3,14 @@ package cmd
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/ghodss/yaml"
 	"github.com/go-redis/redis/v7"
 	"github.com/olekukonko/tablewriter"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -16,6 +18,7 @@ import (
 	"rediscompare/compare"
 	"rediscompare/globalzap"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -31,24 +34,92 @@ const (
 )
 
 type SAddr struct {
-	Addr     string
-	Password string
-	Dbs      []int
+	Addr      string
+	Password  string
+	Dbs       []int
+	DbMap     map[int]int    //源DB到目标DB的映射，未配置的DB使用Tdb
+	KeyPrefix map[int]string //目标为cluster时各源DB的key在目标中追加的前缀
 }
+
+//源key到目标key的映射规则
+type KeyMap struct {
+	Prefix []compare.PrefixRule `json:"prefix"`
+	Regex  []compare.RegexRule  `json:"regex"`
+	File   string               `json:"file"`
+}
+
 type RedisCompare struct {
-	Saddr           []SAddr `json:"saddr"`
-	Taddr           string  `json:"taddr"`
-	Spassword       string  `json:"spassword"`
-	Tpassword       string  `json:"tpassword"`
-	Sdb             int     `json:"sdb"`
-	Tdb             int     `json:"tdb"`
-	BatchSize       int     `json:"batchsize"`
-	Threads         int     `json:"threads"`
-	TTLDiff         int     `json:"ttldiff"`
-	CompareTimes    int     `json:"comparetimes"`
-	CompareInterval int     `json:"compareinterval"`
-	Report          bool    `json:"report"`
-	Scenario        string  `json:"scenario"`
+	Saddr                 []SAddr  `json:"saddr"`
+	Taddr                 string   `json:"taddr"`
+	Spassword             string   `json:"spassword"`
+	Tpassword             string   `json:"tpassword"`
+	Sdb                   int      `json:"sdb"`
+	Tdb                   int      `json:"tdb"`
+	BatchSize             int      `json:"batchsize"`
+	Threads               int      `json:"threads"`
+	TTLDiff               int      `json:"ttldiff"`
+	CompareTimes          int      `json:"comparetimes"`
+	CompareInterval       int      `json:"compareinterval"`
+	Report                bool     `json:"report"`
+	Scenario              string   `json:"scenario"`
+	Bidirectional         bool     `json:"bidirectional"`
+	StreamGroups          bool     `json:"streamgroups"`
+	FullDiff              bool     `json:"fulldiff"`
+	MaxDiffPerKey         int      `json:"maxdiffperkey"`
+	Digest                bool     `json:"digest"`
+	Include               []string `json:"include"`
+	Exclude               []string `json:"exclude"`
+	IncludeRegex          []string `json:"includeregex"`
+	ExcludeRegex          []string `json:"excluderegex"`
+	Types                 []string `json:"types"`
+	ExcludeTypes          []string `json:"excludetypes"`
+	KeyMap                KeyMap   `json:"keymap"`
+	SampleRate            float64  `json:"samplerate"`
+	SampleSize            int64    `json:"samplesize"`
+	SampleSeed            int64    `json:"sampleseed"`
+	SampleConfidence      float64  `json:"sampleconfidence"`
+	MemberSampleThreshold int64    `json:"membersamplethreshold"`
+	MemberSampleSize      int64    `json:"membersamplesize"`
+	SourceOps             int64    `json:"sourceops"`
+	SourceBandwidth       int64    `json:"sourcebandwidth"`
+	TargetOps             int64    `json:"targetops"`
+	TargetBandwidth       int64    `json:"targetbandwidth"`
+	HealthMaxOps          int64    `json:"healthmaxops"`
+	HealthMaxClients      int64    `json:"healthmaxclients"`
+	HealthMaxMemory       int64    `json:"healthmaxmemory"`
+	HealthMaxLatency      int64    `json:"healthmaxlatency"`
+	HealthInterval        int      `json:"healthinterval"`
+	HealthAbort           int      `json:"healthabort"`
+	Checkpoint            string   `json:"checkpoint"`
+	Resume                string   `json:"resume"`
+	MetricsAddr           string   `json:"metricsaddr"`
+	RecheckBackoff        float64  `json:"recheckbackoff"`
+	RecheckMaxInterval    int      `json:"recheckmaxinterval"`
+	RetryBudget           int      `json:"retrybudget"`
+	BigKeyMemory          int64    `json:"bigkeymemory"`
+	BigKeyLength          int64    `json:"bigkeylength"`
+	BigKeyThreads         int      `json:"bigkeythreads"`
+	BigKeyTimeout         int      `json:"bigkeytimeout"`
+	BigKeyBatchSize       int64    `json:"bigkeybatchsize"`
+	StringChunkSize       int64    `json:"stringchunksize"`
+	StringHash            bool     `json:"stringhash"`
+	Epsilon               float64  `json:"epsilon"`
+	RelEpsilon            float64  `json:"relepsilon"`
+	NumericString         bool     `json:"numericstring"`
+	Normalize             []string `json:"normalize"`
+	RuleFile              string   `json:"rulefile"`
+	Watch                 bool     `json:"watch"`
+	WatchDelay            int      `json:"watchdelay"`
+	WatchNotify           bool     `json:"watchnotify"`
+
+	limitsReady bool
+	sourceLimit *compare.RateLimit
+	targetLimit *compare.RateLimit
+	monitor     *compare.HealthMonitor
+	checkpoint  *compare.Checkpoint
+	coverages   []*compare.Coverage
+	progress    *compare.ProgressTracker
+	metrics     *compare.Metrics
 }
 
 func NewCompareCommand() *cobra.Command {
@@ -59,6 +130,8 @@ func NewCompareCommand() *cobra.Command {
 
 	compare.AddCommand(NewParametersCommand())
 	compare.AddCommand(NewExecuteCommand())
+	compare.AddCommand(NewProgressCommand())
+	compare.AddCommand(NewRepairCommand())
 	compare.AddCommand(NewSingle2SingleCommand())
 	compare.AddCommand(NewSingle2ClusterCommand())
 	compare.AddCommand(NewCluster2ClusterCommand())
@@ -73,6 +146,17 @@ func NewExecuteCommand() *cobra.Command {
 		Short: "compare single instance redis",
 		Run:   executeCommandFunc,
 	}
+	sc.Flags().String("resume", "", "Resume interrupted compare from the checkpoint file")
+	sc.Flags().String("metrics-addr", "", "Serve prometheus metrics on the address while comparing,such as ':9121',default is empty as disabled")
+	return sc
+}
+
+func NewProgressCommand() *cobra.Command {
+	sc := &cobra.Command{
+		Use:   "progress ",
+		Short: "show progress of compare running in background of interactive mode",
+		Run:   progressCommandFunc,
+	}
 	return sc
 }
 
@@ -113,6 +197,55 @@ func NewSingle2SingleCommand() *cobra.Command {
 	sc.Flags().Int("comparetimes", 1, "compare loop times,default is 1")
 	sc.Flags().Int("compareinterval", 1, "compare loop interval,default is 1 second")
 	sc.Flags().Bool("report", false, "whether generate report default is false")
+	sc.Flags().Bool("bidirectional", false, "whether scan target to find keys not exists in source default is false")
+	sc.Flags().Bool("streamgroups", false, "whether compare stream consumer groups and pending entries default is false")
+	sc.Flags().Bool("fulldiff", false, "whether record all different elements of hash、set、zset、list default is false")
+	sc.Flags().Int("maxdiffperkey", 100, "Max different elements recorded per key in fulldiff mode default is 100")
+	sc.Flags().Bool("digest", false, "whether compare key digest before comparing elements default is false")
+	sc.Flags().StringSlice("include", []string{}, "Glob rules of keys to compare,multi rules splite by ','")
+	sc.Flags().StringSlice("exclude", []string{}, "Glob rules of keys not to compare,multi rules splite by ','")
+	sc.Flags().StringSlice("includeregex", []string{}, "Regular expressions of keys to compare")
+	sc.Flags().StringSlice("excluderegex", []string{}, "Regular expressions of keys not to compare")
+	sc.Flags().StringSlice("types", []string{}, "Key types to compare,such as string,list,set,zset,hash,stream")
+	sc.Flags().StringSlice("excludetypes", []string{}, "Key types not to compare")
+	sc.Flags().String("keymapfile", "", "Key map file,each line is source key and target key splite by tab")
+	sc.Flags().Float64("samplerate", 0, "Compare a random fraction of keys such as 0.01,default is 0 as compare all keys")
+	sc.Flags().Int64("samplesize", 0, "Compare a fixed number of keys picked by RANDOMKEY,default is 0 as compare all keys")
+	sc.Flags().Int64("sampleseed", 0, "Seed of samplerate,same seed picks same keys,default is 0 as random")
+	sc.Flags().Float64("sampleconfidence", 0.95, "Confidence level of mismatch rate interval in sample mode default is 0.95")
+	sc.Flags().Int64("membersamplethreshold", 0, "Set、hash、zset with more elements than it only compare length and random elements,default is 0 as compare all elements")
+	sc.Flags().Int64("membersamplesize", 100, "Random elements compared per set、hash、zset above membersamplethreshold default is 100")
+	sc.Flags().Int64("sourceops", 0, "Max commands per second sent to source,default is 0 as unlimited")
+	sc.Flags().Int64("sourcebandwidth", 0, "Max bytes per second read from and write to source,default is 0 as unlimited")
+	sc.Flags().Int64("targetops", 0, "Max commands per second sent to target,default is 0 as unlimited")
+	sc.Flags().Int64("targetbandwidth", 0, "Max bytes per second read from and write to target,default is 0 as unlimited")
+	sc.Flags().Int64("healthmaxops", 0, "Slow down compare when instantaneous_ops_per_sec of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxclients", 0, "Slow down compare when connected_clients of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxmemory", 0, "Slow down compare when used_memory bytes of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxlatency", 0, "Slow down compare when ping latency milliseconds of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int("healthinterval", 5, "Health check interval seconds default is 5")
+	sc.Flags().Int("healthabort", 0, "Abort compare when source or target stays unhealthy for seconds,default is 0 as never abort")
+	sc.Flags().String("checkpoint", "", "Checkpoint file saved periodically for resuming,no checkpoint is saved when empty")
+	sc.Flags().String("resume", "", "Resume interrupted compare from the checkpoint file")
+	sc.Flags().String("rulefile", "", "Rule file binding key patterns to equality expressions, such as ignored fields, numeric ranges and regex matches")
+	sc.Flags().StringArray("normalize", []string{}, "Normalize string and hash field values of matched keys before comparing,pattern=codec[,codec] applied in order,codecs: json,gzip,zlib,snappy,msgpack,trim")
+	sc.Flags().Float64("epsilon", 0, "Absolute difference allowed between zset scores or numeric values")
+	sc.Flags().Float64("relepsilon", 0, "Relative difference allowed between zset scores or numeric values,e.g. 1e-9")
+	sc.Flags().Bool("numericstring", false, "Compare numeric strings, hash field values and list elements as numbers, so 1.0 equals 1")
+	sc.Flags().Int64("stringchunksize", 1048576, "Bytes read per GETRANGE when comparing string values")
+	sc.Flags().Bool("stringhash", false, "Compare sha1 computed by redis first for strings longer than stringchunksize")
+	sc.Flags().Int64("bigkeymemory", 0, "Keys with MEMORY USAGE over this bytes are compared as big keys,default is 0 as unchecked")
+	sc.Flags().Int64("bigkeylength", 0, "Keys with more elements or string bytes than this are compared as big keys,default is 0 as unchecked")
+	sc.Flags().Int("bigkeythreads", 2, "Threads for comparing big keys")
+	sc.Flags().Int("bigkeytimeout", 0, "Seconds limit of comparing one big key,default is 0 as unlimited")
+	sc.Flags().Int64("bigkeybatchsize", 0, "Elements read per batch of big keys,default is 0 as batchsize")
+	sc.Flags().Float64("recheckbackoff", 2, "Multiple of compareinterval for each next recheck round,1 as fixed interval,default is 2")
+	sc.Flags().Int("recheckmaxinterval", 0, "Max seconds between recheck rounds,default is 0 as unlimited")
+	sc.Flags().Int("retrybudget", 0, "Max rechecks of each different key,default is 0 as comparetimes-1")
+	sc.Flags().String("metrics-addr", "", "Serve prometheus metrics on the address while comparing,such as ':9121',default is empty as disabled")
+	sc.Flags().Bool("watch", false, "whether keep comparing keys changed in source by keyspace notifications instead of scanning default is false")
+	sc.Flags().Int("watchdelay", 1000, "Milliseconds to wait for replication before comparing a changed key in watch mode default is 1000")
+	sc.Flags().Bool("watchnotify", false, "whether enable notify-keyspace-events of source by CONFIG SET in watch mode default is false")
 	return sc
 
 }
@@ -136,6 +269,56 @@ func NewSingle2ClusterCommand() *cobra.Command {
 	sc.Flags().Int("comparetimes", 1, "compare loop times,default is 1")
 	sc.Flags().Int("compareinterval", 1, "compare loop interval,default is 1 second")
 	sc.Flags().Bool("report", false, "whether generate report default is false")
+	sc.Flags().Bool("bidirectional", false, "whether scan target to find keys not exists in source default is false")
+	sc.Flags().Bool("streamgroups", false, "whether compare stream consumer groups and pending entries default is false")
+	sc.Flags().Bool("fulldiff", false, "whether record all different elements of hash、set、zset、list default is false")
+	sc.Flags().Int("maxdiffperkey", 100, "Max different elements recorded per key in fulldiff mode default is 100")
+	sc.Flags().Bool("digest", false, "whether compare key digest before comparing elements default is false")
+	sc.Flags().StringSlice("include", []string{}, "Glob rules of keys to compare,multi rules splite by ','")
+	sc.Flags().StringSlice("exclude", []string{}, "Glob rules of keys not to compare,multi rules splite by ','")
+	sc.Flags().StringSlice("includeregex", []string{}, "Regular expressions of keys to compare")
+	sc.Flags().StringSlice("excluderegex", []string{}, "Regular expressions of keys not to compare")
+	sc.Flags().StringSlice("types", []string{}, "Key types to compare,such as string,list,set,zset,hash,stream")
+	sc.Flags().StringSlice("excludetypes", []string{}, "Key types not to compare")
+	sc.Flags().String("keymapfile", "", "Key map file,each line is source key and target key splite by tab")
+	sc.Flags().Float64("samplerate", 0, "Compare a random fraction of keys such as 0.01,default is 0 as compare all keys")
+	sc.Flags().Int64("samplesize", 0, "Compare a fixed number of keys picked by RANDOMKEY,default is 0 as compare all keys")
+	sc.Flags().Int64("sampleseed", 0, "Seed of samplerate,same seed picks same keys,default is 0 as random")
+	sc.Flags().Float64("sampleconfidence", 0.95, "Confidence level of mismatch rate interval in sample mode default is 0.95")
+	sc.Flags().Int64("membersamplethreshold", 0, "Set、hash、zset with more elements than it only compare length and random elements,default is 0 as compare all elements")
+	sc.Flags().Int64("membersamplesize", 100, "Random elements compared per set、hash、zset above membersamplethreshold default is 100")
+	sc.Flags().Int64("sourceops", 0, "Max commands per second sent to source,default is 0 as unlimited")
+	sc.Flags().Int64("sourcebandwidth", 0, "Max bytes per second read from and write to source,default is 0 as unlimited")
+	sc.Flags().Int64("targetops", 0, "Max commands per second sent to target,default is 0 as unlimited")
+	sc.Flags().Int64("targetbandwidth", 0, "Max bytes per second read from and write to target,default is 0 as unlimited")
+	sc.Flags().Int64("healthmaxops", 0, "Slow down compare when instantaneous_ops_per_sec of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxclients", 0, "Slow down compare when connected_clients of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxmemory", 0, "Slow down compare when used_memory bytes of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxlatency", 0, "Slow down compare when ping latency milliseconds of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int("healthinterval", 5, "Health check interval seconds default is 5")
+	sc.Flags().Int("healthabort", 0, "Abort compare when source or target stays unhealthy for seconds,default is 0 as never abort")
+	sc.Flags().String("checkpoint", "", "Checkpoint file saved periodically for resuming,no checkpoint is saved when empty")
+	sc.Flags().String("resume", "", "Resume interrupted compare from the checkpoint file")
+	sc.Flags().String("rulefile", "", "Rule file binding key patterns to equality expressions, such as ignored fields, numeric ranges and regex matches")
+	sc.Flags().StringArray("normalize", []string{}, "Normalize string and hash field values of matched keys before comparing,pattern=codec[,codec] applied in order,codecs: json,gzip,zlib,snappy,msgpack,trim")
+	sc.Flags().Float64("epsilon", 0, "Absolute difference allowed between zset scores or numeric values")
+	sc.Flags().Float64("relepsilon", 0, "Relative difference allowed between zset scores or numeric values,e.g. 1e-9")
+	sc.Flags().Bool("numericstring", false, "Compare numeric strings, hash field values and list elements as numbers, so 1.0 equals 1")
+	sc.Flags().Int64("stringchunksize", 1048576, "Bytes read per GETRANGE when comparing string values")
+	sc.Flags().Bool("stringhash", false, "Compare sha1 computed by redis first for strings longer than stringchunksize")
+	sc.Flags().Int64("bigkeymemory", 0, "Keys with MEMORY USAGE over this bytes are compared as big keys,default is 0 as unchecked")
+	sc.Flags().Int64("bigkeylength", 0, "Keys with more elements or string bytes than this are compared as big keys,default is 0 as unchecked")
+	sc.Flags().Int("bigkeythreads", 2, "Threads for comparing big keys")
+	sc.Flags().Int("bigkeytimeout", 0, "Seconds limit of comparing one big key,default is 0 as unlimited")
+	sc.Flags().Int64("bigkeybatchsize", 0, "Elements read per batch of big keys,default is 0 as batchsize")
+	sc.Flags().Float64("recheckbackoff", 2, "Multiple of compareinterval for each next recheck round,1 as fixed interval,default is 2")
+	sc.Flags().Int("recheckmaxinterval", 0, "Max seconds between recheck rounds,default is 0 as unlimited")
+	sc.Flags().Int("retrybudget", 0, "Max rechecks of each different key,default is 0 as comparetimes-1")
+	sc.Flags().String("metrics-addr", "", "Serve prometheus metrics on the address while comparing,such as ':9121',default is empty as disabled")
+	sc.Flags().Bool("watch", false, "whether keep comparing keys changed in source by keyspace notifications instead of scanning default is false")
+	sc.Flags().Int("watchdelay", 1000, "Milliseconds to wait for replication before comparing a changed key in watch mode default is 1000")
+	sc.Flags().Bool("watchnotify", false, "whether enable notify-keyspace-events of source by CONFIG SET in watch mode default is false")
+	sc.Flags().String("keyprefix", "", "Prefix added to source keys in target cluster")
 	return sc
 
 }
@@ -158,6 +341,53 @@ func NewMultiSingle2SingleCommand() *cobra.Command {
 	sc.Flags().Int("comparetimes", 1, "compare loop times,default is 1")
 	sc.Flags().Int("compareinterval", 1, "compare loop interval,default is 1 second")
 	sc.Flags().Bool("report", false, "whether generate report default is false")
+	sc.Flags().Bool("bidirectional", false, "whether scan target to find keys not exists in source default is false")
+	sc.Flags().Bool("streamgroups", false, "whether compare stream consumer groups and pending entries default is false")
+	sc.Flags().Bool("fulldiff", false, "whether record all different elements of hash、set、zset、list default is false")
+	sc.Flags().Int("maxdiffperkey", 100, "Max different elements recorded per key in fulldiff mode default is 100")
+	sc.Flags().Bool("digest", false, "whether compare key digest before comparing elements default is false")
+	sc.Flags().StringSlice("include", []string{}, "Glob rules of keys to compare,multi rules splite by ','")
+	sc.Flags().StringSlice("exclude", []string{}, "Glob rules of keys not to compare,multi rules splite by ','")
+	sc.Flags().StringSlice("includeregex", []string{}, "Regular expressions of keys to compare")
+	sc.Flags().StringSlice("excluderegex", []string{}, "Regular expressions of keys not to compare")
+	sc.Flags().StringSlice("types", []string{}, "Key types to compare,such as string,list,set,zset,hash,stream")
+	sc.Flags().StringSlice("excludetypes", []string{}, "Key types not to compare")
+	sc.Flags().String("keymapfile", "", "Key map file,each line is source key and target key splite by tab")
+	sc.Flags().Float64("samplerate", 0, "Compare a random fraction of keys such as 0.01,default is 0 as compare all keys")
+	sc.Flags().Int64("samplesize", 0, "Compare a fixed number of keys picked by RANDOMKEY,default is 0 as compare all keys")
+	sc.Flags().Int64("sampleseed", 0, "Seed of samplerate,same seed picks same keys,default is 0 as random")
+	sc.Flags().Float64("sampleconfidence", 0.95, "Confidence level of mismatch rate interval in sample mode default is 0.95")
+	sc.Flags().Int64("membersamplethreshold", 0, "Set、hash、zset with more elements than it only compare length and random elements,default is 0 as compare all elements")
+	sc.Flags().Int64("membersamplesize", 100, "Random elements compared per set、hash、zset above membersamplethreshold default is 100")
+	sc.Flags().Int64("sourceops", 0, "Max commands per second sent to source,default is 0 as unlimited")
+	sc.Flags().Int64("sourcebandwidth", 0, "Max bytes per second read from and write to source,default is 0 as unlimited")
+	sc.Flags().Int64("targetops", 0, "Max commands per second sent to target,default is 0 as unlimited")
+	sc.Flags().Int64("targetbandwidth", 0, "Max bytes per second read from and write to target,default is 0 as unlimited")
+	sc.Flags().Int64("healthmaxops", 0, "Slow down compare when instantaneous_ops_per_sec of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxclients", 0, "Slow down compare when connected_clients of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxmemory", 0, "Slow down compare when used_memory bytes of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxlatency", 0, "Slow down compare when ping latency milliseconds of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int("healthinterval", 5, "Health check interval seconds default is 5")
+	sc.Flags().Int("healthabort", 0, "Abort compare when source or target stays unhealthy for seconds,default is 0 as never abort")
+	sc.Flags().String("checkpoint", "", "Checkpoint file saved periodically for resuming,no checkpoint is saved when empty")
+	sc.Flags().String("resume", "", "Resume interrupted compare from the checkpoint file")
+	sc.Flags().String("rulefile", "", "Rule file binding key patterns to equality expressions, such as ignored fields, numeric ranges and regex matches")
+	sc.Flags().StringArray("normalize", []string{}, "Normalize string and hash field values of matched keys before comparing,pattern=codec[,codec] applied in order,codecs: json,gzip,zlib,snappy,msgpack,trim")
+	sc.Flags().Float64("epsilon", 0, "Absolute difference allowed between zset scores or numeric values")
+	sc.Flags().Float64("relepsilon", 0, "Relative difference allowed between zset scores or numeric values,e.g. 1e-9")
+	sc.Flags().Bool("numericstring", false, "Compare numeric strings, hash field values and list elements as numbers, so 1.0 equals 1")
+	sc.Flags().Int64("stringchunksize", 1048576, "Bytes read per GETRANGE when comparing string values")
+	sc.Flags().Bool("stringhash", false, "Compare sha1 computed by redis first for strings longer than stringchunksize")
+	sc.Flags().Int64("bigkeymemory", 0, "Keys with MEMORY USAGE over this bytes are compared as big keys,default is 0 as unchecked")
+	sc.Flags().Int64("bigkeylength", 0, "Keys with more elements or string bytes than this are compared as big keys,default is 0 as unchecked")
+	sc.Flags().Int("bigkeythreads", 2, "Threads for comparing big keys")
+	sc.Flags().Int("bigkeytimeout", 0, "Seconds limit of comparing one big key,default is 0 as unlimited")
+	sc.Flags().Int64("bigkeybatchsize", 0, "Elements read per batch of big keys,default is 0 as batchsize")
+	sc.Flags().Float64("recheckbackoff", 2, "Multiple of compareinterval for each next recheck round,1 as fixed interval,default is 2")
+	sc.Flags().Int("recheckmaxinterval", 0, "Max seconds between recheck rounds,default is 0 as unlimited")
+	sc.Flags().Int("retrybudget", 0, "Max rechecks of each different key,default is 0 as comparetimes-1")
+	sc.Flags().String("metrics-addr", "", "Serve prometheus metrics on the address while comparing,such as ':9121',default is empty as disabled")
+	sc.Flags().StringSlice("dbmap", []string{}, "Source DB to target DB map such as 3:0,5:1,all source DBs in map are compared")
 	return sc
 }
 
@@ -181,6 +411,52 @@ func NewCluster2ClusterCommand() *cobra.Command {
 	sc.Flags().Int("comparetimes", 1, "compare loop times,default is 1")
 	sc.Flags().Int("compareinterval", 1, "compare loop interval,default is 1 second")
 	sc.Flags().Bool("report", false, "whether generate report default is false")
+	sc.Flags().Bool("bidirectional", false, "whether scan target to find keys not exists in source default is false")
+	sc.Flags().Bool("streamgroups", false, "whether compare stream consumer groups and pending entries default is false")
+	sc.Flags().Bool("fulldiff", false, "whether record all different elements of hash、set、zset、list default is false")
+	sc.Flags().Int("maxdiffperkey", 100, "Max different elements recorded per key in fulldiff mode default is 100")
+	sc.Flags().Bool("digest", false, "whether compare key digest before comparing elements default is false")
+	sc.Flags().StringSlice("include", []string{}, "Glob rules of keys to compare,multi rules splite by ','")
+	sc.Flags().StringSlice("exclude", []string{}, "Glob rules of keys not to compare,multi rules splite by ','")
+	sc.Flags().StringSlice("includeregex", []string{}, "Regular expressions of keys to compare")
+	sc.Flags().StringSlice("excluderegex", []string{}, "Regular expressions of keys not to compare")
+	sc.Flags().StringSlice("types", []string{}, "Key types to compare,such as string,list,set,zset,hash,stream")
+	sc.Flags().StringSlice("excludetypes", []string{}, "Key types not to compare")
+	sc.Flags().String("keymapfile", "", "Key map file,each line is source key and target key splite by tab")
+	sc.Flags().Float64("samplerate", 0, "Compare a random fraction of keys such as 0.01,default is 0 as compare all keys")
+	sc.Flags().Int64("samplesize", 0, "Compare a fixed number of keys picked by RANDOMKEY,default is 0 as compare all keys")
+	sc.Flags().Int64("sampleseed", 0, "Seed of samplerate,same seed picks same keys,default is 0 as random")
+	sc.Flags().Float64("sampleconfidence", 0.95, "Confidence level of mismatch rate interval in sample mode default is 0.95")
+	sc.Flags().Int64("membersamplethreshold", 0, "Set、hash、zset with more elements than it only compare length and random elements,default is 0 as compare all elements")
+	sc.Flags().Int64("membersamplesize", 100, "Random elements compared per set、hash、zset above membersamplethreshold default is 100")
+	sc.Flags().Int64("sourceops", 0, "Max commands per second sent to source,default is 0 as unlimited")
+	sc.Flags().Int64("sourcebandwidth", 0, "Max bytes per second read from and write to source,default is 0 as unlimited")
+	sc.Flags().Int64("targetops", 0, "Max commands per second sent to target,default is 0 as unlimited")
+	sc.Flags().Int64("targetbandwidth", 0, "Max bytes per second read from and write to target,default is 0 as unlimited")
+	sc.Flags().Int64("healthmaxops", 0, "Slow down compare when instantaneous_ops_per_sec of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxclients", 0, "Slow down compare when connected_clients of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxmemory", 0, "Slow down compare when used_memory bytes of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int64("healthmaxlatency", 0, "Slow down compare when ping latency milliseconds of source or target exceeds it,default is 0 as not check")
+	sc.Flags().Int("healthinterval", 5, "Health check interval seconds default is 5")
+	sc.Flags().Int("healthabort", 0, "Abort compare when source or target stays unhealthy for seconds,default is 0 as never abort")
+	sc.Flags().String("checkpoint", "", "Checkpoint file saved periodically for resuming,no checkpoint is saved when empty")
+	sc.Flags().String("resume", "", "Resume interrupted compare from the checkpoint file")
+	sc.Flags().String("rulefile", "", "Rule file binding key patterns to equality expressions, such as ignored fields, numeric ranges and regex matches")
+	sc.Flags().StringArray("normalize", []string{}, "Normalize string and hash field values of matched keys before comparing,pattern=codec[,codec] applied in order,codecs: json,gzip,zlib,snappy,msgpack,trim")
+	sc.Flags().Float64("epsilon", 0, "Absolute difference allowed between zset scores or numeric values")
+	sc.Flags().Float64("relepsilon", 0, "Relative difference allowed between zset scores or numeric values,e.g. 1e-9")
+	sc.Flags().Bool("numericstring", false, "Compare numeric strings, hash field values and list elements as numbers, so 1.0 equals 1")
+	sc.Flags().Int64("stringchunksize", 1048576, "Bytes read per GETRANGE when comparing string values")
+	sc.Flags().Bool("stringhash", false, "Compare sha1 computed by redis first for strings longer than stringchunksize")
+	sc.Flags().Int64("bigkeymemory", 0, "Keys with MEMORY USAGE over this bytes are compared as big keys,default is 0 as unchecked")
+	sc.Flags().Int64("bigkeylength", 0, "Keys with more elements or string bytes than this are compared as big keys,default is 0 as unchecked")
+	sc.Flags().Int("bigkeythreads", 2, "Threads for comparing big keys")
+	sc.Flags().Int("bigkeytimeout", 0, "Seconds limit of comparing one big key,default is 0 as unlimited")
+	sc.Flags().Int64("bigkeybatchsize", 0, "Elements read per batch of big keys,default is 0 as batchsize")
+	sc.Flags().Float64("recheckbackoff", 2, "Multiple of compareinterval for each next recheck round,1 as fixed interval,default is 2")
+	sc.Flags().Int("recheckmaxinterval", 0, "Max seconds between recheck rounds,default is 0 as unlimited")
+	sc.Flags().Int("retrybudget", 0, "Max rechecks of each different key,default is 0 as comparetimes-1")
+	sc.Flags().String("metrics-addr", "", "Serve prometheus metrics on the address while comparing,such as ':9121',default is empty as disabled")
 	return sc
 
 }
@@ -205,14 +481,62 @@ func executeCommandFunc(cmd *cobra.Command, args []string) {
 	var rc RedisCompare
 
 	json.Unmarshal(jsonbytes, &rc)
+	if resume, _ := cmd.Flags().GetString("resume"); resume != "" {
+		rc.Resume = resume
+	}
+	if metricsaddr, _ := cmd.Flags().GetString("metrics-addr"); metricsaddr != "" {
+		rc.MetricsAddr = metricsaddr
+	}
 
-	execerr := rc.Execute()
+	ctx, done := commons.CommandContext(cmd.Context())
+	defer done()
+	execerr := rc.Execute(ctx)
 	if execerr != nil {
 		cmd.PrintErrln(execerr)
 	}
 
 }
 
+func progressCommandFunc(cmd *cobra.Command, args []string) {
+	trackers := compare.RunningProgress()
+	if len(trackers) == 0 {
+		cmd.Println("No compare running")
+		return
+	}
+
+	for _, tracker := range trackers {
+		var data [][]string
+		snapshots := append(tracker.Snapshot(), tracker.Total())
+		for _, v := range snapshots {
+			eta := "unknown"
+			if v.ETA >= 0 {
+				eta = v.ETA.String()
+			}
+			if !v.Started {
+				eta = "waiting"
+			}
+			data = append(data, []string{
+				v.Name,
+				strconv.FormatInt(v.TotalKeys, 10),
+				strconv.FormatInt(v.ScannedKeys, 10),
+				strconv.FormatInt(v.ComparedKeys, 10),
+				strconv.FormatInt(v.DiffKeys, 10),
+				strconv.FormatInt(v.ErrorKeys, 10),
+				strconv.FormatFloat(v.KeysPerSecond, 'f', 0, 64),
+				strconv.FormatFloat(v.Percent, 'f', 1, 64) + "%",
+				eta,
+			})
+		}
+
+		table := tablewriter.NewWriter(cmd.OutOrStdout())
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetHeader([]string{"Source", "DBSize", "Scanned", "Compared", "Diffs", "Errors", "Keys/s", "Percent", "ETA"})
+		table.AppendBulk(data)
+		table.Render()
+	}
+}
+
 func parametersCommandFunc(cmd *cobra.Command, args []string) {
 	saddr, _ := cmd.Flags().GetString("saddr")
 	taddr, _ := cmd.Flags().GetString("taddr")
@@ -294,6 +618,55 @@ func single2singleCommandFunc(cmd *cobra.Command, args []string) {
 	comparetimes, _ := cmd.Flags().GetInt("comparetimes")
 	compareinterval, _ := cmd.Flags().GetInt("compareinterval")
 	report, _ := cmd.Flags().GetBool("report")
+	bidirectional, _ := cmd.Flags().GetBool("bidirectional")
+	streamgroups, _ := cmd.Flags().GetBool("streamgroups")
+	fulldiff, _ := cmd.Flags().GetBool("fulldiff")
+	maxdiffperkey, _ := cmd.Flags().GetInt("maxdiffperkey")
+	digest, _ := cmd.Flags().GetBool("digest")
+	include, _ := cmd.Flags().GetStringSlice("include")
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	includeregex, _ := cmd.Flags().GetStringSlice("includeregex")
+	excluderegex, _ := cmd.Flags().GetStringSlice("excluderegex")
+	types, _ := cmd.Flags().GetStringSlice("types")
+	excludetypes, _ := cmd.Flags().GetStringSlice("excludetypes")
+	keymapfile, _ := cmd.Flags().GetString("keymapfile")
+	samplerate, _ := cmd.Flags().GetFloat64("samplerate")
+	samplesize, _ := cmd.Flags().GetInt64("samplesize")
+	sampleseed, _ := cmd.Flags().GetInt64("sampleseed")
+	sampleconfidence, _ := cmd.Flags().GetFloat64("sampleconfidence")
+	membersamplethreshold, _ := cmd.Flags().GetInt64("membersamplethreshold")
+	membersamplesize, _ := cmd.Flags().GetInt64("membersamplesize")
+	sourceops, _ := cmd.Flags().GetInt64("sourceops")
+	sourcebandwidth, _ := cmd.Flags().GetInt64("sourcebandwidth")
+	targetops, _ := cmd.Flags().GetInt64("targetops")
+	targetbandwidth, _ := cmd.Flags().GetInt64("targetbandwidth")
+	healthmaxops, _ := cmd.Flags().GetInt64("healthmaxops")
+	healthmaxclients, _ := cmd.Flags().GetInt64("healthmaxclients")
+	healthmaxmemory, _ := cmd.Flags().GetInt64("healthmaxmemory")
+	healthmaxlatency, _ := cmd.Flags().GetInt64("healthmaxlatency")
+	healthinterval, _ := cmd.Flags().GetInt("healthinterval")
+	healthabort, _ := cmd.Flags().GetInt("healthabort")
+	checkpoint, _ := cmd.Flags().GetString("checkpoint")
+	resume, _ := cmd.Flags().GetString("resume")
+	rulefile, _ := cmd.Flags().GetString("rulefile")
+	normalize, _ := cmd.Flags().GetStringArray("normalize")
+	epsilon, _ := cmd.Flags().GetFloat64("epsilon")
+	relepsilon, _ := cmd.Flags().GetFloat64("relepsilon")
+	numericstring, _ := cmd.Flags().GetBool("numericstring")
+	stringchunksize, _ := cmd.Flags().GetInt64("stringchunksize")
+	stringhash, _ := cmd.Flags().GetBool("stringhash")
+	bigkeymemory, _ := cmd.Flags().GetInt64("bigkeymemory")
+	bigkeylength, _ := cmd.Flags().GetInt64("bigkeylength")
+	bigkeythreads, _ := cmd.Flags().GetInt("bigkeythreads")
+	bigkeytimeout, _ := cmd.Flags().GetInt("bigkeytimeout")
+	bigkeybatchsize, _ := cmd.Flags().GetInt64("bigkeybatchsize")
+	recheckbackoff, _ := cmd.Flags().GetFloat64("recheckbackoff")
+	recheckmaxinterval, _ := cmd.Flags().GetInt("recheckmaxinterval")
+	retrybudget, _ := cmd.Flags().GetInt("retrybudget")
+	metricsaddr, _ := cmd.Flags().GetString("metrics-addr")
+	watch, _ := cmd.Flags().GetBool("watch")
+	watchdelay, _ := cmd.Flags().GetInt("watchdelay")
+	watchnotify, _ := cmd.Flags().GetBool("watchnotify")
 
 	saddrstruct := SAddr{
 		Addr:     saddr,
@@ -302,23 +675,74 @@ func single2singleCommandFunc(cmd *cobra.Command, args []string) {
 	}
 
 	rc := RedisCompare{
-		Saddr:           []SAddr{saddrstruct},
-		Taddr:           taddr,
-		Spassword:       spassword,
-		Tpassword:       tpassword,
-		Sdb:             sdb,
-		Tdb:             tdb,
-		BatchSize:       batchsize,
-		Threads:         threas,
-		TTLDiff:         ttldiff,
-		CompareTimes:    comparetimes,
-		CompareInterval: compareinterval,
-		Report:          report,
-		Scenario:        ScenarioSingle2single,
+		Saddr:                 []SAddr{saddrstruct},
+		Taddr:                 taddr,
+		Spassword:             spassword,
+		Tpassword:             tpassword,
+		Sdb:                   sdb,
+		Tdb:                   tdb,
+		BatchSize:             batchsize,
+		Threads:               threas,
+		TTLDiff:               ttldiff,
+		CompareTimes:          comparetimes,
+		CompareInterval:       compareinterval,
+		Report:                report,
+		Scenario:              ScenarioSingle2single,
+		Bidirectional:         bidirectional,
+		StreamGroups:          streamgroups,
+		FullDiff:              fulldiff,
+		MaxDiffPerKey:         maxdiffperkey,
+		Digest:                digest,
+		Include:               include,
+		Exclude:               exclude,
+		IncludeRegex:          includeregex,
+		ExcludeRegex:          excluderegex,
+		Types:                 types,
+		ExcludeTypes:          excludetypes,
+		KeyMap:                KeyMap{File: keymapfile},
+		SampleRate:            samplerate,
+		SampleSize:            samplesize,
+		SampleSeed:            sampleseed,
+		SampleConfidence:      sampleconfidence,
+		MemberSampleThreshold: membersamplethreshold,
+		MemberSampleSize:      membersamplesize,
+		SourceOps:             sourceops,
+		SourceBandwidth:       sourcebandwidth,
+		TargetOps:             targetops,
+		TargetBandwidth:       targetbandwidth,
+		HealthMaxOps:          healthmaxops,
+		HealthMaxClients:      healthmaxclients,
+		HealthMaxMemory:       healthmaxmemory,
+		HealthMaxLatency:      healthmaxlatency,
+		HealthInterval:        healthinterval,
+		HealthAbort:           healthabort,
+		Checkpoint:            checkpoint,
+		Resume:                resume,
+		RuleFile:              rulefile,
+		Normalize:             normalize,
+		Epsilon:               epsilon,
+		RelEpsilon:            relepsilon,
+		NumericString:         numericstring,
+		StringChunkSize:       stringchunksize,
+		StringHash:            stringhash,
+		BigKeyMemory:          bigkeymemory,
+		BigKeyLength:          bigkeylength,
+		BigKeyThreads:         bigkeythreads,
+		BigKeyTimeout:         bigkeytimeout,
+		BigKeyBatchSize:       bigkeybatchsize,
+		RecheckBackoff:        recheckbackoff,
+		RecheckMaxInterval:    recheckmaxinterval,
+		RetryBudget:           retrybudget,
+		MetricsAddr:           metricsaddr,
+		Watch:                 watch,
+		WatchDelay:            watchdelay,
+		WatchNotify:           watchnotify,
 	}
 
 	zaplogger.Sugar().Info(rc)
-	err := rc.Single2Single()
+	ctx, done := commons.CommandContext(cmd.Context())
+	defer done()
+	err := rc.Single2Single(ctx)
 	if err != nil {
 		cmd.PrintErrln(err)
 	}
@@ -338,30 +762,139 @@ func multisingle2singleCommandFunc(cmd *cobra.Command, args []string) {
 	comparetimes, _ := cmd.Flags().GetInt("comparetimes")
 	compareinterval, _ := cmd.Flags().GetInt("compareinterval")
 	report, _ := cmd.Flags().GetBool("report")
+	bidirectional, _ := cmd.Flags().GetBool("bidirectional")
+	streamgroups, _ := cmd.Flags().GetBool("streamgroups")
+	fulldiff, _ := cmd.Flags().GetBool("fulldiff")
+	maxdiffperkey, _ := cmd.Flags().GetInt("maxdiffperkey")
+	digest, _ := cmd.Flags().GetBool("digest")
+	include, _ := cmd.Flags().GetStringSlice("include")
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	includeregex, _ := cmd.Flags().GetStringSlice("includeregex")
+	excluderegex, _ := cmd.Flags().GetStringSlice("excluderegex")
+	types, _ := cmd.Flags().GetStringSlice("types")
+	excludetypes, _ := cmd.Flags().GetStringSlice("excludetypes")
+	keymapfile, _ := cmd.Flags().GetString("keymapfile")
+	samplerate, _ := cmd.Flags().GetFloat64("samplerate")
+	samplesize, _ := cmd.Flags().GetInt64("samplesize")
+	sampleseed, _ := cmd.Flags().GetInt64("sampleseed")
+	sampleconfidence, _ := cmd.Flags().GetFloat64("sampleconfidence")
+	membersamplethreshold, _ := cmd.Flags().GetInt64("membersamplethreshold")
+	membersamplesize, _ := cmd.Flags().GetInt64("membersamplesize")
+	sourceops, _ := cmd.Flags().GetInt64("sourceops")
+	sourcebandwidth, _ := cmd.Flags().GetInt64("sourcebandwidth")
+	targetops, _ := cmd.Flags().GetInt64("targetops")
+	targetbandwidth, _ := cmd.Flags().GetInt64("targetbandwidth")
+	healthmaxops, _ := cmd.Flags().GetInt64("healthmaxops")
+	healthmaxclients, _ := cmd.Flags().GetInt64("healthmaxclients")
+	healthmaxmemory, _ := cmd.Flags().GetInt64("healthmaxmemory")
+	healthmaxlatency, _ := cmd.Flags().GetInt64("healthmaxlatency")
+	healthinterval, _ := cmd.Flags().GetInt("healthinterval")
+	healthabort, _ := cmd.Flags().GetInt("healthabort")
+	checkpoint, _ := cmd.Flags().GetString("checkpoint")
+	resume, _ := cmd.Flags().GetString("resume")
+	rulefile, _ := cmd.Flags().GetString("rulefile")
+	normalize, _ := cmd.Flags().GetStringArray("normalize")
+	epsilon, _ := cmd.Flags().GetFloat64("epsilon")
+	relepsilon, _ := cmd.Flags().GetFloat64("relepsilon")
+	numericstring, _ := cmd.Flags().GetBool("numericstring")
+	stringchunksize, _ := cmd.Flags().GetInt64("stringchunksize")
+	stringhash, _ := cmd.Flags().GetBool("stringhash")
+	bigkeymemory, _ := cmd.Flags().GetInt64("bigkeymemory")
+	bigkeylength, _ := cmd.Flags().GetInt64("bigkeylength")
+	bigkeythreads, _ := cmd.Flags().GetInt("bigkeythreads")
+	bigkeytimeout, _ := cmd.Flags().GetInt("bigkeytimeout")
+	bigkeybatchsize, _ := cmd.Flags().GetInt64("bigkeybatchsize")
+	recheckbackoff, _ := cmd.Flags().GetFloat64("recheckbackoff")
+	recheckmaxinterval, _ := cmd.Flags().GetInt("recheckmaxinterval")
+	retrybudget, _ := cmd.Flags().GetInt("retrybudget")
+	metricsaddr, _ := cmd.Flags().GetString("metrics-addr")
+	dbmapstr, _ := cmd.Flags().GetStringSlice("dbmap")
+
+	dbmap, err := ParseDBMap(dbmapstr)
+	if err != nil {
+		cmd.PrintErrln(err)
+		return
+	}
 
 	saddrstruct := SAddr{
 		Addr:     saddr,
 		Password: spassword,
 		Dbs:      []int{sdb},
+		DbMap:    dbmap,
 	}
-
-	rc := RedisCompare{
-		Saddr:           []SAddr{saddrstruct},
-		Taddr:           taddr,
-		Spassword:       spassword,
-		Tpassword:       tpassword,
-		Sdb:             sdb,
-		Tdb:             tdb,
-		BatchSize:       batchsize,
-		Threads:         threas,
-		TTLDiff:         ttldiff,
-		CompareTimes:    comparetimes,
-		CompareInterval: compareinterval,
-		Report:          report,
-		Scenario:        ScenarioMultiSingle2single,
+	if len(dbmap) > 0 {
+		saddrstruct.Dbs = []int{}
+		for k := range dbmap {
+			saddrstruct.Dbs = append(saddrstruct.Dbs, k)
+		}
+		sort.Ints(saddrstruct.Dbs)
 	}
 
-	err := rc.MultiSingle2Single()
+	rc := RedisCompare{
+		Saddr:                 []SAddr{saddrstruct},
+		Taddr:                 taddr,
+		Spassword:             spassword,
+		Tpassword:             tpassword,
+		Sdb:                   sdb,
+		Tdb:                   tdb,
+		BatchSize:             batchsize,
+		Threads:               threas,
+		TTLDiff:               ttldiff,
+		CompareTimes:          comparetimes,
+		CompareInterval:       compareinterval,
+		Report:                report,
+		Scenario:              ScenarioMultiSingle2single,
+		Bidirectional:         bidirectional,
+		StreamGroups:          streamgroups,
+		FullDiff:              fulldiff,
+		MaxDiffPerKey:         maxdiffperkey,
+		Digest:                digest,
+		Include:               include,
+		Exclude:               exclude,
+		IncludeRegex:          includeregex,
+		ExcludeRegex:          excluderegex,
+		Types:                 types,
+		ExcludeTypes:          excludetypes,
+		KeyMap:                KeyMap{File: keymapfile},
+		SampleRate:            samplerate,
+		SampleSize:            samplesize,
+		SampleSeed:            sampleseed,
+		SampleConfidence:      sampleconfidence,
+		MemberSampleThreshold: membersamplethreshold,
+		MemberSampleSize:      membersamplesize,
+		SourceOps:             sourceops,
+		SourceBandwidth:       sourcebandwidth,
+		TargetOps:             targetops,
+		TargetBandwidth:       targetbandwidth,
+		HealthMaxOps:          healthmaxops,
+		HealthMaxClients:      healthmaxclients,
+		HealthMaxMemory:       healthmaxmemory,
+		HealthMaxLatency:      healthmaxlatency,
+		HealthInterval:        healthinterval,
+		HealthAbort:           healthabort,
+		Checkpoint:            checkpoint,
+		Resume:                resume,
+		RuleFile:              rulefile,
+		Normalize:             normalize,
+		Epsilon:               epsilon,
+		RelEpsilon:            relepsilon,
+		NumericString:         numericstring,
+		StringChunkSize:       stringchunksize,
+		StringHash:            stringhash,
+		BigKeyMemory:          bigkeymemory,
+		BigKeyLength:          bigkeylength,
+		BigKeyThreads:         bigkeythreads,
+		BigKeyTimeout:         bigkeytimeout,
+		BigKeyBatchSize:       bigkeybatchsize,
+		RecheckBackoff:        recheckbackoff,
+		RecheckMaxInterval:    recheckmaxinterval,
+		RetryBudget:           retrybudget,
+		MetricsAddr:           metricsaddr,
+	}
+
+	ctx, done := commons.CommandContext(cmd.Context())
+	defer done()
+	err = rc.MultiSingle2Single(ctx)
 
 	if err != nil {
 		cmd.Println(err)
@@ -381,11 +914,62 @@ func single2clusterCommandFunc(cmd *cobra.Command, args []string) {
 	comparetimes, _ := cmd.Flags().GetInt("comparetimes")
 	compareinterval, _ := cmd.Flags().GetInt("compareinterval")
 	report, _ := cmd.Flags().GetBool("report")
+	bidirectional, _ := cmd.Flags().GetBool("bidirectional")
+	streamgroups, _ := cmd.Flags().GetBool("streamgroups")
+	fulldiff, _ := cmd.Flags().GetBool("fulldiff")
+	maxdiffperkey, _ := cmd.Flags().GetInt("maxdiffperkey")
+	digest, _ := cmd.Flags().GetBool("digest")
+	include, _ := cmd.Flags().GetStringSlice("include")
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	includeregex, _ := cmd.Flags().GetStringSlice("includeregex")
+	excluderegex, _ := cmd.Flags().GetStringSlice("excluderegex")
+	types, _ := cmd.Flags().GetStringSlice("types")
+	excludetypes, _ := cmd.Flags().GetStringSlice("excludetypes")
+	keymapfile, _ := cmd.Flags().GetString("keymapfile")
+	samplerate, _ := cmd.Flags().GetFloat64("samplerate")
+	samplesize, _ := cmd.Flags().GetInt64("samplesize")
+	sampleseed, _ := cmd.Flags().GetInt64("sampleseed")
+	sampleconfidence, _ := cmd.Flags().GetFloat64("sampleconfidence")
+	membersamplethreshold, _ := cmd.Flags().GetInt64("membersamplethreshold")
+	membersamplesize, _ := cmd.Flags().GetInt64("membersamplesize")
+	sourceops, _ := cmd.Flags().GetInt64("sourceops")
+	sourcebandwidth, _ := cmd.Flags().GetInt64("sourcebandwidth")
+	targetops, _ := cmd.Flags().GetInt64("targetops")
+	targetbandwidth, _ := cmd.Flags().GetInt64("targetbandwidth")
+	healthmaxops, _ := cmd.Flags().GetInt64("healthmaxops")
+	healthmaxclients, _ := cmd.Flags().GetInt64("healthmaxclients")
+	healthmaxmemory, _ := cmd.Flags().GetInt64("healthmaxmemory")
+	healthmaxlatency, _ := cmd.Flags().GetInt64("healthmaxlatency")
+	healthinterval, _ := cmd.Flags().GetInt("healthinterval")
+	healthabort, _ := cmd.Flags().GetInt("healthabort")
+	checkpoint, _ := cmd.Flags().GetString("checkpoint")
+	resume, _ := cmd.Flags().GetString("resume")
+	rulefile, _ := cmd.Flags().GetString("rulefile")
+	normalize, _ := cmd.Flags().GetStringArray("normalize")
+	epsilon, _ := cmd.Flags().GetFloat64("epsilon")
+	relepsilon, _ := cmd.Flags().GetFloat64("relepsilon")
+	numericstring, _ := cmd.Flags().GetBool("numericstring")
+	stringchunksize, _ := cmd.Flags().GetInt64("stringchunksize")
+	stringhash, _ := cmd.Flags().GetBool("stringhash")
+	bigkeymemory, _ := cmd.Flags().GetInt64("bigkeymemory")
+	bigkeylength, _ := cmd.Flags().GetInt64("bigkeylength")
+	bigkeythreads, _ := cmd.Flags().GetInt("bigkeythreads")
+	bigkeytimeout, _ := cmd.Flags().GetInt("bigkeytimeout")
+	bigkeybatchsize, _ := cmd.Flags().GetInt64("bigkeybatchsize")
+	recheckbackoff, _ := cmd.Flags().GetFloat64("recheckbackoff")
+	recheckmaxinterval, _ := cmd.Flags().GetInt("recheckmaxinterval")
+	retrybudget, _ := cmd.Flags().GetInt("retrybudget")
+	metricsaddr, _ := cmd.Flags().GetString("metrics-addr")
+	watch, _ := cmd.Flags().GetBool("watch")
+	watchdelay, _ := cmd.Flags().GetInt("watchdelay")
+	watchnotify, _ := cmd.Flags().GetBool("watchnotify")
+	keyprefix, _ := cmd.Flags().GetString("keyprefix")
 
 	saddrstruct := SAddr{
-		Addr:     saddr,
-		Password: spassword,
-		Dbs:      []int{sdb},
+		Addr:      saddr,
+		Password:  spassword,
+		Dbs:       []int{sdb},
+		KeyPrefix: map[int]string{sdb: keyprefix},
 	}
 
 	rc := RedisCompare{
@@ -395,16 +979,67 @@ func single2clusterCommandFunc(cmd *cobra.Command, args []string) {
 		Tpassword: tpassword,
 		Sdb:       sdb,
 		//Tdb:          tdb,
-		BatchSize:       batchsize,
-		Threads:         threas,
-		TTLDiff:         ttldiff,
-		CompareTimes:    comparetimes,
-		CompareInterval: compareinterval,
-		Report:          report,
-		Scenario:        ScenarioSingle2cluster,
-	}
-
-	err := rc.Single2Cluster()
+		BatchSize:             batchsize,
+		Threads:               threas,
+		TTLDiff:               ttldiff,
+		CompareTimes:          comparetimes,
+		CompareInterval:       compareinterval,
+		Report:                report,
+		Scenario:              ScenarioSingle2cluster,
+		Bidirectional:         bidirectional,
+		StreamGroups:          streamgroups,
+		FullDiff:              fulldiff,
+		MaxDiffPerKey:         maxdiffperkey,
+		Digest:                digest,
+		Include:               include,
+		Exclude:               exclude,
+		IncludeRegex:          includeregex,
+		ExcludeRegex:          excluderegex,
+		Types:                 types,
+		ExcludeTypes:          excludetypes,
+		KeyMap:                KeyMap{File: keymapfile},
+		SampleRate:            samplerate,
+		SampleSize:            samplesize,
+		SampleSeed:            sampleseed,
+		SampleConfidence:      sampleconfidence,
+		MemberSampleThreshold: membersamplethreshold,
+		MemberSampleSize:      membersamplesize,
+		SourceOps:             sourceops,
+		SourceBandwidth:       sourcebandwidth,
+		TargetOps:             targetops,
+		TargetBandwidth:       targetbandwidth,
+		HealthMaxOps:          healthmaxops,
+		HealthMaxClients:      healthmaxclients,
+		HealthMaxMemory:       healthmaxmemory,
+		HealthMaxLatency:      healthmaxlatency,
+		HealthInterval:        healthinterval,
+		HealthAbort:           healthabort,
+		Checkpoint:            checkpoint,
+		Resume:                resume,
+		RuleFile:              rulefile,
+		Normalize:             normalize,
+		Epsilon:               epsilon,
+		RelEpsilon:            relepsilon,
+		NumericString:         numericstring,
+		StringChunkSize:       stringchunksize,
+		StringHash:            stringhash,
+		BigKeyMemory:          bigkeymemory,
+		BigKeyLength:          bigkeylength,
+		BigKeyThreads:         bigkeythreads,
+		BigKeyTimeout:         bigkeytimeout,
+		BigKeyBatchSize:       bigkeybatchsize,
+		RecheckBackoff:        recheckbackoff,
+		RecheckMaxInterval:    recheckmaxinterval,
+		RetryBudget:           retrybudget,
+		MetricsAddr:           metricsaddr,
+		Watch:                 watch,
+		WatchDelay:            watchdelay,
+		WatchNotify:           watchnotify,
+	}
+
+	ctx, done := commons.CommandContext(cmd.Context())
+	defer done()
+	err := rc.Single2Cluster(ctx)
 	if err != nil {
 		cmd.Println(err)
 	}
@@ -423,6 +1058,52 @@ func cluster2clusterCommandFunc(cmd *cobra.Command, args []string) {
 	comparetimes, _ := cmd.Flags().GetInt("comparetimes")
 	compareinterval, _ := cmd.Flags().GetInt("compareinterval")
 	report, _ := cmd.Flags().GetBool("report")
+	bidirectional, _ := cmd.Flags().GetBool("bidirectional")
+	streamgroups, _ := cmd.Flags().GetBool("streamgroups")
+	fulldiff, _ := cmd.Flags().GetBool("fulldiff")
+	maxdiffperkey, _ := cmd.Flags().GetInt("maxdiffperkey")
+	digest, _ := cmd.Flags().GetBool("digest")
+	include, _ := cmd.Flags().GetStringSlice("include")
+	exclude, _ := cmd.Flags().GetStringSlice("exclude")
+	includeregex, _ := cmd.Flags().GetStringSlice("includeregex")
+	excluderegex, _ := cmd.Flags().GetStringSlice("excluderegex")
+	types, _ := cmd.Flags().GetStringSlice("types")
+	excludetypes, _ := cmd.Flags().GetStringSlice("excludetypes")
+	keymapfile, _ := cmd.Flags().GetString("keymapfile")
+	samplerate, _ := cmd.Flags().GetFloat64("samplerate")
+	samplesize, _ := cmd.Flags().GetInt64("samplesize")
+	sampleseed, _ := cmd.Flags().GetInt64("sampleseed")
+	sampleconfidence, _ := cmd.Flags().GetFloat64("sampleconfidence")
+	membersamplethreshold, _ := cmd.Flags().GetInt64("membersamplethreshold")
+	membersamplesize, _ := cmd.Flags().GetInt64("membersamplesize")
+	sourceops, _ := cmd.Flags().GetInt64("sourceops")
+	sourcebandwidth, _ := cmd.Flags().GetInt64("sourcebandwidth")
+	targetops, _ := cmd.Flags().GetInt64("targetops")
+	targetbandwidth, _ := cmd.Flags().GetInt64("targetbandwidth")
+	healthmaxops, _ := cmd.Flags().GetInt64("healthmaxops")
+	healthmaxclients, _ := cmd.Flags().GetInt64("healthmaxclients")
+	healthmaxmemory, _ := cmd.Flags().GetInt64("healthmaxmemory")
+	healthmaxlatency, _ := cmd.Flags().GetInt64("healthmaxlatency")
+	healthinterval, _ := cmd.Flags().GetInt("healthinterval")
+	healthabort, _ := cmd.Flags().GetInt("healthabort")
+	checkpoint, _ := cmd.Flags().GetString("checkpoint")
+	resume, _ := cmd.Flags().GetString("resume")
+	rulefile, _ := cmd.Flags().GetString("rulefile")
+	normalize, _ := cmd.Flags().GetStringArray("normalize")
+	epsilon, _ := cmd.Flags().GetFloat64("epsilon")
+	relepsilon, _ := cmd.Flags().GetFloat64("relepsilon")
+	numericstring, _ := cmd.Flags().GetBool("numericstring")
+	stringchunksize, _ := cmd.Flags().GetInt64("stringchunksize")
+	stringhash, _ := cmd.Flags().GetBool("stringhash")
+	bigkeymemory, _ := cmd.Flags().GetInt64("bigkeymemory")
+	bigkeylength, _ := cmd.Flags().GetInt64("bigkeylength")
+	bigkeythreads, _ := cmd.Flags().GetInt("bigkeythreads")
+	bigkeytimeout, _ := cmd.Flags().GetInt("bigkeytimeout")
+	bigkeybatchsize, _ := cmd.Flags().GetInt64("bigkeybatchsize")
+	recheckbackoff, _ := cmd.Flags().GetFloat64("recheckbackoff")
+	recheckmaxinterval, _ := cmd.Flags().GetInt("recheckmaxinterval")
+	retrybudget, _ := cmd.Flags().GetInt("retrybudget")
+	metricsaddr, _ := cmd.Flags().GetString("metrics-addr")
 
 	saddrs := strings.Split(saddr, ",")
 	var saddrstructs []SAddr
@@ -442,38 +1123,96 @@ func cluster2clusterCommandFunc(cmd *cobra.Command, args []string) {
 		Tpassword: tpassword,
 		//Sdb:       sdb,
 		//Tdb:          tdb,
-		BatchSize:       batchsize,
-		Threads:         threas,
-		TTLDiff:         ttldiff,
-		CompareTimes:    comparetimes,
-		CompareInterval: compareinterval,
-		Report:          report,
-		Scenario:        ScenarioCluster2cluster,
-	}
-	execerr := rc.Cluster2Cluster()
+		BatchSize:             batchsize,
+		Threads:               threas,
+		TTLDiff:               ttldiff,
+		CompareTimes:          comparetimes,
+		CompareInterval:       compareinterval,
+		Report:                report,
+		Scenario:              ScenarioCluster2cluster,
+		Bidirectional:         bidirectional,
+		StreamGroups:          streamgroups,
+		FullDiff:              fulldiff,
+		MaxDiffPerKey:         maxdiffperkey,
+		Digest:                digest,
+		Include:               include,
+		Exclude:               exclude,
+		IncludeRegex:          includeregex,
+		ExcludeRegex:          excluderegex,
+		Types:                 types,
+		ExcludeTypes:          excludetypes,
+		KeyMap:                KeyMap{File: keymapfile},
+		SampleRate:            samplerate,
+		SampleSize:            samplesize,
+		SampleSeed:            sampleseed,
+		SampleConfidence:      sampleconfidence,
+		MemberSampleThreshold: membersamplethreshold,
+		MemberSampleSize:      membersamplesize,
+		SourceOps:             sourceops,
+		SourceBandwidth:       sourcebandwidth,
+		TargetOps:             targetops,
+		TargetBandwidth:       targetbandwidth,
+		HealthMaxOps:          healthmaxops,
+		HealthMaxClients:      healthmaxclients,
+		HealthMaxMemory:       healthmaxmemory,
+		HealthMaxLatency:      healthmaxlatency,
+		HealthInterval:        healthinterval,
+		HealthAbort:           healthabort,
+		Checkpoint:            checkpoint,
+		Resume:                resume,
+		RuleFile:              rulefile,
+		Normalize:             normalize,
+		Epsilon:               epsilon,
+		RelEpsilon:            relepsilon,
+		NumericString:         numericstring,
+		StringChunkSize:       stringchunksize,
+		StringHash:            stringhash,
+		BigKeyMemory:          bigkeymemory,
+		BigKeyLength:          bigkeylength,
+		BigKeyThreads:         bigkeythreads,
+		BigKeyTimeout:         bigkeytimeout,
+		BigKeyBatchSize:       bigkeybatchsize,
+		RecheckBackoff:        recheckbackoff,
+		RecheckMaxInterval:    recheckmaxinterval,
+		RetryBudget:           retrybudget,
+		MetricsAddr:           metricsaddr,
+	}
+	ctx, done := commons.CommandContext(cmd.Context())
+	defer done()
+	execerr := rc.Cluster2Cluster(ctx)
 	if execerr != nil {
 		cmd.PrintErrln(execerr)
 	}
 }
 
-func (rc *RedisCompare) Execute() error {
+func (rc *RedisCompare) Execute(ctx context.Context) error {
+	//watch模式只订阅单个源DB的通知
+	if rc.Watch && rc.Scenario != ScenarioSingle2single && rc.Scenario != ScenarioSingle2cluster {
+		return errors.New("Watch mode only supports " + ScenarioSingle2single + " and " + ScenarioSingle2cluster)
+	}
 	switch rc.Scenario {
 	case ScenarioSingle2single:
-		return rc.Single2Single()
+		return rc.Single2Single(ctx)
 	case ScenarioSingle2cluster:
-		return rc.Single2Cluster()
+		return rc.Single2Cluster(ctx)
 	case ScenarioCluster2cluster:
-		return rc.Cluster2Cluster()
+		return rc.Cluster2Cluster(ctx)
 	case ScenarioMultiSingle2single:
-		return rc.MultiSingle2Single()
+		return rc.MultiSingle2Single(ctx)
 	case ScenarioMultiSingle2cluster:
-		return rc.MultiSingle2Cluster()
+		return rc.MultiSingle2Cluster(ctx)
 	default:
 		return errors.New("Scenario not exists")
 	}
 }
 
-func (rc *RedisCompare) Single2Single() error {
+func (rc *RedisCompare) Single2Single(ctx context.Context) error {
+	//比较开始时会清理当前目录的result文件，同一进程中不能同时运行多个比较
+	release, ok := commons.AcquireExclusive()
+	if !ok {
+		return errors.New("Another compare is running, wait for it to finish or interrupt it")
+	}
+	defer release()
 
 	if len(rc.Saddr) == 0 {
 		return errors.New("No saddrs")
@@ -482,6 +1221,32 @@ func (rc *RedisCompare) Single2Single() error {
 	if rc.CompareTimes < 1 {
 		rc.CompareTimes = 1
 	}
+
+	filter, err := rc.KeyFilter()
+	if err != nil {
+		return err
+	}
+
+	keymapper, err := rc.KeyMapper()
+	if err != nil {
+		return err
+	}
+
+	normalizers, err := rc.Normalizers()
+	if err != nil {
+		return err
+	}
+
+	rules, err := rc.EqualRules()
+	if err != nil {
+		return err
+	}
+
+	sourcelimit, targetlimit := rc.RateLimits()
+	checkpoint, err := rc.LoadCheckpoint()
+	if err != nil {
+		return err
+	}
 	saddr := rc.Saddr[0]
 
 	sopt := &redis.Options{
@@ -496,7 +1261,7 @@ func (rc *RedisCompare) Single2Single() error {
 
 	topt := &redis.Options{
 		Addr: rc.Taddr,
-		DB:   rc.Tdb,
+		DB:   rc.TargetDB(saddr, saddr.Dbs[0]),
 	}
 
 	if rc.Tpassword != "" {
@@ -519,43 +1284,132 @@ func (rc *RedisCompare) Single2Single() error {
 		return errors.New(tclient.Options().Addr + " " + tconnerr.Error())
 	}
 
-	//删除目录下上次运行时临时产生的result文件
-	files, _ := filepath.Glob("*.result")
-	for _, f := range files {
-		if err := os.Remove(f); err != nil {
-			panic(err)
+	//后台监控源与目标健康状态
+	monitor := rc.HealthMonitor([]*redis.Client{sclient}, tclient, nil)
+	defer monitor.Stop()
+
+	//开启prometheus指标
+	metrics, err := rc.Metrics(ctx, []*redis.Client{sclient}, []*redis.Client{tclient}, nil)
+	if err != nil {
+		return err
+	}
+	defer metrics.Stop()
+
+	//输出比较进度，交互式命令行中可通过compare progress查询
+	tracker := rc.ProgressTracker(ctx, []*redis.Client{sclient})
+	defer tracker.Stop()
+
+	//删除目录下上次运行时临时产生的result文件，恢复时保留
+	if rc.Resume == "" {
+		files, _ := filepath.Glob("*.result")
+		for _, f := range files {
+			if err := os.Remove(f); err != nil {
+				panic(err)
+			}
 		}
 	}
 
 	compare := &compare.CompareSingle2Single{
-		Source:         sclient,
-		Target:         tclient,
-		BatchSize:      int64(rc.BatchSize),
-		TTLDiff:        float64(rc.TTLDiff),
-		RecordResult:   true,
-		CompareThreads: rc.Threads,
+		Source:                sclient,
+		Target:                tclient,
+		BatchSize:             int64(rc.BatchSize),
+		TTLDiff:               float64(rc.TTLDiff),
+		RecordResult:          true,
+		CompareThreads:        rc.Threads,
+		SourceDB:              sclient.Options().DB,
+		TargetDB:              tclient.Options().DB,
+		StreamGroups:          rc.StreamGroups,
+		FullDiff:              rc.FullDiff,
+		MaxDiffPerKey:         rc.MaxDiffPerKey,
+		Digest:                rc.Digest,
+		Filter:                filter,
+		KeyMapper:             keymapper,
+		Sampler:               rc.Sampler(),
+		MemberSampleThreshold: rc.MemberSampleThreshold,
+		MemberSampleSize:      rc.MemberSampleSize,
+		StringChunkSize:       rc.StringChunkSize,
+		StringHash:            rc.StringHash,
+		Tolerance:             rc.Tolerance(),
+		Normalizers:           normalizers,
+		Rules:                 rules,
+		SourceLimit:           sourcelimit,
+		TargetLimit:           targetlimit,
+		Monitor:               monitor,
+		Checkpoint:            checkpoint,
 	}
 	var compares []interface{}
-	compare.CompareDB()
+	tracker.Track(compare.CheckpointID(), &compare.Coverage)
+	compare.Metrics = rc.metrics.Source(rc.Scenario, compare.CheckpointID())
+	compare.Metrics.Round(compare.RecheckRounds() + 1)
+	bigkeys, err := rc.BigKeys()
+	if err != nil {
+		return err
+	}
+	defer bigkeys.Release()
+	compare.BigKeys = bigkeys
 
-	for i := 0; i < rc.CompareTimes-1; i++ {
-		time.Sleep(time.Duration(rc.CompareInterval) * time.Second)
-		compare.CompareKeysFromResultFile([]string{compare.ResultFile})
+	//watch模式持续比较源中发生变化的key，不再scan全库
+	if rc.Watch {
+		tracker.Stop()
+		compare.RecordResult = false
+		watch := rc.NewWatch(ctx, sclient, tclient, compare.TargetDB, compare)
+		compare.OnDiff = watch.Diff
+		return rc.RunWatch(ctx, watch)
 	}
+	compare.CompareDB(ctx)
+
+	convergence := rc.Recheck(ctx, compare.RecheckRounds(), func() string {
+		return compare.ResultFile
+	}, func(round int, filter func(key string) bool) error {
+		compare.Metrics.Round(round + 2)
+		compare.Recheck = filter
+		return compare.CompareKeysFromResultFile(ctx, []string{compare.ResultFile})
+	})
 
 	comparemap, _ := commons.Struct2Map(compare)
 	comparemap["Source"] = compare.Source.Options().Addr
 	comparemap["Target"] = compare.Target.Options().Addr
+	comparemap["Coverage"] = rc.AddCoverage(&compare.Coverage)
+	comparemap["Convergence"] = convergence.Report()
+	if compare.BigKeys != nil {
+		comparemap["BigKeys"] = compare.BigKeys.Report()
+	}
+	if compare.Sampler != nil {
+		comparemap["Sample"] = compare.Sampler.Stats()
+	}
 	compares = append(compares, comparemap)
+	resultfiles := []string{compare.ResultFile}
+
+	//反向比较目标库中多出的key
+	if rc.Bidirectional {
+		resultfile, reversemap := rc.CompareReverse(ctx, []*redis.Client{sclient}, nil, tclient, nil)
+		resultfiles = append(resultfiles, resultfile)
+		compares = append(compares, reversemap)
+	}
+
+	//被中断或中止时标记为部分报告并记录覆盖范围
+	if partial := rc.PartialReport(ctx, monitor); partial != nil {
+		compares = append(compares, partial)
+	}
+	if monitor != nil {
+		compares = append(compares, monitor.Report())
+	}
 
 	//生成报告
 	if rc.Report {
-		GenReport([]string{compare.ResultFile}, compares)
+		GenReport(resultfiles, compares)
 	}
-	return nil
+	return rc.RunErr(ctx, monitor)
 }
 
-func (rc *RedisCompare) Single2Cluster() error {
+func (rc *RedisCompare) Single2Cluster(ctx context.Context) error {
+	//比较开始时会清理当前目录的result文件，同一进程中不能同时运行多个比较
+	release, ok := commons.AcquireExclusive()
+	if !ok {
+		return errors.New("Another compare is running, wait for it to finish or interrupt it")
+	}
+	defer release()
+
 	if len(rc.Saddr) == 0 {
 		return errors.New("No saddrs")
 	}
@@ -564,6 +1418,32 @@ func (rc *RedisCompare) Single2Cluster() error {
 		rc.CompareTimes = 1
 	}
 
+	filter, err := rc.KeyFilter()
+	if err != nil {
+		return err
+	}
+
+	keymapper, err := rc.KeyMapper()
+	if err != nil {
+		return err
+	}
+
+	normalizers, err := rc.Normalizers()
+	if err != nil {
+		return err
+	}
+
+	rules, err := rc.EqualRules()
+	if err != nil {
+		return err
+	}
+
+	sourcelimit, targetlimit := rc.RateLimits()
+	checkpoint, err := rc.LoadCheckpoint()
+	if err != nil {
+		return err
+	}
+
 	saddr := rc.Saddr[0]
 
 	sopt := &redis.Options{
@@ -608,45 +1488,132 @@ func (rc *RedisCompare) Single2Cluster() error {
 		return errors.New(addrs + " " + sconnerr.Error())
 	}
 
-	//删除目录下上次运行时临时产生的result文件
-	files, _ := filepath.Glob("*.result")
-	for _, f := range files {
-		if err := os.Remove(f); err != nil {
-			panic(err)
+	//后台监控源与目标健康状态
+	monitor := rc.HealthMonitor([]*redis.Client{sclient}, nil, tclient)
+	defer monitor.Stop()
+
+	//开启prometheus指标
+	metrics, err := rc.Metrics(ctx, []*redis.Client{sclient}, nil, tclient)
+	if err != nil {
+		return err
+	}
+	defer metrics.Stop()
+
+	//输出比较进度，交互式命令行中可通过compare progress查询
+	tracker := rc.ProgressTracker(ctx, []*redis.Client{sclient})
+	defer tracker.Stop()
+
+	//删除目录下上次运行时临时产生的result文件，恢复时保留
+	if rc.Resume == "" {
+		files, _ := filepath.Glob("*.result")
+		for _, f := range files {
+			if err := os.Remove(f); err != nil {
+				panic(err)
+			}
 		}
 	}
 
 	compare := &compare.CompareSingle2Cluster{
-		Source:         sclient,
-		Target:         tclient,
-		BatchSize:      int64(rc.BatchSize),
-		TTLDiff:        float64(rc.TTLDiff),
-		RecordResult:   true,
-		CompareThreads: rc.Threads,
+		Source:                sclient,
+		Target:                tclient,
+		BatchSize:             int64(rc.BatchSize),
+		TTLDiff:               float64(rc.TTLDiff),
+		RecordResult:          true,
+		CompareThreads:        rc.Threads,
+		SourceDB:              sclient.Options().DB,
+		StreamGroups:          rc.StreamGroups,
+		FullDiff:              rc.FullDiff,
+		MaxDiffPerKey:         rc.MaxDiffPerKey,
+		Digest:                rc.Digest,
+		Filter:                filter,
+		KeyMapper:             keymapper.WithDBPrefix(saddr.KeyPrefix[saddr.Dbs[0]]),
+		Sampler:               rc.Sampler(),
+		MemberSampleThreshold: rc.MemberSampleThreshold,
+		MemberSampleSize:      rc.MemberSampleSize,
+		StringChunkSize:       rc.StringChunkSize,
+		StringHash:            rc.StringHash,
+		Tolerance:             rc.Tolerance(),
+		Normalizers:           normalizers,
+		Rules:                 rules,
+		SourceLimit:           sourcelimit,
+		TargetLimit:           targetlimit,
+		Monitor:               monitor,
+		Checkpoint:            checkpoint,
 	}
 
 	var compares []interface{}
 
-	compare.CompareDB()
-
-	for i := 0; i < rc.CompareTimes-1; i++ {
-		time.Sleep(time.Duration(rc.CompareInterval) * time.Second)
-		compare.CompareKeysFromResultFile([]string{compare.ResultFile})
-	}
+	tracker.Track(compare.CheckpointID(), &compare.Coverage)
+	compare.Metrics = rc.metrics.Source(rc.Scenario, compare.CheckpointID())
+	compare.Metrics.Round(compare.RecheckRounds() + 1)
+	bigkeys, err := rc.BigKeys()
+	if err != nil {
+		return err
+	}
+	defer bigkeys.Release()
+	compare.BigKeys = bigkeys
+
+	//watch模式持续比较源中发生变化的key，不再scan全库
+	if rc.Watch {
+		tracker.Stop()
+		compare.RecordResult = false
+		watch := rc.NewWatch(ctx, sclient, tclient, compare.TargetDB, compare)
+		compare.OnDiff = watch.Diff
+		return rc.RunWatch(ctx, watch)
+	}
+	compare.CompareDB(ctx)
+
+	convergence := rc.Recheck(ctx, compare.RecheckRounds(), func() string {
+		return compare.ResultFile
+	}, func(round int, filter func(key string) bool) error {
+		compare.Metrics.Round(round + 2)
+		compare.Recheck = filter
+		return compare.CompareKeysFromResultFile(ctx, []string{compare.ResultFile})
+	})
 	comparemap, _ := commons.Struct2Map(compare)
 	comparemap["Source"] = compare.Source.Options().Addr
 	comparemap["Target"] = compare.Target.Options().Addrs
+	comparemap["Coverage"] = rc.AddCoverage(&compare.Coverage)
+	comparemap["Convergence"] = convergence.Report()
+	if compare.BigKeys != nil {
+		comparemap["BigKeys"] = compare.BigKeys.Report()
+	}
+	if compare.Sampler != nil {
+		comparemap["Sample"] = compare.Sampler.Stats()
+	}
 	compares = append(compares, comparemap)
+	resultfiles := []string{compare.ResultFile}
+
+	//反向比较目标库中多出的key
+	if rc.Bidirectional {
+		resultfile, reversemap := rc.CompareReverse(ctx, []*redis.Client{sclient}, []string{saddr.KeyPrefix[saddr.Dbs[0]]}, nil, tclient)
+		resultfiles = append(resultfiles, resultfile)
+		compares = append(compares, reversemap)
+	}
+
+	//被中断或中止时标记为部分报告并记录覆盖范围
+	if partial := rc.PartialReport(ctx, monitor); partial != nil {
+		compares = append(compares, partial)
+	}
+	if monitor != nil {
+		compares = append(compares, monitor.Report())
+	}
 
 	//生成报告
 	if rc.Report {
-		GenReport([]string{compare.ResultFile}, compares)
+		GenReport(resultfiles, compares)
 
 	}
-	return nil
+	return rc.RunErr(ctx, monitor)
 }
 
-func (rc *RedisCompare) MultiSingle2Single() error {
+func (rc *RedisCompare) MultiSingle2Single(ctx context.Context) error {
+	//比较开始时会清理当前目录的result文件，同一进程中不能同时运行多个比较
+	release, ok := commons.AcquireExclusive()
+	if !ok {
+		return errors.New("Another compare is running, wait for it to finish or interrupt it")
+	}
+	defer release()
 
 	if len(rc.Saddr) == 0 {
 		return errors.New("No source address")
@@ -658,6 +1625,35 @@ func (rc *RedisCompare) MultiSingle2Single() error {
 		rc.CompareTimes = 1
 	}
 
+	filter, err := rc.KeyFilter()
+	if err != nil {
+		return err
+	}
+
+	keymapper, err := rc.KeyMapper()
+	if err != nil {
+		return err
+	}
+
+	normalizers, err := rc.Normalizers()
+	if err != nil {
+		return err
+	}
+
+	rules, err := rc.EqualRules()
+	if err != nil {
+		return err
+	}
+
+	sourcelimit, targetlimit := rc.RateLimits()
+	checkpoint, err := rc.LoadCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	//各源DB按DbMap对应各自的目标DB
+	var tdbs []int
+	tclients := make(map[int]*redis.Client)
 	for _, v := range rc.Saddr {
 
 		if len(v.Dbs) == 0 {
@@ -673,23 +1669,28 @@ func (rc *RedisCompare) MultiSingle2Single() error {
 			}
 			sclient := commons.GetGoRedisClient(sopt)
 			sclients = append(sclients, sclient)
-		}
 
-	}
+			tdb := rc.TargetDB(v, vdb)
+			tdbs = append(tdbs, tdb)
+			if _, ok := tclients[tdb]; ok {
+				continue
+			}
+			topt := &redis.Options{
+				Addr: rc.Taddr,
+				DB:   tdb,
+			}
+			if rc.Tpassword != "" {
+				topt.Password = rc.Tpassword
+			}
+			tclients[tdb] = commons.GetGoRedisClient(topt)
+		}
 
-	topt := &redis.Options{
-		Addr: rc.Taddr,
-		DB:   rc.Tdb,
 	}
 
-	if rc.Tpassword != "" {
-		topt.Password = rc.Tpassword
+	for _, v := range tclients {
+		defer v.Close()
 	}
 
-	tclient := commons.GetGoRedisClient(topt)
-
-	defer tclient.Close()
-
 	//check redis 连通性
 	for _, v := range sclients {
 		sconnerr := commons.CheckRedisClientConnect(v)
@@ -697,46 +1698,137 @@ func (rc *RedisCompare) MultiSingle2Single() error {
 			return errors.New(v.Options().Addr + " " + sconnerr.Error())
 		}
 	}
-	tconnerr := commons.CheckRedisClientConnect(tclient)
-	if tconnerr != nil {
-		return errors.New(tclient.Options().Addr + " " + tconnerr.Error())
+	for _, v := range tclients {
+		tconnerr := commons.CheckRedisClientConnect(v)
+		if tconnerr != nil {
+			return errors.New(v.Options().Addr + " " + tconnerr.Error())
+		}
+	}
+
+	//后台监控源与目标健康状态，目标各DB位于同一实例，只监控其中一个
+	var tclient *redis.Client
+	for _, v := range tclients {
+		tclient = v
+		break
 	}
+	monitor := rc.HealthMonitor(sclients, tclient, nil)
+	defer monitor.Stop()
 
-	//删除目录下上次运行时临时产生的result文件
-	files, _ := filepath.Glob("*.result")
-	for _, f := range files {
-		if err := os.Remove(f); err != nil {
-			panic(err)
+	//开启prometheus指标，统计各目标DB client的延迟
+	var targets []*redis.Client
+	for _, v := range tclients {
+		targets = append(targets, v)
+	}
+	metrics, err := rc.Metrics(ctx, sclients, targets, nil)
+	if err != nil {
+		return err
+	}
+	defer metrics.Stop()
+
+	//输出比较进度，交互式命令行中可通过compare progress查询
+	tracker := rc.ProgressTracker(ctx, sclients)
+	defer tracker.Stop()
+
+	//删除目录下上次运行时临时产生的result文件，恢复时保留
+	if rc.Resume == "" {
+		files, _ := filepath.Glob("*.result")
+		for _, f := range files {
+			if err := os.Remove(f); err != nil {
+				panic(err)
+			}
 		}
 	}
 
 	var resultfiles []string
 	var compares []interface{}
-	for _, v := range sclients {
+	for k, v := range sclients {
 		compare := &compare.CompareSingle2Single{
-			Source:         v,
-			Target:         tclient,
-			BatchSize:      int64(rc.BatchSize),
-			TTLDiff:        float64(rc.TTLDiff),
-			RecordResult:   true,
-			CompareThreads: rc.Threads,
+			Source:                v,
+			Target:                tclients[tdbs[k]],
+			BatchSize:             int64(rc.BatchSize),
+			TTLDiff:               float64(rc.TTLDiff),
+			RecordResult:          true,
+			CompareThreads:        rc.Threads,
+			SourceDB:              v.Options().DB,
+			TargetDB:              tdbs[k],
+			StreamGroups:          rc.StreamGroups,
+			FullDiff:              rc.FullDiff,
+			MaxDiffPerKey:         rc.MaxDiffPerKey,
+			Digest:                rc.Digest,
+			Filter:                filter,
+			KeyMapper:             keymapper,
+			Sampler:               rc.Sampler(),
+			MemberSampleThreshold: rc.MemberSampleThreshold,
+			MemberSampleSize:      rc.MemberSampleSize,
+			StringChunkSize:       rc.StringChunkSize,
+			StringHash:            rc.StringHash,
+			Tolerance:             rc.Tolerance(),
+			Normalizers:           normalizers,
+			Rules:                 rules,
+			SourceLimit:           sourcelimit,
+			TargetLimit:           targetlimit,
+			Monitor:               monitor,
+			Checkpoint:            checkpoint,
 		}
 
-		compare.CompareDB()
+		tracker.Track(compare.CheckpointID(), &compare.Coverage)
+		compare.Metrics = rc.metrics.Source(rc.Scenario, compare.CheckpointID())
+		compare.Metrics.Round(compare.RecheckRounds() + 1)
+		bigkeys, err := rc.BigKeys()
+		if err != nil {
+			return err
+		}
+		defer bigkeys.Release()
+		compare.BigKeys = bigkeys
+		compare.CompareDB(ctx)
 
-		for i := 0; i < rc.CompareTimes-1; i++ {
-			time.Sleep(time.Duration(rc.CompareInterval) * time.Second)
+		convergence := rc.Recheck(ctx, compare.RecheckRounds(), func() string {
+			return compare.ResultFile
+		}, func(round int, filter func(key string) bool) error {
 			rfile := compare.ResultFile
-			compare.CompareKeysFromResultFile([]string{rfile})
-		}
+			compare.Metrics.Round(round + 2)
+			compare.Recheck = filter
+			return compare.CompareKeysFromResultFile(ctx, []string{rfile})
+		})
 		resultfiles = append(resultfiles, compare.ResultFile)
 		comparemap, _ := commons.Struct2Map(compare)
 		comparemap["Source"] = compare.Source.Options().Addr
 		comparemap["Target"] = compare.Target.Options().Addr
+		comparemap["Coverage"] = rc.AddCoverage(&compare.Coverage)
+		comparemap["Convergence"] = convergence.Report()
+		if compare.BigKeys != nil {
+			comparemap["BigKeys"] = compare.BigKeys.Report()
+		}
+		if compare.Sampler != nil {
+			comparemap["Sample"] = compare.Sampler.Stats()
+		}
 		compares = append(compares, comparemap)
 
 	}
 
+	//反向比较目标库中多出的key，目标key在映射到同一目标DB的所有源库中均不存在时判定为多余
+	if rc.Bidirectional {
+		for tdb, tclient := range tclients {
+			var groupclients []*redis.Client
+			for k, v := range sclients {
+				if tdbs[k] == tdb {
+					groupclients = append(groupclients, v)
+				}
+			}
+			resultfile, reversemap := rc.CompareReverse(ctx, groupclients, nil, tclient, nil)
+			resultfiles = append(resultfiles, resultfile)
+			compares = append(compares, reversemap)
+		}
+	}
+
+	//被中断或中止时标记为部分报告并记录覆盖范围
+	if partial := rc.PartialReport(ctx, monitor); partial != nil {
+		compares = append(compares, partial)
+	}
+	if monitor != nil {
+		compares = append(compares, monitor.Report())
+	}
+
 	//生成报告
 	if rc.Report {
 		GenReport(resultfiles, compares)
@@ -745,21 +1837,54 @@ func (rc *RedisCompare) MultiSingle2Single() error {
 		v.Close()
 	}
 
-	return nil
+	return rc.RunErr(ctx, monitor)
 }
 
-func (rc *RedisCompare) MultiSingle2Cluster() error {
+func (rc *RedisCompare) MultiSingle2Cluster(ctx context.Context) error {
+	//比较开始时会清理当前目录的result文件，同一进程中不能同时运行多个比较
+	release, ok := commons.AcquireExclusive()
+	if !ok {
+		return errors.New("Another compare is running, wait for it to finish or interrupt it")
+	}
+	defer release()
 
 	if len(rc.Saddr) == 0 {
 		return errors.New("No source address")
 	}
 
 	var sclients []*redis.Client
+	var prefixes []string //各源DB在目标cluster中的key前缀
 
 	if rc.CompareTimes < 1 {
 		rc.CompareTimes = 1
 	}
 
+	filter, err := rc.KeyFilter()
+	if err != nil {
+		return err
+	}
+
+	keymapper, err := rc.KeyMapper()
+	if err != nil {
+		return err
+	}
+
+	normalizers, err := rc.Normalizers()
+	if err != nil {
+		return err
+	}
+
+	rules, err := rc.EqualRules()
+	if err != nil {
+		return err
+	}
+
+	sourcelimit, targetlimit := rc.RateLimits()
+	checkpoint, err := rc.LoadCheckpoint()
+	if err != nil {
+		return err
+	}
+
 	for _, v := range rc.Saddr {
 		if len(v.Dbs) == 0 {
 			continue
@@ -774,6 +1899,7 @@ func (rc *RedisCompare) MultiSingle2Cluster() error {
 			}
 			sclient := commons.GetGoRedisClient(sopt)
 			sclients = append(sclients, sclient)
+			prefixes = append(prefixes, v.KeyPrefix[vdb])
 		}
 	}
 
@@ -809,42 +1935,113 @@ func (rc *RedisCompare) MultiSingle2Cluster() error {
 		return errors.New(addrs + " " + tconnerr.Error())
 	}
 
-	//删除目录下上次运行时临时产生的result文件
-	files, _ := filepath.Glob("*.result")
-	for _, f := range files {
-		if err := os.Remove(f); err != nil {
-			panic(err)
+	//后台监控源与目标健康状态
+	monitor := rc.HealthMonitor(sclients, nil, tclient)
+	defer monitor.Stop()
+
+	//开启prometheus指标
+	metrics, err := rc.Metrics(ctx, sclients, nil, tclient)
+	if err != nil {
+		return err
+	}
+	defer metrics.Stop()
+
+	//输出比较进度，交互式命令行中可通过compare progress查询
+	tracker := rc.ProgressTracker(ctx, sclients)
+	defer tracker.Stop()
+
+	//删除目录下上次运行时临时产生的result文件，恢复时保留
+	if rc.Resume == "" {
+		files, _ := filepath.Glob("*.result")
+		for _, f := range files {
+			if err := os.Remove(f); err != nil {
+				panic(err)
+			}
 		}
 	}
 
 	var resultfiles []string
 	//compares := []*compare.CompareSingle2Cluster{}
 	var compares []interface{}
-	for _, v := range sclients {
+	for k, v := range sclients {
 		compare := &compare.CompareSingle2Cluster{
-			Source:         v,
-			Target:         tclient,
-			BatchSize:      int64(rc.BatchSize),
-			TTLDiff:        float64(rc.TTLDiff),
-			RecordResult:   true,
-			CompareThreads: rc.Threads,
+			Source:                v,
+			Target:                tclient,
+			BatchSize:             int64(rc.BatchSize),
+			TTLDiff:               float64(rc.TTLDiff),
+			RecordResult:          true,
+			CompareThreads:        rc.Threads,
+			SourceDB:              v.Options().DB,
+			StreamGroups:          rc.StreamGroups,
+			FullDiff:              rc.FullDiff,
+			MaxDiffPerKey:         rc.MaxDiffPerKey,
+			Digest:                rc.Digest,
+			Filter:                filter,
+			KeyMapper:             keymapper.WithDBPrefix(prefixes[k]),
+			Sampler:               rc.Sampler(),
+			MemberSampleThreshold: rc.MemberSampleThreshold,
+			MemberSampleSize:      rc.MemberSampleSize,
+			StringChunkSize:       rc.StringChunkSize,
+			StringHash:            rc.StringHash,
+			Tolerance:             rc.Tolerance(),
+			Normalizers:           normalizers,
+			Rules:                 rules,
+			SourceLimit:           sourcelimit,
+			TargetLimit:           targetlimit,
+			Monitor:               monitor,
+			Checkpoint:            checkpoint,
 		}
 
-		compare.CompareDB()
+		tracker.Track(compare.CheckpointID(), &compare.Coverage)
+		compare.Metrics = rc.metrics.Source(rc.Scenario, compare.CheckpointID())
+		compare.Metrics.Round(compare.RecheckRounds() + 1)
+		bigkeys, err := rc.BigKeys()
+		if err != nil {
+			return err
+		}
+		defer bigkeys.Release()
+		compare.BigKeys = bigkeys
+		compare.CompareDB(ctx)
 
-		for i := 0; i < rc.CompareTimes-1; i++ {
-			time.Sleep(time.Duration(rc.CompareInterval) * time.Second)
+		convergence := rc.Recheck(ctx, compare.RecheckRounds(), func() string {
+			return compare.ResultFile
+		}, func(round int, filter func(key string) bool) error {
 			rfile := compare.ResultFile
-			compare.CompareKeysFromResultFile([]string{rfile})
-		}
+			compare.Metrics.Round(round + 2)
+			compare.Recheck = filter
+			return compare.CompareKeysFromResultFile(ctx, []string{rfile})
+		})
 		resultfiles = append(resultfiles, compare.ResultFile)
 		comparemap, _ := commons.Struct2Map(compare)
 		comparemap["Source"] = compare.Source.Options().Addr
 		comparemap["Target"] = compare.Target.Options().Addrs
+		comparemap["Coverage"] = rc.AddCoverage(&compare.Coverage)
+		comparemap["Convergence"] = convergence.Report()
+		if compare.BigKeys != nil {
+			comparemap["BigKeys"] = compare.BigKeys.Report()
+		}
+		if compare.Sampler != nil {
+			comparemap["Sample"] = compare.Sampler.Stats()
+		}
 		compares = append(compares, comparemap)
 
 	}
 
+	//反向比较目标库中多出的key，目标key在所有源库中均不存在时判定为多余
+	if rc.Bidirectional {
+		resultfile, reversemap := rc.CompareReverse(ctx, sclients, prefixes, nil, tclient)
+		resultfiles = append(resultfiles, resultfile)
+		compares = append(compares, reversemap)
+	}
+
+	//被中断或中止时标记为部分报告并记录覆盖范围
+	if partial := rc.PartialReport(ctx, monitor); partial != nil {
+		compares = append(compares, partial)
+	}
+	if monitor != nil {
+		compares = append(compares, monitor.Report())
+	}
+
 	//生成报告
 	if rc.Report {
 		GenReport(resultfiles, compares)
@@ -854,10 +2051,16 @@ func (rc *RedisCompare) MultiSingle2Cluster() error {
 		v.Close()
 	}
 
-	return nil
+	return rc.RunErr(ctx, monitor)
 }
 
-func (rc *RedisCompare) Cluster2Cluster() error {
+func (rc *RedisCompare) Cluster2Cluster(ctx context.Context) error {
+	//比较开始时会清理当前目录的result文件，同一进程中不能同时运行多个比较
+	release, ok := commons.AcquireExclusive()
+	if !ok {
+		return errors.New("Another compare is running, wait for it to finish or interrupt it")
+	}
+	defer release()
 
 	if len(rc.Saddr) == 0 {
 		return errors.New("No source address")
@@ -869,6 +2072,32 @@ func (rc *RedisCompare) Cluster2Cluster() error {
 		rc.CompareTimes = 1
 	}
 
+	filter, err := rc.KeyFilter()
+	if err != nil {
+		return err
+	}
+
+	keymapper, err := rc.KeyMapper()
+	if err != nil {
+		return err
+	}
+
+	normalizers, err := rc.Normalizers()
+	if err != nil {
+		return err
+	}
+
+	rules, err := rc.EqualRules()
+	if err != nil {
+		return err
+	}
+
+	sourcelimit, targetlimit := rc.RateLimits()
+	checkpoint, err := rc.LoadCheckpoint()
+	if err != nil {
+		return err
+	}
+
 	for _, v := range rc.Saddr {
 		sopt := &redis.Options{
 			Addr: v.Addr,
@@ -915,11 +2144,28 @@ func (rc *RedisCompare) Cluster2Cluster() error {
 		return errors.New(addrs + " " + tconnerr.Error())
 	}
 
-	//删除目录下上次运行时临时产生的result文件
-	files, _ := filepath.Glob("*.result")
-	for _, f := range files {
-		if err := os.Remove(f); err != nil {
-			panic(err)
+	//后台监控源与目标健康状态
+	monitor := rc.HealthMonitor(sclients, nil, tclient)
+	defer monitor.Stop()
+
+	//开启prometheus指标
+	metrics, err := rc.Metrics(ctx, sclients, nil, tclient)
+	if err != nil {
+		return err
+	}
+	defer metrics.Stop()
+
+	//输出比较进度，交互式命令行中可通过compare progress查询
+	tracker := rc.ProgressTracker(ctx, sclients)
+	defer tracker.Stop()
+
+	//删除目录下上次运行时临时产生的result文件，恢复时保留
+	if rc.Resume == "" {
+		files, _ := filepath.Glob("*.result")
+		for _, f := range files {
+			if err := os.Remove(f); err != nil {
+				panic(err)
+			}
 		}
 	}
 
@@ -927,29 +2173,83 @@ func (rc *RedisCompare) Cluster2Cluster() error {
 	var compares []interface{}
 	for _, v := range sclients {
 		compare := &compare.CompareSingle2Cluster{
-			Source:         v,
-			Target:         tclient,
-			BatchSize:      int64(rc.BatchSize),
-			TTLDiff:        float64(rc.TTLDiff),
-			RecordResult:   true,
-			CompareThreads: rc.Threads,
-		}
-		compare.CompareDB()
-		for i := 0; i < rc.CompareTimes-1; i++ {
-			time.Sleep(time.Duration(rc.CompareInterval) * time.Second)
+			Source:                v,
+			Target:                tclient,
+			BatchSize:             int64(rc.BatchSize),
+			TTLDiff:               float64(rc.TTLDiff),
+			RecordResult:          true,
+			CompareThreads:        rc.Threads,
+			StreamGroups:          rc.StreamGroups,
+			FullDiff:              rc.FullDiff,
+			MaxDiffPerKey:         rc.MaxDiffPerKey,
+			Digest:                rc.Digest,
+			Filter:                filter,
+			KeyMapper:             keymapper,
+			Sampler:               rc.Sampler(),
+			MemberSampleThreshold: rc.MemberSampleThreshold,
+			MemberSampleSize:      rc.MemberSampleSize,
+			StringChunkSize:       rc.StringChunkSize,
+			StringHash:            rc.StringHash,
+			Tolerance:             rc.Tolerance(),
+			Normalizers:           normalizers,
+			Rules:                 rules,
+			SourceLimit:           sourcelimit,
+			TargetLimit:           targetlimit,
+			Monitor:               monitor,
+			Checkpoint:            checkpoint,
+		}
+		tracker.Track(compare.CheckpointID(), &compare.Coverage)
+		compare.Metrics = rc.metrics.Source(rc.Scenario, compare.CheckpointID())
+		compare.Metrics.Round(compare.RecheckRounds() + 1)
+		bigkeys, err := rc.BigKeys()
+		if err != nil {
+			return err
+		}
+		defer bigkeys.Release()
+		compare.BigKeys = bigkeys
+		compare.CompareDB(ctx)
+		convergence := rc.Recheck(ctx, compare.RecheckRounds(), func() string {
+			return compare.ResultFile
+		}, func(round int, filter func(key string) bool) error {
 			rfile := compare.ResultFile
-			compare.CompareKeysFromResultFile([]string{rfile})
+			compare.Metrics.Round(round + 2)
+			compare.Recheck = filter
+			err := compare.CompareKeysFromResultFile(ctx, []string{rfile})
 			zaplogger.Sugar().Info(rfile + "|" + compare.ResultFile)
-		}
+			return err
+		})
 		resultfiles = append(resultfiles, compare.ResultFile)
 
 		comparemap, _ := commons.Struct2Map(compare)
 		comparemap["Source"] = compare.Source.Options().Addr
 		comparemap["Target"] = compare.Target.Options().Addrs
+		comparemap["Coverage"] = rc.AddCoverage(&compare.Coverage)
+		comparemap["Convergence"] = convergence.Report()
+		if compare.BigKeys != nil {
+			comparemap["BigKeys"] = compare.BigKeys.Report()
+		}
+		if compare.Sampler != nil {
+			comparemap["Sample"] = compare.Sampler.Stats()
+		}
 		compares = append(compares, comparemap)
 
 	}
 
+	//反向比较目标集群中多出的key，源集群各节点均不存在时判定为多余
+	if rc.Bidirectional {
+		resultfile, reversemap := rc.CompareReverse(ctx, sclients, nil, nil, tclient)
+		resultfiles = append(resultfiles, resultfile)
+		compares = append(compares, reversemap)
+	}
+
+	//被中断或中止时标记为部分报告并记录覆盖范围
+	if partial := rc.PartialReport(ctx, monitor); partial != nil {
+		compares = append(compares, partial)
+	}
+	if monitor != nil {
+		compares = append(compares, monitor.Report())
+	}
+
 	//生成报告
 	if rc.Report {
 		GenReport(resultfiles, compares)
@@ -958,7 +2258,357 @@ func (rc *RedisCompare) Cluster2Cluster() error {
 	for _, v := range sclients {
 		v.Close()
 	}
-	return nil
+	return rc.RunErr(ctx, monitor)
+}
+
+//根据大key阈值生成大key检测以及独立比较pool，未设置阈值时返回nil
+func (rc *RedisCompare) BigKeys() (*compare.BigKeys, error) {
+	return compare.NewBigKeys(compare.BigKeyPolicy{
+		MemoryThreshold: rc.BigKeyMemory,
+		LengthThreshold: rc.BigKeyLength,
+		Threads:         rc.BigKeyThreads,
+		Timeout:         time.Duration(rc.BigKeyTimeout) * time.Second,
+		BatchSize:       rc.BigKeyBatchSize,
+	})
+}
+
+//根据epsilon以及numericstring生成数值比较容差，未设置时返回nil
+func (rc *RedisCompare) Tolerance() *compare.Tolerance {
+	return compare.NewTolerance(rc.Epsilon, rc.RelEpsilon, rc.NumericString)
+}
+
+//解析pattern=codec[,codec]格式的规范化规则，未设置时返回nil
+func (rc *RedisCompare) Normalizers() (*compare.Normalizers, error) {
+	var rules []compare.NormalizeRule
+	for _, v := range rc.Normalize {
+		rule, err := compare.ParseNormalizeRule(v)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return compare.NewNormalizers(rules)
+}
+
+//读取自定义相等规则文件，未设置时返回nil
+func (rc *RedisCompare) EqualRules() (*compare.EqualRules, error) {
+	return compare.LoadEqualRules(rc.RuleFile)
+}
+
+//根据include、exclude以及types规则生成key过滤器
+func (rc *RedisCompare) KeyFilter() (*compare.KeyFilter, error) {
+	return compare.NewKeyFilter(rc.Include, rc.Exclude, rc.IncludeRegex, rc.ExcludeRegex, rc.Types, rc.ExcludeTypes)
+}
+
+//源与目标的限速规则，同一次执行中所有比较共用
+func (rc *RedisCompare) RateLimits() (*compare.RateLimit, *compare.RateLimit) {
+	if !rc.limitsReady {
+		rc.sourceLimit = compare.NewRateLimit(rc.SourceOps, rc.SourceBandwidth)
+		rc.targetLimit = compare.NewRateLimit(rc.TargetOps, rc.TargetBandwidth)
+		rc.limitsReady = true
+	}
+	return rc.sourceLimit, rc.targetLimit
+}
+
+//创建并启动源与目标的健康监控，未配置阈值时返回nil
+func (rc *RedisCompare) HealthMonitor(sclients []*redis.Client, tclient *redis.Client, tclusterclient *redis.ClusterClient) *compare.HealthMonitor {
+	threshold := compare.HealthThreshold{
+		MaxOpsPerSec:  rc.HealthMaxOps,
+		MaxClients:    rc.HealthMaxClients,
+		MaxUsedMemory: rc.HealthMaxMemory,
+		MaxLatency:    rc.HealthMaxLatency,
+	}
+	monitor := compare.NewHealthMonitor(threshold, time.Duration(rc.HealthInterval)*time.Second, time.Duration(rc.HealthAbort)*time.Second)
+	//同一实例的多个DB只监控一次
+	added := make(map[string]bool)
+	for _, v := range sclients {
+		if v == nil || added[v.Options().Addr] {
+			continue
+		}
+		added[v.Options().Addr] = true
+		monitor.AddClient("source", v)
+	}
+	monitor.AddClient("target", tclient)
+	monitor.AddCluster("target", tclusterclient)
+	monitor.Start()
+	rc.monitor = monitor
+	return monitor
+}
+
+//根据抽样参数生成抽样规则，每个源DB单独统计
+func (rc *RedisCompare) Sampler() *compare.Sampler {
+	return compare.NewSampler(rc.SampleRate, rc.SampleSize, rc.SampleSeed, rc.SampleConfidence)
+}
+
+//根据keymap规则生成源key到目标key的映射
+func (rc *RedisCompare) KeyMapper() (*compare.KeyMapper, error) {
+	return compare.NewKeyMapper(rc.KeyMap.Prefix, rc.KeyMap.Regex, rc.KeyMap.File)
+}
+
+//执行反向比较及循环比较，返回result文件及报告元数据，prefixes为与sclients一一对应的目标key前缀
+func (rc *RedisCompare) CompareReverse(ctx context.Context, sclients []*redis.Client, prefixes []string, tclient *redis.Client, tclusterclient *redis.ClusterClient) (string, map[string]interface{}) {
+	reverse := &compare.CompareReverse{
+		Sources:        sclients,
+		Target:         tclient,
+		TargetCluster:  tclusterclient,
+		BatchSize:      int64(rc.BatchSize),
+		RecordResult:   true,
+		CompareThreads: rc.Threads,
+		SourceDB:       reverseSourceDB(sclients),
+	}
+	reverse.Filter, _ = rc.KeyFilter()
+	reverse.KeyMapper, _ = rc.KeyMapper()
+	reverse.SourceLimit, reverse.TargetLimit = rc.RateLimits()
+	reverse.Monitor = rc.monitor
+	reverse.Checkpoint = rc.checkpoint
+	for _, v := range prefixes {
+		reverse.KeyMappers = append(reverse.KeyMappers, reverse.KeyMapper.WithDBPrefix(v))
+	}
+	if tclient != nil {
+		reverse.TargetDB = tclient.Options().DB
+	}
+
+	rc.progress.Track(reverse.CheckpointID(), &reverse.Coverage)
+	reverse.Metrics = rc.metrics.Source(rc.Scenario, reverse.CheckpointID())
+	reverse.Metrics.Round(reverse.RecheckRounds() + 1)
+	reverse.CompareDB(ctx)
+	convergence := rc.Recheck(ctx, reverse.RecheckRounds(), func() string {
+		return reverse.ResultFile
+	}, func(round int, filter func(key string) bool) error {
+		reverse.Metrics.Round(round + 2)
+		reverse.Recheck = filter
+		return reverse.CompareKeysFromResultFile(ctx, []string{reverse.ResultFile})
+	})
+
+	comparemap, _ := commons.Struct2Map(reverse)
+	delete(comparemap, "Sources")
+	delete(comparemap, "TargetCluster")
+	comparemap["Source"] = reverse.SourceAddrs()
+	comparemap["Target"] = reverse.TargetAddrs()
+	//反向scan同样计入整体覆盖范围，未完成时报告不视为完整
+	comparemap["Coverage"] = rc.AddCoverage(&reverse.Coverage)
+	comparemap["Convergence"] = convergence.Report()
+	return reverse.ResultFile, comparemap
+}
+
+//登记各源DBSIZE用于估算剩余时间，终端中运行且非后台命令时刷新进度行
+func (rc *RedisCompare) ProgressTracker(ctx context.Context, sclients []*redis.Client) *compare.ProgressTracker {
+	tracker := compare.NewProgressTracker(rc.Scenario)
+	for _, v := range sclients {
+		tracker.Add(compare.CheckpointID(v.Options().Addr, v.Options().DB), v.DBSize().Val())
+	}
+
+	var out io.Writer
+	stat, err := os.Stderr.Stat()
+	if err == nil && (stat.Mode()&os.ModeCharDevice) != 0 && !commons.IsBackground(ctx) {
+		out = os.Stderr
+	}
+	tracker.Start(out)
+	rc.progress = tracker
+	return tracker
+}
+
+//在MetricsAddr上提供prometheus指标并统计源与目标的命令延迟，未配置地址时返回nil
+func (rc *RedisCompare) Metrics(ctx context.Context, sclients []*redis.Client, tclients []*redis.Client, tclusterclient *redis.ClusterClient) (*compare.Metrics, error) {
+	if rc.MetricsAddr == "" {
+		return nil, nil
+	}
+	metrics := compare.NewMetrics()
+	if err := metrics.Serve(rc.MetricsAddr); err != nil {
+		return nil, err
+	}
+	//hook按添加顺序执行，先挂载限流使延迟不包含限流等待，比较时不会重复挂载
+	sourcelimit, targetlimit := rc.RateLimits()
+	for _, v := range sclients {
+		sourcelimit.Apply(ctx, v)
+		metrics.Hook(rc.Scenario, "source", v.Options().Addr, v)
+	}
+	for _, v := range tclients {
+		targetlimit.Apply(ctx, v)
+		metrics.Hook(rc.Scenario, "target", rc.Taddr, v)
+	}
+	targetlimit.Apply(ctx, tclusterclient)
+	metrics.Hook(rc.Scenario, "target", rc.Taddr, tclusterclient)
+	metrics.CompareTimes(rc.Scenario, rc.CompareTimes)
+	rc.metrics = metrics
+	return metrics, nil
+}
+
+//按复查策略复查差异key，差异为空或所有key用完复查次数时提前结束，返回各key收敛的轮次
+func (rc *RedisCompare) Recheck(ctx context.Context, rounds int, resultfile func() string, recheck func(round int, filter func(key string) bool) error) *compare.Convergence {
+	budget := rc.RetryBudget
+	if budget <= 0 {
+		budget = rc.CompareTimes - 1
+	}
+	backoff := rc.RecheckBackoff
+	if backoff == 0 {
+		backoff = 2
+	}
+	policy := compare.RecheckPolicy{
+		Interval:    time.Duration(rc.CompareInterval) * time.Second,
+		Backoff:     backoff,
+		MaxInterval: time.Duration(rc.RecheckMaxInterval) * time.Second,
+		RetryBudget: budget,
+	}
+
+	convergence := compare.NewConvergence(compare.ResultFileKeys(resultfile()), rounds, policy.RetryBudget)
+	for round := rounds; convergence.Remaining() > 0; round++ {
+		if !sleepContext(ctx, policy.Delay(round)) {
+			break
+		}
+		//只复查仍有复查次数的key，被中断的一轮不计入收敛统计
+		if err := recheck(round, convergence.Recheck); err != nil {
+			break
+		}
+		convergence.Update(compare.ResultFileKeys(resultfile()))
+	}
+	return convergence
+}
+
+//根据watch参数创建watch，比较使用已配置的filter、keymap、限速等规则
+func (rc *RedisCompare) NewWatch(ctx context.Context, sclient *redis.Client, target redis.UniversalClient, targetdb int, comparer compare.WatchCompare) *compare.Watch {
+	watch := &compare.Watch{
+		Source:       sclient,
+		Target:       target,
+		TargetDB:     targetdb,
+		Compare:      comparer,
+		Delay:        time.Duration(rc.WatchDelay) * time.Millisecond,
+		Threads:      rc.Threads,
+		BatchSize:    rc.BatchSize,
+		EnableNotify: rc.WatchNotify,
+	}
+	watch.Filter, _ = rc.KeyFilter()
+	//后台执行时差异只写入result文件以及日志
+	if !commons.IsBackground(ctx) {
+		watch.Feed = os.Stdout
+	}
+	return watch
+}
+
+//运行watch直到被中断，生成报告时记录运行统计
+func (rc *RedisCompare) RunWatch(ctx context.Context, watch *compare.Watch) error {
+	err := watch.Run(ctx)
+	if rc.Report {
+		watchmap := map[string]interface{}{
+			"Scenario":   rc.Scenario,
+			"Source":     watch.Source.Options().Addr,
+			"Target":     rc.Taddr,
+			"SourceDB":   watch.Source.Options().DB,
+			"TargetDB":   watch.TargetDB,
+			"ResultFile": watch.ResultFile,
+			"Watch":      watch.Stats(),
+		}
+		GenReport([]string{watch.ResultFile}, []interface{}{watchmap})
+	}
+	return err
+}
+
+//记录比较的覆盖范围用于汇总，返回报告元数据
+func (rc *RedisCompare) AddCoverage(coverage *compare.Coverage) map[string]interface{} {
+	rc.coverages = append(rc.coverages, coverage)
+	return coverage.Report()
+}
+
+//比较被中断或中止时返回部分报告的说明以及汇总的覆盖范围，完整比较时返回nil
+func (rc *RedisCompare) PartialReport(ctx context.Context, monitor *compare.HealthMonitor) map[string]interface{} {
+	if ctx.Err() == nil && !monitor.Aborted() {
+		return nil
+	}
+	report := make(map[string]interface{})
+	report["Partial"] = true
+	if ctx.Err() != nil {
+		report["PartialReason"] = "interrupted by signal"
+	} else {
+		report["PartialReason"] = monitor.Err().Error()
+	}
+	report["Coverage"] = compare.MergeCoverage(rc.coverages...).Report()
+	return report
+}
+
+//比较结束时的返回错误，被中断时提示可从检查点恢复
+func (rc *RedisCompare) RunErr(ctx context.Context, monitor *compare.HealthMonitor) error {
+	if ctx.Err() != nil {
+		msg := "Compare interrupted, partial result kept"
+		if rc.checkpoint != nil {
+			msg = msg + ", resume with --resume " + rc.checkpoint.File()
+		}
+		return errors.New(msg)
+	}
+	return monitor.Err()
+}
+
+//恢复时读取--resume指定的检查点，否则新建检查点，进度均写入该文件
+func (rc *RedisCompare) LoadCheckpoint() (*compare.Checkpoint, error) {
+	if rc.checkpoint != nil {
+		return rc.checkpoint, nil
+	}
+	//未指定--checkpoint时不记录检查点
+	if rc.Resume == "" {
+		if rc.Checkpoint == "" {
+			return nil, nil
+		}
+		rc.checkpoint = compare.NewCheckpoint(rc.Checkpoint, rc.Scenario)
+		return rc.checkpoint, nil
+	}
+
+	checkpoint, err := compare.LoadCheckpoint(rc.Resume)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.Scenario != rc.Scenario {
+		return nil, errors.New("Checkpoint scenario " + checkpoint.Scenario + " not match " + rc.Scenario)
+	}
+	rc.checkpoint = checkpoint
+	return checkpoint, nil
+}
+
+//返回源DB对应的目标DB，DbMap中未配置时使用Tdb
+func (rc *RedisCompare) TargetDB(saddr SAddr, sdb int) int {
+	if tdb, ok := saddr.DbMap[sdb]; ok {
+		return tdb
+	}
+	return rc.Tdb
+}
+
+//解析"源DB:目标DB"格式的DB映射
+func ParseDBMap(items []string) (map[int]int, error) {
+	dbmap := make(map[int]int)
+	for _, v := range items {
+		dbs := strings.SplitN(v, ":", 2)
+		if len(dbs) != 2 {
+			return nil, errors.New("invalid db map: " + v)
+		}
+		sdb, err := strconv.Atoi(strings.TrimSpace(dbs[0]))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid db map: "+v)
+		}
+		tdb, err := strconv.Atoi(strings.TrimSpace(dbs[1]))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid db map: "+v)
+		}
+		dbmap[sdb] = tdb
+	}
+	return dbmap, nil
+}
+
+//多个源DB映射到同一目标时SourceDB记为-1
+func reverseSourceDB(sclients []*redis.Client) int {
+	if len(sclients) == 1 {
+		return sclients[0].Options().DB
+	}
+	return -1
+}
+
+//等待d，ctx取消时提前返回false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
 
 func GenReport(resultfiles []string, compares []interface{}) error {
@@ -967,6 +2617,10 @@ func GenReport(resultfiles []string, compares []interface{}) error {
 	jsonBytes, _ := json.Marshal(compares)
 	commons.AppendLineToFile(bytes.NewBuffer(jsonBytes), reportfile)
 	for _, v := range resultfiles {
+		//无差异时不会生成result文件
+		if !commons.FileExists(v) {
+			continue
+		}
 		fi, err := os.Open(v)
 		defer fi.Close()
 		if err != nil {
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"rediscompare/commons"
+	"rediscompare/compare"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/spf13/cobra"
+)
+
+func NewRepairCommand() *cobra.Command {
+	sc := &cobra.Command{
+		Use:   "repair <result or report files>",
+		Short: "copy different keys from source to target by result or report files",
+		Run:   repairCommandFunc,
+	}
+	sc.Flags().String("saddr", "127.0.0.1:6379", "Source redis address,cluster addresses splite with ',' default is 127.0.0.1:6379")
+	sc.Flags().String("taddr", "127.0.0.1:6379", "Target redis address,cluster addresses splite with ',' default is 127.0.0.1:6379")
+	sc.Flags().String("spassword", "", "Source redis password")
+	sc.Flags().String("tpassword", "", "Target redis password")
+	sc.Flags().Bool("scluster", false, "whether source is redis cluster default is false")
+	sc.Flags().Bool("tcluster", false, "whether target is redis cluster default is false")
+	sc.Flags().Bool("deleteextra", false, "whether delete target keys not exists in source default is false")
+	sc.Flags().Bool("dryrun", false, "only log actions without writing target default is false")
+	sc.Flags().Int64("batchsize", 100, "Elements per batch when rewriting key by type default is 100")
+	sc.Flags().Int64("sourceops", 0, "Max commands per second sent to source,default is 0 as unlimited")
+	sc.Flags().Int64("sourcebandwidth", 0, "Max bytes per second read from and write to source,default is 0 as unlimited")
+	sc.Flags().Int64("targetops", 0, "Max commands per second sent to target,default is 0 as unlimited")
+	sc.Flags().Int64("targetbandwidth", 0, "Max bytes per second read from and write to target,default is 0 as unlimited")
+	sc.Flags().String("script", "", "Write remediation commands to the file for review instead of writing target")
+	sc.Flags().String("scriptformat", compare.ScriptFormatCli, "Format of script,'cli' as redis-cli command file or 'resp' for redis-cli --pipe,default is cli")
+	sc.Flags().String("log", "", "Log file of actions taken per key,default is ./repair_<time>.log")
+	return sc
+}
+
+func repairCommandFunc(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		cmd.PrintErrln(errors.New("Please input result or report file"))
+		return
+	}
+
+	saddr, _ := cmd.Flags().GetString("saddr")
+	taddr, _ := cmd.Flags().GetString("taddr")
+	spassword, _ := cmd.Flags().GetString("spassword")
+	tpassword, _ := cmd.Flags().GetString("tpassword")
+	scluster, _ := cmd.Flags().GetBool("scluster")
+	tcluster, _ := cmd.Flags().GetBool("tcluster")
+	deleteextra, _ := cmd.Flags().GetBool("deleteextra")
+	dryrun, _ := cmd.Flags().GetBool("dryrun")
+	batchsize, _ := cmd.Flags().GetInt64("batchsize")
+	sourceops, _ := cmd.Flags().GetInt64("sourceops")
+	sourcebandwidth, _ := cmd.Flags().GetInt64("sourcebandwidth")
+	targetops, _ := cmd.Flags().GetInt64("targetops")
+	targetbandwidth, _ := cmd.Flags().GetInt64("targetbandwidth")
+	scriptfile, _ := cmd.Flags().GetString("script")
+	scriptformat, _ := cmd.Flags().GetString("scriptformat")
+	logfile, _ := cmd.Flags().GetString("log")
+	if logfile == "" {
+		logfile = "./repair_" + time.Now().Format("20060102150405") + ".log"
+	}
+
+	ctx, done := commons.CommandContext(cmd.Context())
+	defer done()
+	source := NewRepairClients(ctx, saddr, spassword, scluster, compare.NewRateLimit(sourceops, sourcebandwidth))
+	defer source.Close()
+	target := NewRepairClients(ctx, taddr, tpassword, tcluster, compare.NewRateLimit(targetops, targetbandwidth))
+	defer target.Close()
+
+	//check redis 连通性
+	if err := source.Get(0).Ping().Err(); err != nil {
+		cmd.PrintErrln(errors.New(saddr + " " + err.Error()))
+		return
+	}
+	if err := target.Get(0).Ping().Err(); err != nil {
+		cmd.PrintErrln(errors.New(taddr + " " + err.Error()))
+		return
+	}
+
+	repair := &compare.Repair{
+		Source:      source.Get,
+		Target:      target.Get,
+		DeleteExtra: deleteextra,
+		DryRun:      dryrun,
+		BatchSize:   batchsize,
+		LogFile:     logfile,
+	}
+
+	//生成修复脚本时不写目标库
+	if scriptfile != "" {
+		script, err := compare.NewRemediationScript(scriptfile, scriptformat, tcluster)
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		repair.Script = script
+	}
+
+	err := repair.RepairFiles(ctx, args)
+	if closeerr := repair.Script.Close(); closeerr != nil && err == nil {
+		err = closeerr
+	}
+
+	//按动作输出修复的key数量
+	actions := []string{}
+	for k := range repair.Summary {
+		actions = append(actions, k)
+	}
+	sort.Strings(actions)
+	summary := []string{}
+	for _, v := range actions {
+		summary = append(summary, v+" "+strconv.Itoa(repair.Summary[v]))
+	}
+	if dryrun {
+		cmd.Println("Dry run, target not changed")
+	}
+	cmd.Println("Repair " + strings.Join(summary, ", ") + ", actions logged in " + logfile)
+	if repair.Script != nil && !dryrun {
+		cmd.Println(strconv.FormatInt(repair.Script.Commands(), 10) + " commands written to " + scriptfile + ", target not changed")
+	}
+	if err != nil {
+		cmd.PrintErrln(err)
+	}
+}
+
+//按DB缓存的single client，cluster时所有DB共用一个client
+type RepairClients struct {
+	ctx      context.Context
+	addr     string
+	password string
+	limit    *compare.RateLimit
+	cluster  *redis.ClusterClient
+	clients  map[int]*redis.Client
+}
+
+//ctx取消时限速等待中的命令立即返回
+func NewRepairClients(ctx context.Context, addr string, password string, cluster bool, limit *compare.RateLimit) *RepairClients {
+	clients := &RepairClients{
+		ctx:      ctx,
+		addr:     addr,
+		password: password,
+		limit:    limit,
+		clients:  make(map[int]*redis.Client),
+	}
+	if cluster {
+		opt := &redis.ClusterOptions{
+			Addrs: strings.Split(addr, ","),
+		}
+		if password != "" {
+			opt.Password = password
+		}
+		clients.cluster = redis.NewClusterClient(opt)
+		limit.Apply(ctx, clients.cluster)
+	}
+	return clients
+}
+
+func (clients *RepairClients) Get(db int) redis.UniversalClient {
+	if clients.cluster != nil {
+		return clients.cluster
+	}
+	if client, ok := clients.clients[db]; ok {
+		return client
+	}
+	opt := &redis.Options{
+		Addr: clients.addr,
+		DB:   db,
+	}
+	if clients.password != "" {
+		opt.Password = clients.password
+	}
+	client := commons.GetGoRedisClient(opt)
+	clients.limit.Apply(clients.ctx, client)
+	clients.clients[db] = client
+	return client
+}
+
+func (clients *RepairClients) Close() {
+	if clients.cluster != nil {
+		clients.cluster.Close()
+	}
+	for _, v := range clients.clients {
+		v.Close()
+	}
+}
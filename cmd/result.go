@@ -101,6 +101,7 @@ func parseResultFileCommandFunc(cmd *cobra.Command, args []string) {
 			source,
 			target,
 			gjson.Get(fileline, "Key").String(),
+			gjson.Get(fileline, "TargetKey").String(),
 			gjson.Get(fileline, "SourceDB").String(),
 			gjson.Get(fileline, "TargetDB").String(),
 			gjson.Get(fileline, "KeyDiffReason").String(),
@@ -118,7 +119,7 @@ func parseResultFileCommandFunc(cmd *cobra.Command, args []string) {
 	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.SetColWidth(12)
-	table.SetHeader([]string{"Source", "Target", "Key", "SourceDB", "TargetDB", "KeyDiffReason"})
+	table.SetHeader([]string{"Source", "Target", "Key", "TargetKey", "SourceDB", "TargetDB", "KeyDiffReason"})
 	//table.SetBorder(false)
 	table.AppendBulk(data)
 	table.Render()
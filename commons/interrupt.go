@@ -0,0 +1,87 @@
+package commons
+
+import (
+	"context"
+	"sync"
+)
+
+type interruptEntry struct {
+	cancel context.CancelFunc
+}
+
+type backgroundKey struct{}
+
+var (
+	interruptMu      sync.Mutex
+	interruptEntries []*interruptEntry
+	exclusiveRunning bool
+)
+
+//为正在执行的命令创建可被信号中断的context，命令结束时调用返回的函数
+func CommandContext(parent context.Context) (context.Context, func()) {
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	entry := &interruptEntry{cancel: cancel}
+	interruptMu.Lock()
+	interruptEntries = append(interruptEntries, entry)
+	interruptMu.Unlock()
+
+	return ctx, func() {
+		removeInterrupt(entry)
+		cancel()
+	}
+}
+
+//取消最近开始的正在执行的命令，没有可中断的命令时返回false
+func Interrupt() bool {
+	interruptMu.Lock()
+	if len(interruptEntries) == 0 {
+		interruptMu.Unlock()
+		return false
+	}
+	entry := interruptEntries[len(interruptEntries)-1]
+	interruptEntries = interruptEntries[:len(interruptEntries)-1]
+	interruptMu.Unlock()
+
+	entry.cancel()
+	return true
+}
+
+func removeInterrupt(entry *interruptEntry) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	for k, v := range interruptEntries {
+		if v == entry {
+			interruptEntries = append(interruptEntries[:k], interruptEntries[k+1:]...)
+			return
+		}
+	}
+}
+
+//同一进程中同时只允许一个命令持有，已被持有时返回false，命令结束时调用返回的函数
+func AcquireExclusive() (func(), bool) {
+	interruptMu.Lock()
+	defer interruptMu.Unlock()
+	if exclusiveRunning {
+		return nil, false
+	}
+	exclusiveRunning = true
+	return func() {
+		interruptMu.Lock()
+		exclusiveRunning = false
+		interruptMu.Unlock()
+	}, true
+}
+
+//标记为交互式命令行中后台执行的命令
+func WithBackground(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+//后台执行的命令不在终端输出进度
+func IsBackground(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
@@ -0,0 +1,55 @@
+package commons
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInterrupt(t *testing.T) {
+	if Interrupt() {
+		t.Fatal("interrupt without running command should return false")
+	}
+
+	outer, outerdone := CommandContext(context.Background())
+	defer outerdone()
+	inner, innerdone := CommandContext(context.Background())
+
+	if !Interrupt() {
+		t.Fatal("interrupt should cancel running command")
+	}
+	if inner.Err() == nil || outer.Err() != nil {
+		t.Error("only the innermost command should be canceled")
+	}
+	innerdone()
+
+	//被中断的命令不再参与后续中断
+	if !Interrupt() || outer.Err() == nil {
+		t.Error("second interrupt should cancel outer command")
+	}
+	if Interrupt() {
+		t.Error("interrupt without running command should return false")
+	}
+
+	background := WithBackground(context.Background())
+	job, jobdone := CommandContext(background)
+	defer jobdone()
+	if !IsBackground(job) || IsBackground(outer) {
+		t.Error("background flag should only be set on background commands")
+	}
+}
+
+func TestAcquireExclusive(t *testing.T) {
+	release, ok := AcquireExclusive()
+	if !ok {
+		t.Fatal("first acquire should succeed")
+	}
+	if _, ok := AcquireExclusive(); ok {
+		t.Error("second acquire should fail while the first is running")
+	}
+	release()
+	release, ok = AcquireExclusive()
+	if !ok {
+		t.Fatal("acquire should succeed after release")
+	}
+	release()
+}
@@ -0,0 +1,57 @@
+package commons
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//令牌桶限速器，允许透支，透支的令牌由后续调用等待补足，桶容量为一秒的令牌数
+type RateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+//rate为每秒令牌数，不大于0时返回nil表示不限速
+func NewRateLimiter(rate int64) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+//获取n个令牌，令牌不足时阻塞到透支部分补足为止，ctx取消时提前返回ctx.Err()
+func (limiter *RateLimiter) Wait(ctx context.Context, n int64) error {
+	if limiter == nil || n <= 0 {
+		return nil
+	}
+
+	limiter.mu.Lock()
+	now := time.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.rate {
+		limiter.tokens = limiter.rate
+	}
+	limiter.last = now
+	limiter.tokens -= float64(n)
+	wait := time.Duration(-limiter.tokens / limiter.rate * float64(time.Second))
+	limiter.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
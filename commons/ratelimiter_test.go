@@ -0,0 +1,39 @@
+package commons
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(100)
+	begin := time.Now()
+	//桶内100个令牌立即可用，其余50个需等待约0.5秒
+	for i := 0; i < 150; i++ {
+		limiter.Wait(context.Background(), 1)
+	}
+	elapsed := time.Since(begin)
+	if elapsed < 400*time.Millisecond || elapsed > time.Second {
+		t.Errorf("150 tokens at 100/s took %s, want about 500ms", elapsed)
+	}
+
+	var nolimit *RateLimiter
+	nolimit.Wait(context.Background(), 1000)
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	limiter := NewRateLimiter(1)
+	limiter.Wait(context.Background(), 1)
+
+	//透支10秒的令牌，取消后立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	if err := limiter.Wait(ctx, 10); err != context.DeadlineExceeded {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("canceled wait took %s", elapsed)
+	}
+}
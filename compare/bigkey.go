@@ -0,0 +1,207 @@
+package compare
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/panjf2000/ants/v2"
+)
+
+//报告中列出的大key数量上限
+const maxBigKeyRecords = 100
+
+//大key比较默认线程数量
+const DefaultBigKeyThreads = 2
+
+type bigKeyContextKey struct{}
+
+//大key判定规则以及独立比较pool的配置
+type BigKeyPolicy struct {
+	MemoryThreshold int64         //MEMORY USAGE超过该值(字节)视为大key，0表示不检查
+	LengthThreshold int64         //元素数量或string长度超过该值视为大key，0表示不检查
+	Threads         int           //大key比较线程数量，默认2
+	Timeout         time.Duration //单个大key比较超时时间，0表示不限制
+	BatchSize       int64         //大key每批次读取的元素数量，0表示与普通key相同
+}
+
+//未设置任何阈值时不检测大key
+func (policy BigKeyPolicy) Enabled() bool {
+	return policy.MemoryThreshold > 0 || policy.LengthThreshold > 0
+}
+
+//大key比较记录
+type BigKeyRecord struct {
+	Key      string
+	Type     string
+	Length   int64  //元素数量，string为字节长度
+	Memory   int64  //MEMORY USAGE字节数，未检查或不支持时为0
+	Duration string //比较耗时
+	IsEqual  bool
+	TimedOut bool //超时未完成比较
+	duration time.Duration
+}
+
+//大key检测以及独立的有界比较pool，避免大key长时间占用普通比较worker
+type BigKeys struct {
+	Policy  BigKeyPolicy
+	pool    *ants.Pool
+	mu      sync.Mutex
+	records []BigKeyRecord
+}
+
+//未设置任何阈值时返回nil
+func NewBigKeys(policy BigKeyPolicy) (*BigKeys, error) {
+	if !policy.Enabled() {
+		return nil, nil
+	}
+	if policy.Threads <= 0 {
+		policy.Threads = DefaultBigKeyThreads
+	}
+	//pool满时提交阻塞，限制同时比较的大key数量
+	pool, err := ants.NewPool(policy.Threads)
+	if err != nil {
+		return nil, err
+	}
+	return &BigKeys{Policy: policy, pool: pool}, nil
+}
+
+//获取key的元素数量以及内存占用，超过任一阈值时返回true
+func (bigkeys *BigKeys) Detect(client redis.Cmdable, key, keytype string) (BigKeyRecord, bool) {
+	record := BigKeyRecord{Key: key, Type: keytype}
+	if bigkeys == nil {
+		return record, false
+	}
+	if bigkeys.Policy.LengthThreshold > 0 {
+		record.Length = KeyLength(client, key, keytype)
+		if record.Length > bigkeys.Policy.LengthThreshold {
+			return record, true
+		}
+	}
+	if bigkeys.Policy.MemoryThreshold > 0 {
+		//MEMORY USAGE需要redis 4.0以上，失败时只按长度判断
+		memory, err := client.MemoryUsage(key).Result()
+		if err == nil {
+			record.Memory = memory
+			if memory > bigkeys.Policy.MemoryThreshold {
+				return record, true
+			}
+		}
+	}
+	return record, false
+}
+
+//提交大key比较任务，pool满时阻塞；超时时compareKey的context被取消，done收到context.DeadlineExceeded
+func (bigkeys *BigKeys) Submit(ctx context.Context, wg *sync.WaitGroup, record BigKeyRecord,
+	compareKey func(ctx context.Context, key, keytype string) *CompareResult,
+	done func(ctx context.Context, key string, result *CompareResult, err error)) error {
+	wg.Add(1)
+	err := bigkeys.pool.Submit(func() {
+		defer wg.Done()
+		keyctx := context.WithValue(ctx, bigKeyContextKey{}, bigkeys.Policy)
+		if bigkeys.Policy.Timeout > 0 {
+			var cancel context.CancelFunc
+			keyctx, cancel = context.WithTimeout(keyctx, bigkeys.Policy.Timeout)
+			defer cancel()
+		}
+
+		start := time.Now()
+		result := compareKey(keyctx, record.Key, record.Type)
+		//整体被中断时不记录
+		if ctx.Err() != nil {
+			return
+		}
+		record.duration = time.Since(start)
+		record.Duration = record.duration.String()
+		if keyctx.Err() == context.DeadlineExceeded {
+			record.TimedOut = true
+			done(ctx, record.Key, nil, keyctx.Err())
+		} else {
+			record.IsEqual = result == nil || result.IsEqual
+			done(ctx, record.Key, result, nil)
+		}
+		bigkeys.mu.Lock()
+		bigkeys.records = append(bigkeys.records, record)
+		bigkeys.mu.Unlock()
+	})
+	if err != nil {
+		wg.Done()
+	}
+	return err
+}
+
+//释放大key比较pool
+func (bigkeys *BigKeys) Release() {
+	if bigkeys == nil {
+		return
+	}
+	bigkeys.pool.Release()
+}
+
+//大key列表按比较耗时倒序排列，返回报告元数据
+func (bigkeys *BigKeys) Report() map[string]interface{} {
+	if bigkeys == nil {
+		return nil
+	}
+	bigkeys.mu.Lock()
+	records := append([]BigKeyRecord(nil), bigkeys.records...)
+	bigkeys.mu.Unlock()
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].duration > records[j].duration
+	})
+	timedout := 0
+	for _, v := range records {
+		if v.TimedOut {
+			timedout++
+		}
+	}
+	count := len(records)
+	if len(records) > maxBigKeyRecords {
+		records = records[:maxBigKeyRecords]
+	}
+	return map[string]interface{}{
+		"MemoryThreshold": bigkeys.Policy.MemoryThreshold,
+		"LengthThreshold": bigkeys.Policy.LengthThreshold,
+		"Timeout":         bigkeys.Policy.Timeout.String(),
+		"Count":           count,
+		"TimedOut":        timedout,
+		"Keys":            records,
+		"Truncated":       count > maxBigKeyRecords,
+	}
+}
+
+//返回key的元素数量，string返回字节长度
+func KeyLength(client redis.Cmdable, key, keytype string) int64 {
+	switch keytype {
+	case "string":
+		return client.StrLen(key).Val()
+	case "list":
+		return client.LLen(key).Val()
+	case "hash":
+		return client.HLen(key).Val()
+	case "set":
+		return client.SCard(key).Val()
+	case "zset":
+		return client.ZCard(key).Val()
+	case "stream":
+		return client.XLen(key).Val()
+	}
+	return 0
+}
+
+//判断是否在比较大key
+func IsBigKey(ctx context.Context) bool {
+	_, ok := ctx.Value(bigKeyContextKey{}).(BigKeyPolicy)
+	return ok
+}
+
+//返回每批次读取的元素数量，比较大key时使用大key规则中的批次大小
+func ChunkSize(ctx context.Context, batchsize int64) int64 {
+	if policy, ok := ctx.Value(bigKeyContextKey{}).(BigKeyPolicy); ok && policy.BatchSize > 0 {
+		return policy.BatchSize
+	}
+	return batchsize
+}
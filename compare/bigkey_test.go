@@ -0,0 +1,123 @@
+package compare
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewBigKeysDisabled(t *testing.T) {
+	bigkeys, err := NewBigKeys(BigKeyPolicy{Threads: 4})
+	if err != nil || bigkeys != nil {
+		t.Fatalf("got %v, %v without thresholds", bigkeys, err)
+	}
+	//未开启时不检测，也不生成报告
+	if _, big := bigkeys.Detect(nil, "a", "string"); big {
+		t.Error("nil big keys should not detect")
+	}
+	if bigkeys.Report() != nil {
+		t.Error("nil big keys should not report")
+	}
+	bigkeys.Release()
+}
+
+func TestBigKeysSubmit(t *testing.T) {
+	bigkeys, err := NewBigKeys(BigKeyPolicy{LengthThreshold: 10, Timeout: 50 * time.Millisecond, BatchSize: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bigkeys.Release()
+
+	compareKey := func(ctx context.Context, key, keytype string) *CompareResult {
+		if !IsBigKey(ctx) || ChunkSize(ctx, 10) != 1000 {
+			t.Error("big key context should carry the big key batch size")
+		}
+		result := NewCompareResult()
+		result.Key = key
+		result.IsEqual = key != "diff"
+		if key == "slow" {
+			<-ctx.Done()
+		}
+		return &result
+	}
+	var mu sync.Mutex
+	done := map[string]error{}
+	record := func(ctx context.Context, key string, result *CompareResult, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		done[key] = err
+	}
+
+	var pending sync.WaitGroup
+	for _, v := range []string{"slow", "diff", "same"} {
+		if err := bigkeys.Submit(context.Background(), &pending, BigKeyRecord{Key: v, Type: "hash", Length: 20}, compareKey, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pending.Wait()
+
+	if len(done) != 3 || done["slow"] != context.DeadlineExceeded || done["diff"] != nil {
+		t.Errorf("got done %v", done)
+	}
+	report := bigkeys.Report()
+	keys := report["Keys"].([]BigKeyRecord)
+	if report["Count"] != 3 || report["TimedOut"] != 1 || keys[0].Key != "slow" || !keys[0].TimedOut {
+		t.Errorf("got report %v", report)
+	}
+	for _, v := range keys {
+		if v.Key == "diff" && v.IsEqual {
+			t.Error("diff key should be recorded as not equal")
+		}
+	}
+
+	if IsBigKey(context.Background()) || ChunkSize(context.Background(), 10) != 10 {
+		t.Error("normal key should use the compare batch size")
+	}
+}
+
+func TestCompareKeysBigKeyHandoff(t *testing.T) {
+	compare, source, target := newSampleCompare(t)
+	bigkeys, err := NewBigKeys(BigKeyPolicy{LengthThreshold: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bigkeys.Release()
+	compare.BigKeys = bigkeys
+	source.Set(0, "big", fakeHash{"a": "1", "b": "2"})
+	target.Set(0, "big", fakeHash{"a": "1", "b": "2"})
+	source.Set(0, "s", fakeSet{"a": true})
+	target.Set(0, "s", fakeSet{"a": true})
+
+	progress := NewScanProgress(0, 0)
+	seq := progress.Add(0, 0, 2)
+	batchctx := WithScanBatch(context.Background(), progress, seq)
+	release := target.Block("hget")
+
+	//大key交给独立pool后批次立即返回，不占用普通worker
+	returned := make(chan error)
+	go func() {
+		returned <- compare.CompareKeys(batchctx, []string{"big", "s"})
+	}()
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		release()
+		t.Fatal("CompareKeys should not wait for big keys")
+	}
+	DoneBatch(batchctx)
+	if _, scanned := progress.SafeCursor(); scanned != 0 || compare.Coverage.ComparedKeys != 1 {
+		t.Errorf("batch should wait for big key, got scanned %d compared %d", scanned, compare.Coverage.ComparedKeys)
+	}
+
+	release()
+	compare.bigKeysPending.Wait()
+	state := SourceCheckpoint{}
+	progress.Save(&state)
+	if state.Scanned != 2 || state.Compared != 2 || compare.Coverage.ComparedKeys != 2 {
+		t.Errorf("got state %+v coverage %+v", state, compare.Coverage)
+	}
+}
@@ -0,0 +1,288 @@
+package compare
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/tidwall/gjson"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//单个源DB(或cluster节点)的比较进度
+type SourceCheckpoint struct {
+	Cursor     uint64 //该cursor之前的key均已比较完成
+	ResultFile string //当前result文件
+	Scanned    int64  //已比较完成的scan key数量
+	Compared   int64  //已完成批次中比较的key数量，恢复时继续累计覆盖范围
+	Diffs      int64  //已完成批次中不一致的key数量
+	Errors     int64  //已完成批次中无法比较的key数量
+	Finished   bool   //scan是否已完成
+	Rounds     int    //已完成的复查轮次
+}
+
+//比较进度检查点，定期写入文件，中断后通过--resume从中恢复
+type Checkpoint struct {
+	Scenario string
+	Sources  map[string]*SourceCheckpoint //key为源地址与DB，见CheckpointID
+	Updated  string
+
+	file string
+	mu   sync.Mutex
+}
+
+//file为空时返回nil表示不记录检查点
+func NewCheckpoint(file string, scenario string) *Checkpoint {
+	if file == "" {
+		return nil
+	}
+	return &Checkpoint{
+		Scenario: scenario,
+		Sources:  make(map[string]*SourceCheckpoint),
+		file:     file,
+	}
+}
+
+//读取检查点，后续进度继续写入该文件
+func LoadCheckpoint(file string) (*Checkpoint, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, err
+	}
+	if checkpoint.Sources == nil {
+		return nil, errors.New("invalid checkpoint file: " + file)
+	}
+	checkpoint.file = file
+	return checkpoint, nil
+}
+
+func CheckpointID(addr string, db int) string {
+	return addr + "/" + strconv.Itoa(db)
+}
+
+//返回源的进度副本，ok为false表示检查点中没有该源
+func (checkpoint *Checkpoint) State(id string) (SourceCheckpoint, bool) {
+	if checkpoint == nil {
+		return SourceCheckpoint{}, false
+	}
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+	state, ok := checkpoint.Sources[id]
+	if !ok {
+		return SourceCheckpoint{}, false
+	}
+	return *state, true
+}
+
+//更新源的进度并写入文件
+func (checkpoint *Checkpoint) Update(id string, fn func(state *SourceCheckpoint)) error {
+	if checkpoint == nil {
+		return nil
+	}
+	checkpoint.mu.Lock()
+	defer checkpoint.mu.Unlock()
+	state, ok := checkpoint.Sources[id]
+	if !ok {
+		state = &SourceCheckpoint{}
+		checkpoint.Sources[id] = state
+	}
+	fn(state)
+	return checkpoint.save()
+}
+
+//先写临时文件再重命名，避免中断时检查点文件不完整
+func (checkpoint *Checkpoint) save() error {
+	checkpoint.Updated = time.Now().Format("2006-01-02 15:04:05")
+	content, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpfile := checkpoint.file + ".tmp"
+	if err := ioutil.WriteFile(tmpfile, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, checkpoint.file)
+}
+
+func (checkpoint *Checkpoint) File() string {
+	if checkpoint == nil {
+		return ""
+	}
+	return checkpoint.file
+}
+
+//scan批次乱序完成时，计算可安全记录的cursor
+type ScanProgress struct {
+	cursor  uint64           //最后一个已提交批次之后的cursor
+	seq     int64            //下一个批次序号
+	pending map[int64]uint64 //未完成批次序号与其scan起始cursor
+	sizes   map[int64]int64
+	tallies map[int64]*Coverage //未完成批次的比较计数
+	refs    map[int64]int       //批次本身以及其提交的大key中未完成的数量
+	scanned int64
+	tally   Coverage //已完成批次的比较计数
+	mu      sync.Mutex
+}
+
+func NewScanProgress(cursor uint64, scanned int64) *ScanProgress {
+	return &ScanProgress{
+		cursor:  cursor,
+		pending: make(map[int64]uint64),
+		sizes:   make(map[int64]int64),
+		tallies: make(map[int64]*Coverage),
+		refs:    make(map[int64]int),
+		scanned: scanned,
+	}
+}
+
+//从检查点恢复进度，已完成批次的计数继续累计
+func ResumeScanProgress(state SourceCheckpoint) *ScanProgress {
+	progress := NewScanProgress(state.Cursor, state.Scanned)
+	progress.tally.ComparedKeys = state.Compared
+	progress.tally.DiffKeys = state.Diffs
+	progress.tally.ErrorKeys = state.Errors
+	return progress
+}
+
+//记录一个已提交的批次，start为获取该批次时使用的cursor，next为scan返回的cursor
+func (progress *ScanProgress) Add(start uint64, next uint64, size int) int64 {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	seq := progress.seq
+	progress.seq++
+	progress.pending[seq] = start
+	progress.sizes[seq] = int64(size)
+	progress.tallies[seq] = &Coverage{}
+	progress.refs[seq] = 1
+	progress.cursor = next
+	return seq
+}
+
+//返回批次的比较计数，比较时通过WithScanBatch记录
+func (progress *ScanProgress) Tally(seq int64) *Coverage {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	return progress.tallies[seq]
+}
+
+//批次中的大key交给独立pool比较时增加引用，大key完成后调用Done
+func (progress *ScanProgress) Hold(seq int64) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	progress.refs[seq]++
+}
+
+//批次以及其提交的大key均完成后批次才算完成
+func (progress *ScanProgress) Done(seq int64) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	progress.refs[seq]--
+	if progress.refs[seq] > 0 {
+		return
+	}
+	delete(progress.refs, seq)
+	delete(progress.pending, seq)
+	progress.scanned += progress.sizes[seq]
+	delete(progress.sizes, seq)
+	if tally := progress.tallies[seq]; tally != nil {
+		progress.tally.ComparedKeys += tally.ComparedKeys
+		progress.tally.DiffKeys += tally.DiffKeys
+		progress.tally.ErrorKeys += tally.ErrorKeys
+		delete(progress.tallies, seq)
+	}
+}
+
+//返回最早未完成批次的起始cursor，均已完成时返回最后的cursor
+func (progress *ScanProgress) SafeCursor() (uint64, int64) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	return progress.safeCursor()
+}
+
+func (progress *ScanProgress) safeCursor() (uint64, int64) {
+	minseq := int64(-1)
+	for k := range progress.pending {
+		if minseq < 0 || k < minseq {
+			minseq = k
+		}
+	}
+	if minseq < 0 {
+		return progress.cursor, progress.scanned
+	}
+	return progress.pending[minseq], progress.scanned
+}
+
+//写入可安全记录的cursor以及已完成批次的计数，二者在同一锁内读取保持一致
+func (progress *ScanProgress) Save(state *SourceCheckpoint) {
+	progress.mu.Lock()
+	defer progress.mu.Unlock()
+	cursor, scanned := progress.safeCursor()
+	state.Cursor = cursor
+	state.Scanned = scanned
+	state.Compared = progress.tally.ComparedKeys
+	state.Diffs = progress.tally.DiffKeys
+	state.Errors = progress.tally.ErrorKeys
+}
+
+type scanBatchKey struct{}
+
+//正在比较的scan批次
+type scanBatch struct {
+	progress *ScanProgress
+	seq      int64
+	tally    *Coverage
+}
+
+//批次比较时同时记入批次计数，批次完整比较后才计入检查点
+func WithScanBatch(ctx context.Context, progress *ScanProgress, seq int64) context.Context {
+	return context.WithValue(ctx, scanBatchKey{}, &scanBatch{progress: progress, seq: seq, tally: progress.Tally(seq)})
+}
+
+//返回批次计数，不在批次中比较时返回nil
+func BatchTally(ctx context.Context) *Coverage {
+	if batch, ok := ctx.Value(scanBatchKey{}).(*scanBatch); ok {
+		return batch.tally
+	}
+	return nil
+}
+
+//批次中提交大key时调用，大key完成后通过DoneBatch释放
+func HoldBatch(ctx context.Context) {
+	if batch, ok := ctx.Value(scanBatchKey{}).(*scanBatch); ok {
+		batch.progress.Hold(batch.seq)
+	}
+}
+
+//批次或其提交的大key比较完成
+func DoneBatch(ctx context.Context) {
+	if batch, ok := ctx.Value(scanBatchKey{}).(*scanBatch); ok {
+		batch.progress.Done(batch.seq)
+	}
+}
+
+//读取result文件中已记录的key，恢复时跳过这些key避免重复记录
+func ResultFileKeys(file string) map[string]bool {
+	keys := make(map[string]bool)
+	fi, err := os.Open(file)
+	if err != nil {
+		return keys
+	}
+	defer fi.Close()
+
+	scanner := bufio.NewScanner(fi)
+	for scanner.Scan() {
+		key := gjson.Get(scanner.Text(), "Key").String()
+		if key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
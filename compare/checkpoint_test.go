@@ -0,0 +1,172 @@
+package compare
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanProgressSafeCursor(t *testing.T) {
+	progress := NewScanProgress(0, 0)
+	first := progress.Add(0, 10, 5)
+	second := progress.Add(10, 20, 5)
+	third := progress.Add(20, 0, 5)
+
+	//后提交的批次先完成时不能越过未完成批次
+	progress.Done(second)
+	progress.Done(third)
+	if cursor, scanned := progress.SafeCursor(); cursor != 0 || scanned != 10 {
+		t.Errorf("got cursor %d scanned %d, want 0 10", cursor, scanned)
+	}
+
+	progress.Done(first)
+	if cursor, scanned := progress.SafeCursor(); cursor != 0 || scanned != 15 {
+		t.Errorf("got cursor %d scanned %d, want 0 15", cursor, scanned)
+	}
+
+	progress = NewScanProgress(10, 5)
+	seq := progress.Add(10, 20, 5)
+	progress.Add(20, 30, 5)
+	progress.Done(seq)
+	if cursor, scanned := progress.SafeCursor(); cursor != 20 || scanned != 10 {
+		t.Errorf("got cursor %d scanned %d, want 20 10", cursor, scanned)
+	}
+}
+
+func TestScanProgressTally(t *testing.T) {
+	progress := ResumeScanProgress(SourceCheckpoint{Cursor: 10, Scanned: 5, Compared: 5, Diffs: 2, Errors: 1})
+	first := progress.Add(10, 20, 3)
+	second := progress.Add(20, 0, 2)
+	progress.Tally(first).Compared(3)
+	progress.Tally(first).Diffs(1)
+	progress.Tally(second).Compared(2)
+	progress.Tally(second).Errors(1)
+
+	//未完成批次的计数不写入检查点，恢复时该批次会重新比较
+	progress.Done(second)
+	state := SourceCheckpoint{}
+	progress.Save(&state)
+	if state.Cursor != 10 || state.Scanned != 7 || state.Compared != 7 || state.Diffs != 2 || state.Errors != 2 {
+		t.Errorf("got state %+v", state)
+	}
+
+	progress.Done(first)
+	progress.Save(&state)
+	if state.Cursor != 0 || state.Scanned != 10 || state.Compared != 10 || state.Diffs != 3 || state.Errors != 2 {
+		t.Errorf("got state %+v", state)
+	}
+}
+
+func TestScanProgressHold(t *testing.T) {
+	progress := NewScanProgress(0, 0)
+	seq := progress.Add(0, 10, 5)
+	progress.Hold(seq)
+
+	//批次返回后大key未完成时不推进cursor
+	progress.Done(seq)
+	if cursor, scanned := progress.SafeCursor(); cursor != 0 || scanned != 0 {
+		t.Errorf("got cursor %d scanned %d, want 0 0", cursor, scanned)
+	}
+	progress.Done(seq)
+	if cursor, scanned := progress.SafeCursor(); cursor != 10 || scanned != 5 {
+		t.Errorf("got cursor %d scanned %d, want 10 5", cursor, scanned)
+	}
+}
+
+func TestCompareDBResumeCoverage(t *testing.T) {
+	compare, source, target := newSampleCompare(t)
+	source.Set(0, "h1", fakeHash{"a": "1"})
+	source.Set(0, "h2", fakeHash{"a": "1"})
+	target.Set(0, "h1", fakeHash{"a": "1"})
+	target.Set(0, "h2", fakeHash{"a": "2"})
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	compare.RecordResult = true
+	compare.Checkpoint = NewCheckpoint(filepath.Join(dir, "compare.checkpoint"), "single2single")
+	compare.Checkpoint.Update(compare.CheckpointID(), func(state *SourceCheckpoint) {
+		state.ResultFile = filepath.Join(dir, "compare.result")
+		state.Scanned = 5
+		state.Compared = 5
+		state.Diffs = 2
+		state.Errors = 1
+	})
+
+	//恢复后覆盖范围在检查点的计数上继续累计
+	compare.CompareDB(context.Background())
+	coverage := compare.Coverage
+	if coverage.ScannedKeys != 7 || coverage.ComparedKeys != 7 || coverage.DiffKeys != 3 || coverage.ErrorKeys != 1 || !coverage.ScanFinished {
+		t.Errorf("got coverage %+v", coverage)
+	}
+	state, _ := compare.Checkpoint.State(compare.CheckpointID())
+	if !state.Finished || state.Scanned != 7 || state.Compared != 7 || state.Diffs != 3 || state.Errors != 1 {
+		t.Errorf("got state %+v", state)
+	}
+}
+
+func TestCheckpointSaveAndLoad(t *testing.T) {
+	if NewCheckpoint("", "single2single") != nil {
+		t.Fatal("checkpoint without file should be nil")
+	}
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "compare.checkpoint")
+
+	checkpoint := NewCheckpoint(file, "single2single")
+	id := CheckpointID("127.0.0.1:6379", 0)
+	err = checkpoint.Update(id, func(state *SourceCheckpoint) {
+		state.Cursor = 42
+		state.ResultFile = "a.result"
+		state.Scanned = 100
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCheckpoint(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Scenario != "single2single" || loaded.File() != file {
+		t.Errorf("got scenario %s file %s", loaded.Scenario, loaded.File())
+	}
+	state, ok := loaded.State(id)
+	if !ok || state.Cursor != 42 || state.ResultFile != "a.result" || state.Scanned != 100 || state.Finished {
+		t.Errorf("got state %+v", state)
+	}
+	if _, ok := loaded.State(CheckpointID("127.0.0.1:6379", 1)); ok {
+		t.Error("unexpected state of db 1")
+	}
+
+	var nocheckpoint *Checkpoint
+	if err := nocheckpoint.Update(id, func(state *SourceCheckpoint) {}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestResultFileKeys(t *testing.T) {
+	fi, err := ioutil.TempFile("", "compare*.result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fi.Name())
+	fi.WriteString(`{"Key":"a","IsEqual":false}` + "\n" + `{"Key":"b","IsEqual":false}` + "\n")
+	fi.Close()
+
+	keys := ResultFileKeys(fi.Name())
+	if len(keys) != 2 || !keys["a"] || !keys["b"] {
+		t.Errorf("got keys %v", keys)
+	}
+	if len(ResultFileKeys(fi.Name()+".missing")) != 0 {
+		t.Error("missing result file should have no keys")
+	}
+}
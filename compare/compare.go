@@ -1,9 +1,22 @@
 package compare
 
-import "rediscompare/globalzap"
+import (
+	"context"
+	"rediscompare/globalzap"
+)
 
 var zaplogger = globalzap.GetLogger()
 
+//KeyDiffReason中description的取值
+const (
+	ReasonKeyOnlyInTarget         = "Key only exists in Target"
+	ReasonStreamGroupNotExists    = "Stream consumer group not exists in Target"
+	ReasonStreamGroupOnlyInTarget = "Stream consumer group only exists in Target"
+	ReasonStreamGroupNotEqual     = "Stream consumer group not equal"
+	ReasonStreamPendingNotEqual   = "Stream pending entries not equal"
+	ReasonDiffSummary             = "Key diff summary"
+)
+
 type CompareResult struct {
 	IsEqual       bool
 	Source        interface{}
@@ -11,8 +24,9 @@ type CompareResult struct {
 	KeyDiffReason []interface{}
 	KeyType       string
 	Key           string
-	SourceDB      int //源redis DB number
-	TargetDB      int //目标redis DB number
+	TargetKey     string //key映射后在目标库中的名称
+	SourceDB      int    //源redis DB number
+	TargetDB      int    //目标redis DB number
 }
 
 func NewCompareResult() CompareResult {
@@ -22,11 +36,12 @@ func NewCompareResult() CompareResult {
 }
 
 type CompareData interface {
-	CompareDB()
-	CompareKeys(keys []string)
-	CompareString(key string) *CompareResult
-	CompareList(key string) *CompareResult
-	CompareHash(key string) *CompareResult
-	CompareSet(key string) *CompareResult
-	CompareZset(key string) *CompareResult
+	CompareDB(ctx context.Context)
+	CompareKeys(ctx context.Context, keys []string) error
+	CompareString(ctx context.Context, key string) *CompareResult
+	CompareList(ctx context.Context, key string) *CompareResult
+	CompareHash(ctx context.Context, key string) *CompareResult
+	CompareSet(ctx context.Context, key string) *CompareResult
+	CompareZset(ctx context.Context, key string) *CompareResult
+	CompareStream(ctx context.Context, key string) *CompareResult
 }
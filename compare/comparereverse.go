@@ -0,0 +1,364 @@
+package compare
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v7"
+	"github.com/panjf2000/ants/v2"
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+	"os"
+	"rediscompare/commons"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//反向比较，扫描目标库并找出源库中不存在的key
+type CompareReverse struct {
+	Sources        []*redis.Client      //源redis 列表，cluster2cluster场景下为源集群各节点
+	Target         *redis.Client        //目标redis single，与TargetCluster二选一
+	TargetCluster  *redis.ClusterClient //目标redis cluster
+	RecordResult   bool
+	ResultFile     string
+	BatchSize      int64                 //scan目标库时每批次key的数量
+	CompareThreads int                   //比较db线程数量
+	SourceDB       int                   //源redis DB number，多个源DB时为-1
+	TargetDB       int                   //目标redis DB number
+	Filter         *KeyFilter            //key过滤规则，nil时比较所有key
+	KeyMapper      *KeyMapper            //源key到目标key的映射规则，反向比较时用于还原源key
+	KeyMappers     []*KeyMapper          //与Sources一一对应的映射规则，各源DB带不同前缀时使用，为空时均使用KeyMapper
+	SourceLimit    *RateLimit            //源redis限速规则，nil时不限速
+	TargetLimit    *RateLimit            //目标redis限速规则，nil时不限速
+	Monitor        *HealthMonitor        //源与目标健康监控，nil时不检查
+	Checkpoint     *Checkpoint           `json:"-"` //断点续比检查点，反向比较只记录是否完成，未完成时恢复后重新scan
+	Coverage       Coverage              //比较覆盖范围，统计目标库key
+	Metrics        *SourceMetrics        `json:"-"` //prometheus指标，nil时不统计
+	Recheck        func(key string) bool `json:"-"` //复查时判断key是否仍有复查次数，nil时复查全部key
+}
+
+func (compare *CompareReverse) CompareDB(ctx context.Context) {
+	resultfilestring := "./" + "compare_reverse_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".result"
+	if compare.ResultFile == "" {
+		compare.ResultFile = resultfilestring
+	}
+	if state, ok := compare.Checkpoint.State(compare.CheckpointID()); ok && state.Finished {
+		compare.ResultFile = state.ResultFile
+		compare.Coverage.SetScanFinished(true)
+		zaplogger.Sugar().Info("CompareReverse DB already finished in checkpoint")
+		return
+	}
+	for _, v := range compare.Sources {
+		compare.SourceLimit.Apply(ctx, v)
+	}
+	compare.TargetLimit.Apply(ctx, compare.Target)
+	compare.TargetLimit.Apply(ctx, compare.TargetCluster)
+	if compare.TargetCluster != nil {
+		compare.Coverage.TotalKeys = ClusterDBSize(compare.TargetCluster)
+	} else {
+		compare.Coverage.TotalKeys = compare.Target.DBSize().Val()
+	}
+
+	wg := sync.WaitGroup{}
+	threads := runtime.NumCPU()
+	if compare.CompareThreads > 0 {
+		threads = compare.CompareThreads
+	}
+
+	if compare.BatchSize <= 0 {
+		compare.BatchSize = 10
+	}
+
+	zaplogger.Sugar().Info("CompareReverse DB begin")
+	if !compare.KeyMapper.Reversible() {
+		zaplogger.Sugar().Warn("Regex key mapping rules are not reversible, target keys mapped by them may be reported as only exists in Target")
+	}
+
+	pool, err := ants.NewPool(threads)
+	if err != nil {
+		zaplogger.Sugar().Error(err)
+		return
+	}
+	defer pool.Release()
+	defer compare.Metrics.Pool(0, threads)
+
+	if compare.TargetCluster != nil {
+		err = compare.TargetCluster.ForEachMaster(func(client *redis.Client) error {
+			return compare.scanTarget(ctx, client, pool, &wg)
+		})
+	} else {
+		err = compare.scanTarget(ctx, compare.Target, pool, &wg)
+	}
+	if err != nil && ctx.Err() == nil {
+		zaplogger.Sugar().Error(err)
+	}
+
+	wg.Wait()
+	compare.Coverage.SetScanFinished(err == nil)
+	if err == nil {
+		err = compare.Checkpoint.Update(compare.CheckpointID(), func(state *SourceCheckpoint) {
+			state.ResultFile = compare.ResultFile
+			state.Finished = true
+		})
+		if err != nil {
+			zaplogger.Sugar().Error(err)
+		}
+	}
+	zaplogger.Sugar().Info("CompareReverse End")
+}
+
+//scan目标节点并将key批量提交到pool中比较
+func (compare *CompareReverse) scanTarget(ctx context.Context, client *redis.Client, pool *ants.Pool, wg *sync.WaitGroup) error {
+	cursor := uint64(0)
+	ticker := time.NewTicker(time.Second * 10)
+	defer ticker.Stop()
+
+	for {
+		//收到中断信号时停止scan，等待已提交的批次完成
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		//服务端持续不健康时停止scan
+		if !compare.Monitor.Wait(ctx) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return compare.Monitor.Err()
+		}
+		result, c, err := ScanKeysMatch(client, cursor, compare.BatchSize, compare.scanMatch(), compare.Filter)
+		if err != nil {
+			return err
+		}
+		compare.Coverage.Scanned(len(result))
+		//cluster各master节点的client不经过cluster client的hook，scan单独计入限速
+		if compare.TargetCluster != nil {
+			compare.TargetLimit.Throttle(ctx, 1, argsSize([]interface{}{result}))
+		}
+
+		//当pool有活动worker时提交异步任务
+		for {
+			if pool.Free() > 0 {
+				wg.Add(1)
+				pool.Submit(func() {
+					compare.CompareKeys(ctx, result)
+					wg.Done()
+				})
+				compare.Metrics.Pool(pool.Running(), pool.Cap())
+				break
+			}
+		}
+		cursor = c
+
+		if c == 0 {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+			zaplogger.Sugar().Info("Reverse comparing " + client.Options().Addr + "...")
+		default:
+			continue
+		}
+	}
+	return nil
+}
+
+func (compare *CompareReverse) CompareKeysFromResultFile(ctx context.Context, filespath []string) error {
+	//比较已中止时保留上一轮result文件
+	if compare.Monitor.Aborted() {
+		return compare.Monitor.Err()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	previous := compare.ResultFile
+	resultfilestring := "./" + "compare_reverse_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".result"
+	compare.ResultFile = resultfilestring
+
+	for _, v := range filespath {
+		fi, err := os.Open(v)
+		if err != nil {
+			return err
+		}
+		defer fi.Close()
+
+		scanner := bufio.NewScanner(fi)
+		for scanner.Scan() {
+			line := scanner.Text()
+			key := gjson.Get(line, "TargetKey").String()
+			if key == "" {
+				key = gjson.Get(line, "Key").String()
+			}
+			//用完复查次数的key不再比较，原样保留到新的result文件
+			if key != "" && compare.Recheck != nil && !compare.Recheck(gjson.Get(line, "Key").String()) {
+				commons.AppendLineToFile(bytes.NewBufferString(line), compare.ResultFile)
+				continue
+			}
+			if key != "" {
+				if err := compare.CompareKeys(ctx, []string{key}); err != nil {
+					//本轮被中断时报告使用上一轮完整的result文件
+					compare.ResultFile = previous
+					return err
+				}
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	err := compare.Checkpoint.Update(compare.CheckpointID(), func(state *SourceCheckpoint) {
+		state.Rounds++
+		state.ResultFile = compare.ResultFile
+	})
+	if err != nil {
+		zaplogger.Sugar().Error(err)
+	}
+	return nil
+}
+
+//判断目标库中的key在所有源库中均不存在，被中断或中止时返回错误
+func (compare *CompareReverse) CompareKeys(ctx context.Context, keys []string) error {
+	for _, v := range keys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !compare.Monitor.Wait(ctx) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return compare.Monitor.Err()
+		}
+		compare.Coverage.Compared(1)
+		compare.Metrics.Compared()
+		//源查询失败时不能判定为多余key，计为错误
+		sourcekey, matched, exists, err := compare.existsInSources(v)
+		if err != nil {
+			zaplogger.Sugar().Error(err)
+			compare.Coverage.Errors(1)
+			compare.Metrics.Error()
+			continue
+		}
+		if !matched || exists {
+			continue
+		}
+
+		//key可能在scan后过期或被删除，再次确认目标库中仍存在
+		keytype, err := compare.targetType(v)
+		if err != nil {
+			zaplogger.Sugar().Error(err)
+			compare.Coverage.Errors(1)
+			compare.Metrics.Error()
+			continue
+		}
+		if keytype == "none" || !compare.Filter.MatchType(keytype) {
+			continue
+		}
+
+		result := compare.KeyOnlyInTarget(sourcekey, v, keytype)
+		compare.Coverage.Diffs(1)
+		compare.Metrics.Diff(result)
+		zaplogger.Info("", zap.Any("CompareResult", result))
+		if compare.RecordResult {
+			jsonBytes, _ := json.Marshal(result)
+			commons.AppendLineToFile(bytes.NewBuffer(jsonBytes), compare.ResultFile)
+		}
+	}
+	return nil
+}
+
+func (compare *CompareReverse) KeyOnlyInTarget(key string, targetkey string, keytype string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Key = key
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = keytype
+	compareresult.Source = compare.SourceAddrs()
+	compareresult.Target = compare.TargetAddrs()
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+
+	compareresult.IsEqual = false
+	reason["description"] = ReasonKeyOnlyInTarget
+	reason["source"] = false
+	reason["target"] = true
+	compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+	return &compareresult
+}
+
+//按各源的映射规则还原源key并判断是否存在，matched为false表示key不属于任何源或被过滤，查询源失败时返回错误
+func (compare *CompareReverse) existsInSources(targetkey string) (sourcekey string, matched bool, exists bool, err error) {
+	sourcekey = compare.KeyMapper.Reverse(targetkey)
+	for k, v := range compare.Sources {
+		mapper := compare.sourceKeyMapper(k)
+		if !mapper.HasDBPrefix(targetkey) {
+			continue
+		}
+		key := mapper.Reverse(targetkey)
+		if !compare.Filter.MatchKey(key) {
+			continue
+		}
+		sourcekey = key
+		matched = true
+		n, err := v.Exists(key).Result()
+		if err != nil {
+			return sourcekey, true, false, err
+		}
+		if n == 1 {
+			return sourcekey, true, true, nil
+		}
+	}
+	return sourcekey, matched, false, nil
+}
+
+//包含规则针对源key，有key映射时目标key不一定匹配，scan全部key后由existsInSources按还原的源key过滤
+func (compare *CompareReverse) scanMatch() string {
+	if compare.KeyMapper != nil || len(compare.KeyMappers) > 0 {
+		return "*"
+	}
+	return compare.Filter.ScanMatch()
+}
+
+func (compare *CompareReverse) sourceKeyMapper(index int) *KeyMapper {
+	if index < len(compare.KeyMappers) {
+		return compare.KeyMappers[index]
+	}
+	return compare.KeyMapper
+}
+
+func (compare *CompareReverse) targetType(key string) (string, error) {
+	if compare.TargetCluster != nil {
+		return compare.TargetCluster.Type(key).Result()
+	}
+	return compare.Target.Type(key).Result()
+}
+
+func (compare *CompareReverse) CheckpointID() string {
+	return "reverse:" + CheckpointID(strings.Join(compare.TargetAddrs(), ","), compare.TargetDB)
+}
+
+//返回检查点中已完成的复查轮次
+func (compare *CompareReverse) RecheckRounds() int {
+	state, _ := compare.Checkpoint.State(compare.CheckpointID())
+	return state.Rounds
+}
+
+func (compare *CompareReverse) SourceAddrs() []string {
+	var addrs []string
+	for _, v := range compare.Sources {
+		addrs = append(addrs, v.Options().Addr)
+	}
+	return addrs
+}
+
+func (compare *CompareReverse) TargetAddrs() []string {
+	if compare.TargetCluster != nil {
+		return compare.TargetCluster.Options().Addrs
+	}
+	return []string{compare.Target.Options().Addr}
+}
@@ -0,0 +1,187 @@
+package compare
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/tidwall/gjson"
+)
+
+//读取result文件中的各行
+func readResultLines(t *testing.T, file string) []string {
+	fi, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	var lines []string
+	scanner := bufio.NewScanner(fi)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func tempResultFile(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "reverse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "compare_reverse.result")
+}
+
+func TestCompareReverseKeyMapping(t *testing.T) {
+	server := newFakeRedis(t)
+	server.Set(0, "user:1", "a")
+	server.Set(1, "u:1", "a")
+	server.Set(1, "u:2", "b")
+	server.Set(1, "order:1", "c")
+
+	mapper, err := NewKeyMapper([]PrefixRule{{From: "user:", To: "u:"}}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverse := &CompareReverse{
+		Sources:      []*redis.Client{server.Client(0)},
+		Target:       server.Client(1),
+		RecordResult: true,
+		ResultFile:   tempResultFile(t),
+		SourceDB:     0,
+		TargetDB:     1,
+		KeyMapper:    mapper,
+	}
+	if err := reverse.CompareKeys(context.Background(), []string{"u:1", "u:2", "order:1", "u:3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//u:1还原为user:1存在于源库，u:3在scan后被删除
+	lines := readResultLines(t, reverse.ResultFile)
+	if len(lines) != 2 {
+		t.Fatalf("got %d result lines, want 2: %v", len(lines), lines)
+	}
+	want := map[string]string{"user:2": "u:2", "order:1": "order:1"}
+	for _, v := range lines {
+		key := gjson.Get(v, "Key").String()
+		if want[key] != gjson.Get(v, "TargetKey").String() {
+			t.Errorf("unexpected result %s", v)
+		}
+		if gjson.Get(v, "KeyDiffReason.0.description").String() != ReasonKeyOnlyInTarget || gjson.Get(v, "SourceDB").Int() != 0 || gjson.Get(v, "TargetDB").Int() != 1 {
+			t.Errorf("unexpected result %s", v)
+		}
+	}
+	if reverse.Coverage.DiffKeys != 2 || reverse.Coverage.ComparedKeys != 4 {
+		t.Errorf("got coverage %+v", reverse.Coverage)
+	}
+}
+
+func TestCompareReverseMultiSource(t *testing.T) {
+	server := newFakeRedis(t)
+	//db1、db2以不同前缀合并到目标db0
+	server.Set(1, "a", "1")
+	server.Set(2, "b", "2")
+	server.Set(0, "db1:a", "1")
+	server.Set(0, "db2:a", "1")
+	server.Set(0, "db2:b", "2")
+	server.Set(0, "other", "3")
+
+	var mapper *KeyMapper
+	reverse := &CompareReverse{
+		Sources:      []*redis.Client{server.Client(1), server.Client(2)},
+		Target:       server.Client(0),
+		RecordResult: true,
+		ResultFile:   tempResultFile(t),
+		SourceDB:     -1,
+		TargetDB:     0,
+		KeyMapper:    mapper,
+		KeyMappers:   []*KeyMapper{mapper.WithDBPrefix("db1:"), mapper.WithDBPrefix("db2:")},
+	}
+	if err := reverse.CompareKeys(context.Background(), []string{"db1:a", "db2:a", "db2:b", "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//db2:a只按db2的前缀还原，不因db1中存在a而视为一致；other不属于任何源DB
+	lines := readResultLines(t, reverse.ResultFile)
+	if len(lines) != 1 {
+		t.Fatalf("got %d result lines, want 1: %v", len(lines), lines)
+	}
+	line := lines[0]
+	if gjson.Get(line, "Key").String() != "a" || gjson.Get(line, "TargetKey").String() != "db2:a" || gjson.Get(line, "SourceDB").Int() != -1 {
+		t.Errorf("unexpected result %s", line)
+	}
+	if sources := gjson.Get(line, "Source").Array(); len(sources) != 2 {
+		t.Errorf("got sources %v, want both source DBs", sources)
+	}
+}
+
+func TestCompareReverseSourceError(t *testing.T) {
+	source := newFakeRedis(t)
+	target := newFakeRedis(t)
+	target.Set(0, "a", "1")
+	source.Fail("exists", "ERR busy")
+
+	reverse := &CompareReverse{
+		Sources:      []*redis.Client{source.Client(0)},
+		Target:       target.Client(0),
+		RecordResult: true,
+		ResultFile:   tempResultFile(t),
+	}
+	if err := reverse.CompareKeys(context.Background(), []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//源查询失败时不能作为只存在于目标库的key记录
+	if lines := readResultLines(t, reverse.ResultFile); len(lines) != 0 {
+		t.Errorf("source error should not be recorded as diff, got %v", lines)
+	}
+	if reverse.Coverage.ErrorKeys != 1 || reverse.Coverage.DiffKeys != 0 {
+		t.Errorf("got coverage %+v", reverse.Coverage)
+	}
+}
+
+func TestCompareReverseIncludeWithKeyMapping(t *testing.T) {
+	server := newFakeRedis(t)
+	server.Set(0, "user:1", "a")
+	server.Set(1, "u:1", "a")
+	server.Set(1, "u:2", "b")
+	server.Set(1, "order:1", "c")
+
+	mapper, err := NewKeyMapper([]PrefixRule{{From: "user:", To: "u:"}}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := NewKeyFilter([]string{"user:*"}, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverse := &CompareReverse{
+		Sources:      []*redis.Client{server.Client(0)},
+		Target:       server.Client(1),
+		RecordResult: true,
+		ResultFile:   tempResultFile(t),
+		TargetDB:     1,
+		Filter:       filter,
+		KeyMapper:    mapper,
+	}
+	reverse.CompareDB(context.Background())
+
+	//源key的包含规则不能作为目标库的SCAN MATCH，u:2还原为user:2后匹配
+	lines := readResultLines(t, reverse.ResultFile)
+	if len(lines) != 1 || gjson.Get(lines[0], "Key").String() != "user:2" || gjson.Get(lines[0], "TargetKey").String() != "u:2" {
+		t.Errorf("got result lines %v", lines)
+	}
+	if n := countCalls(server, "1 scan"); n != 1 {
+		t.Errorf("got %d SCAN, want 1", n)
+	}
+	if reverse.Coverage.ScannedKeys != 3 || !reverse.Coverage.ScanFinished {
+		t.Errorf("got coverage %+v", reverse.Coverage)
+	}
+}
@@ -3,7 +3,9 @@ package compare
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/go-redis/redis/v7"
 	"github.com/panjf2000/ants/v2"
 	"github.com/tidwall/gjson"
@@ -11,6 +13,7 @@ import (
 	"math"
 	"os"
 	"rediscompare/commons"
+	"reflect"
 	"runtime"
 	"strconv"
 	"sync"
@@ -18,29 +21,77 @@ import (
 )
 
 type CompareSingle2Cluster struct {
-	Source         *redis.Client        //源redis single
-	Target         *redis.ClusterClient //目标redis single
-	RecordResult   bool
-	ResultFile     string
-	BatchSize      int64   //比较List、Set、Zset类型时的每批次值的数量
-	CompareThreads int     //比较db线程数量
-	TTLDiff        float64 //TTL最小差值
-	SourceDB       int     //源redis DB number
-	TargetDB       int     //目标redis DB number
-}
-
-func (compare *CompareSingle2Cluster) CompareDB() {
+	Source                *redis.Client        //源redis single
+	Target                *redis.ClusterClient //目标redis single
+	RecordResult          bool
+	ResultFile            string
+	BatchSize             int64                       //比较List、Set、Zset类型时的每批次值的数量
+	CompareThreads        int                         //比较db线程数量
+	TTLDiff               float64                     //TTL最小差值
+	SourceDB              int                         //源redis DB number
+	TargetDB              int                         //目标redis DB number
+	StreamGroups          bool                        //是否比较stream consumer group以及pending entries
+	FullDiff              bool                        //是否记录hash、set、zset、list中的所有差异元素
+	MaxDiffPerKey         int                         //全量差异模式下单个key记录差异的上限
+	Digest                bool                        //是否先比较key摘要，摘要不一致时再逐元素比较
+	Filter                *KeyFilter                  //key过滤规则，nil时比较所有key
+	KeyMapper             *KeyMapper                  //源key到目标key的映射规则，nil时目标key与源key相同
+	Sampler               *Sampler                    //抽样比较规则，nil时比较所有key
+	MemberSampleThreshold int64                       //set、hash、zset元素数量超过该值时只比较长度以及随机抽取的元素，0表示不抽样
+	MemberSampleSize      int64                       //随机抽取的元素数量，默认100
+	SourceLimit           *RateLimit                  //源redis限速规则，nil时不限速
+	TargetLimit           *RateLimit                  //目标redis限速规则，nil时不限速
+	Monitor               *HealthMonitor              //源与目标健康监控，nil时不检查
+	Checkpoint            *Checkpoint                 `json:"-"` //断点续比检查点，nil时不记录
+	Coverage              Coverage                    //比较覆盖范围
+	Metrics               *SourceMetrics              `json:"-"` //prometheus指标，nil时不统计
+	OnDiff                func(result *CompareResult) `json:"-"` //差异回调，nil时不调用
+	Recheck               func(key string) bool       `json:"-"` //复查时判断key是否仍有复查次数，nil时复查全部key
+	BigKeys               *BigKeys                    `json:"-"` //大key检测以及独立比较pool，nil时不检测
+	StringChunkSize       int64                       //string value分段比较时每次读取的字节数，默认1MB
+	StringHash            bool                        //长度一致的大string先比较服务端sha1
+	Tolerance             *Tolerance                  //zset score以及数字value的比较容差，nil时要求完全一致
+	Normalizers           *Normalizers                //按key匹配的string以及hash field value规范化规则，nil时不规范化
+	Rules                 *EqualRules                 //按key匹配的自定义相等规则，nil时不生效
+	digester              KeyDigester
+	skipKeys              map[string]bool //恢复时result文件中已记录的key
+	bigKeysPending        sync.WaitGroup  //已提交尚未完成的大key
+}
+
+func (compare *CompareSingle2Cluster) CompareDB(ctx context.Context) {
 	resultfilestring := "./" + "compare_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".result"
 	if compare.ResultFile == "" {
 		compare.ResultFile = resultfilestring
 	}
 
+	//从检查点恢复result文件以及scan cursor，已记录差异的key不再重复比较
+	state, resumed := compare.Checkpoint.State(compare.CheckpointID())
+	if resumed {
+		compare.ResultFile = state.ResultFile
+		//覆盖范围从检查点中已完成批次的计数继续累计
+		compare.Coverage.Resume(state)
+		if state.Finished {
+			compare.Coverage.SetScanFinished(true)
+			zaplogger.Sugar().Info("CompareSingle2Cluster DB already finished in checkpoint")
+			return
+		}
+		compare.skipKeys = ResultFileKeys(compare.ResultFile)
+		defer func() {
+			compare.skipKeys = nil
+		}()
+	}
+	compare.SourceLimit.Apply(ctx, compare.Source)
+	compare.TargetLimit.Apply(ctx, compare.Target)
+	compare.Coverage.TotalKeys = compare.Source.DBSize().Val()
+
 	wg := sync.WaitGroup{}
 	threads := runtime.NumCPU()
 	if compare.CompareThreads > 0 {
 		threads = compare.CompareThreads
 	}
-	cursor := uint64(0)
+	cursor := state.Cursor
+	progress := ResumeScanProgress(state)
+	finished := false
 	zaplogger.Sugar().Info("CompareSingle2Cluster DB beging")
 	ticker := time.NewTicker(time.Second * 20)
 	defer ticker.Stop()
@@ -52,45 +103,119 @@ func (compare *CompareSingle2Cluster) CompareDB() {
 		return
 	}
 	defer pool.Release()
+	defer compare.Metrics.Pool(0, threads)
+
+	//固定数量抽样时通过RANDOMKEY获取key，不再scan全库
+	if compare.Sampler.UseRandomKey() {
+		batches, err := compare.Sampler.RandomKeyBatches(compare.Source, compare.Filter, compare.BatchSize)
+		if err != nil {
+			zaplogger.Sugar().Error(err)
+			return
+		}
+		for _, v := range batches {
+			if ctx.Err() != nil {
+				break
+			}
+			if !compare.Monitor.Wait(ctx) {
+				zaplogger.Sugar().Error(compare.Monitor.Err())
+				break
+			}
+			keys := v
+			compare.Coverage.Scanned(len(keys))
+			for {
+				if pool.Free() > 0 {
+					wg.Add(1)
+					pool.Submit(func() {
+						compare.CompareKeys(ctx, keys)
+						wg.Done()
+					})
+					compare.Metrics.Pool(pool.Running(), pool.Cap())
+					break
+				}
+			}
+		}
+		wg.Wait()
+		compare.bigKeysPending.Wait()
+		compare.Coverage.SetScanFinished(ctx.Err() == nil && !compare.Monitor.Aborted())
+		compare.saveCheckpoint(progress, compare.Coverage.ScanFinished)
+		zaplogger.Sugar().Info("CompareSingle2Cluster sample End")
+		return
+	}
 
 	for {
-		result, c, err := compare.Source.Scan(cursor, "*", compare.BatchSize).Result()
+		//收到中断信号时停止scan，等待已提交的批次完成
+		if ctx.Err() != nil {
+			zaplogger.Sugar().Info("Compare interrupted, waiting for running workers")
+			break
+		}
+		//服务端持续不健康时停止scan
+		if !compare.Monitor.Wait(ctx) {
+			zaplogger.Sugar().Error(compare.Monitor.Err())
+			break
+		}
+		result, c, err := ScanKeys(compare.Source, cursor, compare.BatchSize, compare.Filter)
 
 		if err != nil {
 			zaplogger.Sugar().Info(result, c, err)
 			return
 		}
+		result = compare.Sampler.Pick(result)
+
+		seq := progress.Add(cursor, c, len(result))
+		compare.Coverage.Scanned(len(result))
 
 		//当pool有活动worker时提交异步任务
 		for {
 			if pool.Free() > 0 {
 				wg.Add(1)
 				pool.Submit(func() {
-					compare.CompareKeys(result)
+					//批次未完整比较时不推进检查点，批次中的大key完成后由bigKeyDone标记
+					batchctx := WithScanBatch(ctx, progress, seq)
+					if compare.CompareKeys(batchctx, result) == nil {
+						DoneBatch(batchctx)
+					}
 					wg.Done()
 				})
+				compare.Metrics.Pool(pool.Running(), pool.Cap())
 				break
 			}
 		}
 		cursor = c
 
 		if c == 0 {
+			finished = true
 			break
 		}
 		select {
 		case <-ticker.C:
 			zaplogger.Sugar().Info("Comparing...")
+			compare.saveCheckpoint(progress, false)
 		default:
 			continue
 		}
 	}
 	wg.Wait()
+	//大key在独立pool中比较，全部完成后再保存最终检查点
+	compare.bigKeysPending.Wait()
+	compare.Coverage.SetScanFinished(finished)
+	compare.saveCheckpoint(progress, finished)
 	zaplogger.Sugar().Info("CompareSingle2Cluster End")
 }
 
-func (compare *CompareSingle2Cluster) CompareKeysFromResultFile(filespath []string) error {
+func (compare *CompareSingle2Cluster) CompareKeysFromResultFile(ctx context.Context, filespath []string) error {
+	//比较已中止时保留上一轮result文件
+	if compare.Monitor.Aborted() {
+		return compare.Monitor.Err()
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	previous := compare.ResultFile
 	resultfilestring := "./" + "compare_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".result"
 	compare.ResultFile = resultfilestring
+	compare.Sampler.NewRound()
+	compare.SourceLimit.Apply(ctx, compare.Source)
+	compare.TargetLimit.Apply(ctx, compare.Target)
 
 	for _, v := range filespath {
 		fi, err := os.Open(v)
@@ -105,8 +230,18 @@ func (compare *CompareSingle2Cluster) CompareKeysFromResultFile(filespath []stri
 
 			key := gjson.Get(line, "Key").String()
 
+			//用完复查次数的key不再比较，原样保留到新的result文件
+			if key != "" && compare.Recheck != nil && !compare.Recheck(key) {
+				commons.AppendLineToFile(bytes.NewBufferString(line), compare.ResultFile)
+				continue
+			}
 			if key != "" {
-				compare.CompareKeys([]string{key})
+				if err := compare.CompareKeys(ctx, []string{key}); err != nil {
+					//本轮被中断时报告使用上一轮完整的result文件
+					compare.bigKeysPending.Wait()
+					compare.ResultFile = previous
+					return err
+				}
 			}
 		}
 
@@ -114,44 +249,132 @@ func (compare *CompareSingle2Cluster) CompareKeysFromResultFile(filespath []stri
 			return err
 		}
 	}
+
+	compare.bigKeysPending.Wait()
+	//记录已完成的复查轮次，恢复时从最后一轮的result文件继续
+	err := compare.Checkpoint.Update(compare.CheckpointID(), func(state *SourceCheckpoint) {
+		state.Rounds++
+		state.ResultFile = compare.ResultFile
+	})
+	if err != nil {
+		zaplogger.Sugar().Error(err)
+	}
 	return nil
 }
 
-func (compare *CompareSingle2Cluster) CompareKeys(keys []string) {
-	var result *CompareResult
+//比较一批key，被中断或中止时返回错误，此时正在比较的key不记录结果
+//大key提交到独立pool后立即返回，由调用方等待bigKeysPending
+func (compare *CompareSingle2Cluster) CompareKeys(ctx context.Context, keys []string) error {
 	for _, v := range keys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !compare.Monitor.Wait(ctx) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return compare.Monitor.Err()
+		}
+		//result文件中已记录的差异key，未计入检查点的批次需重新计数
+		if compare.skipKeys[v] {
+			compare.Coverage.Compared(1)
+			compare.Coverage.Diffs(1)
+			BatchTally(ctx).Compared(1)
+			BatchTally(ctx).Diffs(1)
+			continue
+		}
+		if !compare.Filter.MatchKey(v) {
+			continue
+		}
 		keytype, err := compare.Source.Type(v).Result()
 		if err != nil {
 			zaplogger.Sugar().Error(err)
+			compare.Coverage.Errors(1)
+			BatchTally(ctx).Errors(1)
+			compare.Metrics.Error()
 			continue
 		}
-		result = nil
-		switch {
-		case keytype == "string":
-			result = compare.CompareString(v)
-		case keytype == "list":
-			result = compare.CompareList(v)
-		case keytype == "set":
-			result = compare.CompareSet(v)
-		case keytype == "zset":
-			result = compare.CompareZset(v)
-		case keytype == "hash":
-			result = compare.CompareHash(v)
-		default:
-			zaplogger.Info("No type find in compare list", zap.String("key", v), zap.String("type", keytype))
+		if !compare.Filter.MatchType(keytype) {
+			continue
 		}
-
-		if result != nil && !result.IsEqual {
-			zaplogger.Info("", zap.Any("CompareResult", result))
-			if compare.RecordResult {
-				jsonBytes, _ := json.Marshal(result)
-				commons.AppendLineToFile(bytes.NewBuffer(jsonBytes), compare.ResultFile)
+		//大key交给独立的有界pool比较，避免长时间占用普通比较worker
+		if record, big := compare.BigKeys.Detect(compare.Source, v, keytype); big {
+			HoldBatch(ctx)
+			if err := compare.BigKeys.Submit(ctx, &compare.bigKeysPending, record, compare.compareKey, compare.bigKeyDone); err == nil {
+				continue
 			}
+			DoneBatch(ctx)
+		}
+		result := compare.compareKey(ctx, v, keytype)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		compare.record(ctx, result)
+	}
+	return ctx.Err()
+}
+
+//按类型比较单个key
+func (compare *CompareSingle2Cluster) compareKey(ctx context.Context, key, keytype string) *CompareResult {
+	var result *CompareResult
+	switch {
+	case keytype == "string":
+		result = compare.CompareString(ctx, key)
+	case keytype == "list":
+		result = compare.CompareList(ctx, key)
+	case keytype == "set":
+		result = compare.CompareSet(ctx, key)
+	case keytype == "zset":
+		result = compare.CompareZset(ctx, key)
+	case keytype == "hash":
+		result = compare.CompareHash(ctx, key)
+	case keytype == "stream":
+		result = compare.CompareStream(ctx, key)
+	default:
+		zaplogger.Info("No type find in compare list", zap.String("key", key), zap.String("type", keytype))
+	}
+	return result
+}
+
+//统计比较结果并记录差异
+func (compare *CompareSingle2Cluster) record(ctx context.Context, result *CompareResult) {
+	compare.Coverage.Compared(1)
+	BatchTally(ctx).Compared(1)
+	compare.Metrics.Compared()
+
+	if result != nil {
+		compare.Sampler.Record(result.IsEqual)
+	}
+
+	if result != nil && !result.IsEqual {
+		compare.Coverage.Diffs(1)
+		BatchTally(ctx).Diffs(1)
+		compare.Metrics.Diff(result)
+		if compare.OnDiff != nil {
+			compare.OnDiff(result)
+		}
+		zaplogger.Info("", zap.Any("CompareResult", result))
+		if compare.RecordResult {
+			jsonBytes, _ := json.Marshal(result)
+			commons.AppendLineToFile(bytes.NewBuffer(jsonBytes), compare.ResultFile)
 		}
 	}
 }
 
-func (compare *CompareSingle2Cluster) CompareString(key string) *CompareResult {
+//大key比较完成或超时后的回调
+func (compare *CompareSingle2Cluster) bigKeyDone(ctx context.Context, key string, result *CompareResult, err error) {
+	defer DoneBatch(ctx)
+	if err != nil {
+		zaplogger.Sugar().Errorw("Big key compare timeout", "key", key, "timeout", compare.BigKeys.Policy.Timeout.String())
+		compare.Coverage.Errors(1)
+		BatchTally(ctx).Errors(1)
+		compare.Metrics.Error()
+		return
+	}
+	compare.record(ctx, result)
+}
+
+func (compare *CompareSingle2Cluster) CompareString(ctx context.Context, key string) *CompareResult {
 
 	//比较key的存在状态是否一致
 	result := compare.KeyExistsStatusEqual(key)
@@ -160,7 +383,7 @@ func (compare *CompareSingle2Cluster) CompareString(key string) *CompareResult {
 	}
 
 	//比较string value是否一致
-	result = compare.CompareStringVal(key)
+	result = compare.CompareStringVal(ctx, key)
 	if !result.IsEqual {
 		return result
 	}
@@ -180,7 +403,7 @@ func (compare *CompareSingle2Cluster) CompareString(key string) *CompareResult {
 	return &compareresult
 }
 
-func (compare *CompareSingle2Cluster) CompareList(key string) *CompareResult {
+func (compare *CompareSingle2Cluster) CompareList(ctx context.Context, key string) *CompareResult {
 
 	result := compare.KeyExistsStatusEqual(key)
 	if !result.IsEqual {
@@ -189,7 +412,11 @@ func (compare *CompareSingle2Cluster) CompareList(key string) *CompareResult {
 
 	result = compare.CompareListLen(key)
 	if !result.IsEqual {
-		return result
+		//全量差异模式下长度不一致时继续比较元素
+		if !compare.FullDiff {
+			return result
+		}
+		return MergeCompareResult(result, compare.CompareListIndexVal(ctx, key))
 	}
 
 	result = compare.DiffTTLOver(key)
@@ -197,9 +424,12 @@ func (compare *CompareSingle2Cluster) CompareList(key string) *CompareResult {
 		return result
 	}
 
-	result = compare.CompareListIndexVal(key)
-	if !result.IsEqual {
-		return result
+	//digest一致时跳过逐元素比较
+	if !compare.DigestEqual(ctx, key) {
+		result = compare.CompareListIndexVal(ctx, key)
+		if !result.IsEqual {
+			return result
+		}
 	}
 
 	compareresult := NewCompareResult()
@@ -211,21 +441,38 @@ func (compare *CompareSingle2Cluster) CompareList(key string) *CompareResult {
 
 }
 
-func (compare *CompareSingle2Cluster) CompareHash(key string) *CompareResult {
+func (compare *CompareSingle2Cluster) CompareHash(ctx context.Context, key string) *CompareResult {
 
 	result := compare.KeyExistsStatusEqual(key)
 	if !result.IsEqual {
 		return result
 	}
 
+	//规则忽略部分field或member时长度与digest不再可比，直接逐元素比较
+	if compare.Rules.HasIgnore(key) {
+		return compare.CompareHashFieldVal(ctx, key)
+	}
+
 	result = compare.CompareHashLen(key)
 	if !result.IsEqual {
-		return result
+		//全量差异模式下长度不一致时继续比较元素
+		if !compare.FullDiff {
+			return result
+		}
+		return MergeCompareResult(result, compare.CompareHashFieldVal(ctx, key))
 	}
 
-	result = compare.CompareHashFieldVal(key)
-	if !result.IsEqual {
-		return result
+	//元素数量超过阈值时只比较随机抽取的元素，否则digest一致时跳过逐元素比较
+	if compare.UseMemberSample(compare.Source.HLen(key).Val()) {
+		result = compare.CompareHashSampledField(ctx, key)
+		if !result.IsEqual {
+			return result
+		}
+	} else if !compare.DigestEqual(ctx, key) {
+		result = compare.CompareHashFieldVal(ctx, key)
+		if !result.IsEqual {
+			return result
+		}
 	}
 
 	compareresult := NewCompareResult()
@@ -236,16 +483,29 @@ func (compare *CompareSingle2Cluster) CompareHash(key string) *CompareResult {
 	return &compareresult
 }
 
-func (compare *CompareSingle2Cluster) CompareSet(key string) *CompareResult {
+func (compare *CompareSingle2Cluster) CompareSet(ctx context.Context, key string) *CompareResult {
 
 	result := compare.KeyExistsStatusEqual(key)
 	if !result.IsEqual {
 		return result
 	}
 
+	//规则忽略部分field或member时长度与digest不再可比，直接逐元素比较
+	if compare.Rules.HasIgnore(key) {
+		result = compare.DiffTTLOver(key)
+		if !result.IsEqual {
+			return result
+		}
+		return compare.CompareSetMember(ctx, key)
+	}
+
 	result = compare.CompareSetLen(key)
 	if !result.IsEqual {
-		return result
+		//全量差异模式下长度不一致时继续比较元素
+		if !compare.FullDiff {
+			return result
+		}
+		return MergeCompareResult(result, compare.CompareSetMember(ctx, key))
 	}
 
 	result = compare.DiffTTLOver(key)
@@ -253,9 +513,17 @@ func (compare *CompareSingle2Cluster) CompareSet(key string) *CompareResult {
 		return result
 	}
 
-	result = compare.CompareSetMember(key)
-	if !result.IsEqual {
-		return result
+	//元素数量超过阈值时只比较随机抽取的元素，否则digest一致时跳过逐元素比较
+	if compare.UseMemberSample(compare.Source.SCard(key).Val()) {
+		result = compare.CompareSetSampledMember(ctx, key)
+		if !result.IsEqual {
+			return result
+		}
+	} else if !compare.DigestEqual(ctx, key) {
+		result = compare.CompareSetMember(ctx, key)
+		if !result.IsEqual {
+			return result
+		}
 	}
 
 	compareresult := NewCompareResult()
@@ -266,13 +534,64 @@ func (compare *CompareSingle2Cluster) CompareSet(key string) *CompareResult {
 	return &compareresult
 }
 
-func (compare *CompareSingle2Cluster) CompareZset(key string) *CompareResult {
+func (compare *CompareSingle2Cluster) CompareZset(ctx context.Context, key string) *CompareResult {
 	result := compare.KeyExistsStatusEqual(key)
 	if !result.IsEqual {
 		return result
 	}
 
+	//规则忽略部分field或member时长度与digest不再可比，直接逐元素比较
+	if compare.Rules.HasIgnore(key) {
+		result = compare.DiffTTLOver(key)
+		if !result.IsEqual {
+			return result
+		}
+		return compare.CompareZsetMemberScore(ctx, key)
+	}
+
 	result = compare.CompareZsetLen(key)
+	if !result.IsEqual {
+		//全量差异模式下长度不一致时继续比较元素
+		if !compare.FullDiff {
+			return result
+		}
+		return MergeCompareResult(result, compare.CompareZsetMemberScore(ctx, key))
+	}
+
+	result = compare.DiffTTLOver(key)
+	if !result.IsEqual {
+		return result
+	}
+
+	//元素数量超过阈值时只比较随机抽取的元素，否则digest一致时跳过逐元素比较
+	if compare.UseMemberSample(compare.Source.ZCard(key).Val()) {
+		result = compare.CompareZsetSampledMember(ctx, key)
+		if !result.IsEqual {
+			return result
+		}
+	} else if !compare.DigestEqual(ctx, key) {
+		result = compare.CompareZsetMemberScore(ctx, key)
+		if !result.IsEqual {
+			return result
+		}
+	}
+
+	compareresult := NewCompareResult()
+	compareresult.Key = key
+	compareresult.KeyType = "zset"
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+	return &compareresult
+}
+
+func (compare *CompareSingle2Cluster) CompareStream(ctx context.Context, key string) *CompareResult {
+
+	result := compare.KeyExistsStatusEqual(key)
+	if !result.IsEqual {
+		return result
+	}
+
+	result = compare.CompareStreamLen(key)
 	if !result.IsEqual {
 		return result
 	}
@@ -282,150 +601,493 @@ func (compare *CompareSingle2Cluster) CompareZset(key string) *CompareResult {
 		return result
 	}
 
-	result = compare.CompareZsetMemberScore(key)
+	result = compare.CompareStreamLastID(key)
+	if !result.IsEqual {
+		return result
+	}
+
+	result = compare.CompareStreamEntries(ctx, key)
 	if !result.IsEqual {
 		return result
 	}
 
+	//可选校验consumer group以及pending entries
+	if compare.StreamGroups {
+		result = compare.CompareStreamGroups(key)
+		if !result.IsEqual {
+			return result
+		}
+
+		result = compare.CompareStreamPending(key)
+		if !result.IsEqual {
+			return result
+		}
+	}
+
 	compareresult := NewCompareResult()
 	compareresult.Key = key
-	compareresult.KeyType = "zset"
+	compareresult.KeyType = "stream"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
 	return &compareresult
 }
 
-//判断key在source和target同时不存在
-func (compare *CompareSingle2Cluster) KeyExistsStatusEqual(key string) *CompareResult {
+func (compare *CompareSingle2Cluster) CheckpointID() string {
+	return CheckpointID(compare.Source.Options().Addr, compare.Source.Options().DB)
+}
 
+//返回检查点中已完成的复查轮次
+func (compare *CompareSingle2Cluster) RecheckRounds() int {
+	state, _ := compare.Checkpoint.State(compare.CheckpointID())
+	return state.Rounds
+}
+
+func (compare *CompareSingle2Cluster) saveCheckpoint(progress *ScanProgress, finished bool) {
+	err := compare.Checkpoint.Update(compare.CheckpointID(), func(state *SourceCheckpoint) {
+		progress.Save(state)
+		state.ResultFile = compare.ResultFile
+		state.Finished = finished
+	})
+	if err != nil {
+		zaplogger.Sugar().Error(err)
+	}
+}
+
+//返回源key映射后的目标key
+func (compare *CompareSingle2Cluster) TargetKey(key string) string {
+	return compare.KeyMapper.Map(key)
+}
+
+//digest模式下判断源与目标key摘要是否一致，无法获取摘要或比较大key时返回false
+func (compare *CompareSingle2Cluster) DigestEqual(ctx context.Context, key string) bool {
+	//大key不通过DUMP整体读取
+	if !compare.Digest || IsBigKey(ctx) {
+		return false
+	}
+	equal, ok := compare.digester.Equal(compare.Source, compare.Target, key, compare.TargetKey(key))
+	return ok && equal
+}
+
+//元素数量超过阈值时只比较随机抽取的元素
+func (compare *CompareSingle2Cluster) UseMemberSample(length int64) bool {
+	return compare.MemberSampleThreshold > 0 && length > compare.MemberSampleThreshold
+}
+
+func (compare *CompareSingle2Cluster) memberSampleSize() int64 {
+	if compare.MemberSampleSize > 0 {
+		return compare.MemberSampleSize
+	}
+	return DefaultMemberSampleSize
+}
+
+//通过SRANDMEMBER随机抽取源set member并在目标中查找
+func (compare *CompareSingle2Cluster) CompareSetSampledMember(ctx context.Context, key string) *CompareResult {
 	compareresult := NewCompareResult()
 	reason := make(map[string]interface{})
-	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "set"
 	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
+	collector := NewDiffCollector(compare.MaxDiffPerKey)
 
-	sourceexists := KeyExists(compare.Source, key)
-	targetexists := KeyExistsInCluster(compare.Target, key)
-
-	if sourceexists == targetexists {
+	sourceresult, err := compare.Source.SRandMemberN(key, compare.memberSampleSize()).Result()
+	if err != nil {
+		compareresult.IsEqual = false
+		reason["description"] = "Source srandmember error"
+		reason["srandmembererror"] = err.Error()
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 		return &compareresult
 	}
 
-	compareresult.IsEqual = false
-	reason["description"] = "Source or Target key not exists"
-	reason["source"] = sourceexists
-	reason["target"] = targetexists
-	compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
-	return &compareresult
+	for _, v := range sourceresult {
+		exists, err := compare.Target.SIsMember(targetkey, v).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Target sismember error"
+			reason["member"] = v
+			reason["sismembererror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+		if !exists {
+			if !compare.FullDiff {
+				compareresult.IsEqual = false
+				reason["description"] = "Source set member not exists in Target"
+				reason["member"] = v
+				reason["sampled"] = true
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+			collector.Add(DiffMissing, map[string]interface{}{
+				"description": "Source set member not exists in Target",
+				"member":      v,
+				"sampled":     true,
+			})
+		}
+	}
+	return collector.Apply(&compareresult)
 }
 
-//比较Zset member以及sore值是否一致
-func (compare *CompareSingle2Cluster) CompareZsetMemberScore(key string) *CompareResult {
+//通过HRANDFIELD随机抽取源hash field并在目标中比较value，源不支持HRANDFIELD时逐field比较
+func (compare *CompareSingle2Cluster) CompareHashSampledField(ctx context.Context, key string) *CompareResult {
 	compareresult := NewCompareResult()
 	reason := make(map[string]interface{})
-
-	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Key = key
-	compareresult.KeyType = "Zset"
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "hash"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
+	collector := NewDiffCollector(compare.MaxDiffPerKey)
 
-	cursor := uint64(0)
-	for {
-		sourceresult, c, err := compare.Source.ZScan(key, cursor, "*", compare.BatchSize).Result()
-		if err != nil {
+	sourceresult, err := RandHashFields(compare.Source, key, compare.memberSampleSize())
+	if err != nil {
+		zaplogger.Sugar().Info("HRANDFIELD unavailable, compare all fields: ", key, " ", err)
+		return compare.CompareHashFieldVal(ctx, key)
+	}
+
+	for i := 0; i < len(sourceresult); i = i + 2 {
+		targetfieldval, err := compare.Target.HGet(targetkey, sourceresult[i]).Result()
+		if err != nil && err != redis.Nil {
 			compareresult.IsEqual = false
-			reason["description"] = "Source zscan error"
-			reason["zscanerror"] = err.Error()
+			reason["description"] = "Target hget error"
+			reason["field"] = sourceresult[i]
+			reason["hgeterror"] = err.Error()
 			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 			return &compareresult
 		}
-
-		for i := 0; i < len(sourceresult); i = i + 2 {
-			sourecemember := sourceresult[i]
-			sourcescore, err := strconv.ParseFloat(sourceresult[i+1], 64)
-			if err != nil {
+		if err == redis.Nil || !compare.Normalizers.Equal(key, sourceresult[i+1], targetfieldval, compare.Tolerance) && !compare.Rules.Equal(key, sourceresult[i], sourceresult[i+1], targetfieldval) {
+			if !compare.FullDiff {
 				compareresult.IsEqual = false
-				reason["description"] = "Convert sourcescore to float64 error"
-				reason["floattostringerror"] = err.Error()
+				reason["description"] = "Field value not equal"
+				reason["field"] = sourceresult[i]
+				reason["sourceval"] = sourceresult[i+1]
+				reason["targetval"] = targetfieldval
+				reason["sampled"] = true
 				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 				return &compareresult
 			}
 
-			intcmd := compare.Target.ZRank(key, sourecemember)
-			targetscore := compare.Target.ZScore(key, sourecemember).Val()
+			if err == redis.Nil {
+				collector.Add(DiffMissing, map[string]interface{}{
+					"description": "Source hash field not exists in Target",
+					"field":       sourceresult[i],
+					"sourceval":   sourceresult[i+1],
+					"sampled":     true,
+				})
+				continue
+			}
+			collector.Add(DiffChanged, map[string]interface{}{
+				"description": "Field value not equal",
+				"field":       sourceresult[i],
+				"sourceval":   sourceresult[i+1],
+				"targetval":   targetfieldval,
+				"sampled":     true,
+			})
+		}
+	}
+	return collector.Apply(&compareresult)
+}
+
+//通过ZRANDMEMBER随机抽取源zset member并在目标中比较score，源不支持ZRANDMEMBER时逐member比较
+func (compare *CompareSingle2Cluster) CompareZsetSampledMember(ctx context.Context, key string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "Zset"
+	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+	collector := NewDiffCollector(compare.MaxDiffPerKey)
+
+	sourceresult, err := RandZsetMembers(compare.Source, key, compare.memberSampleSize())
+	if err != nil {
+		zaplogger.Sugar().Info("ZRANDMEMBER unavailable, compare all members: ", key, " ", err)
+		return compare.CompareZsetMemberScore(ctx, key)
+	}
+
+	for i := 0; i < len(sourceresult); i = i + 2 {
+		sourecemember := sourceresult[i]
+		sourcescore, err := strconv.ParseFloat(sourceresult[i+1], 64)
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Convert sourcescore to float64 error"
+			reason["floattostringerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
 
-			if intcmd == nil {
+		targetscore, err := compare.Target.ZScore(targetkey, sourecemember).Result()
+		if err != nil && err != redis.Nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Target zscore error"
+			reason["member"] = sourecemember
+			reason["zscoreerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+		if err == redis.Nil {
+			if !compare.FullDiff {
 				compareresult.IsEqual = false
 				reason["description"] = "Source zset member not exists in Target"
 				reason["member"] = sourecemember
+				reason["sampled"] = true
 				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 				return &compareresult
 			}
+			collector.Add(DiffMissing, map[string]interface{}{
+				"description": "Source zset member not exists in Target",
+				"member":      sourecemember,
+				"sampled":     true,
+			})
+			continue
+		}
 
-			if targetscore != sourcescore {
+		if !compare.Tolerance.ScoreEqual(sourcescore, targetscore) && !compare.Rules.Equal(key, sourecemember, sourceresult[i+1], strconv.FormatFloat(targetscore, 'g', -1, 64)) {
+			if !compare.FullDiff {
 				compareresult.IsEqual = false
 				reason["description"] = "zset member score not equal"
 				reason["member"] = sourecemember
 				reason["sourcescore"] = sourcescore
 				reason["targetscore"] = targetscore
+				reason["sampled"] = true
 				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 				return &compareresult
 			}
-
-		}
-
-		cursor = c
-		if c == 0 {
-			break
+			collector.Add(DiffChanged, map[string]interface{}{
+				"description": "zset member score not equal",
+				"member":      sourecemember,
+				"sourcescore": sourcescore,
+				"targetscore": targetscore,
+				"sampled":     true,
+			})
 		}
 	}
-	return &compareresult
+	return collector.Apply(&compareresult)
 }
 
-//比较zset 长度是否一致
-func (compare *CompareSingle2Cluster) CompareZsetLen(key string) *CompareResult {
+//判断key在source和target同时不存在
+func (compare *CompareSingle2Cluster) KeyExistsStatusEqual(key string) *CompareResult {
+
 	compareresult := NewCompareResult()
 	reason := make(map[string]interface{})
-
 	compareresult.Target = compare.Target.Options().Addrs
-	compareresult.Source = compare.Source.Options().Addr
 	compareresult.Key = key
-	compareresult.KeyType = "Zset"
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.Source = compare.Source.Options().Addr
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
 
-	sourcelen := compare.Source.ZCard(key).Val()
-	targetlen := compare.Target.ZCard(key).Val()
-	if sourcelen != targetlen {
-		compareresult.IsEqual = false
-		reason["description"] = "Zset length not equal"
-		reason["sourcelen"] = sourcelen
-		reason["targetlen"] = targetlen
-		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+	sourceexists := KeyExists(compare.Source, key)
+	targetexists := KeyExistsInCluster(compare.Target, targetkey)
+
+	if sourceexists == targetexists {
 		return &compareresult
 	}
-	return &compareresult
-}
 
-//比较set member 是否一致
-func (compare *CompareSingle2Cluster) CompareSetMember(key string) *CompareResult {
-	compareresult := NewCompareResult()
+	compareresult.IsEqual = false
+	reason["description"] = "Source or Target key not exists"
+	reason["source"] = sourceexists
+	reason["target"] = targetexists
+	compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+	return &compareresult
+}
+
+//比较Zset member以及sore值是否一致，全量差异模式下返回所有不一致的member
+func (compare *CompareSingle2Cluster) CompareZsetMemberScore(ctx context.Context, key string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "Zset"
+	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+	collector := NewDiffCollector(compare.MaxDiffPerKey)
+
+	cursor := uint64(0)
+	for {
+		if ctx.Err() != nil {
+			return &compareresult
+		}
+		sourceresult, c, err := compare.Source.ZScan(key, cursor, "*", ChunkSize(ctx, compare.BatchSize)).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Source zscan error"
+			reason["zscanerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		for i := 0; i < len(sourceresult); i = i + 2 {
+			sourecemember := sourceresult[i]
+			if compare.Rules.Ignored(key, sourecemember) {
+				continue
+			}
+			sourcescore, err := strconv.ParseFloat(sourceresult[i+1], 64)
+			if err != nil {
+				compareresult.IsEqual = false
+				reason["description"] = "Convert sourcescore to float64 error"
+				reason["floattostringerror"] = err.Error()
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+
+			targetscore, err := compare.Target.ZScore(targetkey, sourecemember).Result()
+			if err != nil && err != redis.Nil {
+				compareresult.IsEqual = false
+				reason["description"] = "Target zscore error"
+				reason["member"] = sourecemember
+				reason["zscoreerror"] = err.Error()
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+			if err == redis.Nil {
+				if !compare.FullDiff {
+					compareresult.IsEqual = false
+					reason["description"] = "Source zset member not exists in Target"
+					reason["member"] = sourecemember
+					compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+					return &compareresult
+				}
+				collector.Add(DiffMissing, map[string]interface{}{
+					"description": "Source zset member not exists in Target",
+					"member":      sourecemember,
+				})
+				continue
+			}
+
+			if !compare.Tolerance.ScoreEqual(sourcescore, targetscore) && !compare.Rules.Equal(key, sourecemember, sourceresult[i+1], strconv.FormatFloat(targetscore, 'g', -1, 64)) {
+				if !compare.FullDiff {
+					compareresult.IsEqual = false
+					reason["description"] = "zset member score not equal"
+					reason["member"] = sourecemember
+					reason["sourcescore"] = sourcescore
+					reason["targetscore"] = targetscore
+					compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+					return &compareresult
+				}
+				collector.Add(DiffChanged, map[string]interface{}{
+					"description": "zset member score not equal",
+					"member":      sourecemember,
+					"sourcescore": sourcescore,
+					"targetscore": targetscore,
+				})
+			}
+
+		}
+
+		cursor = c
+		if c == 0 {
+			break
+		}
+	}
+
+	//忽略部分field或member时未比较长度，需扫描目标中多出的元素
+	if !compare.FullDiff && !compare.Rules.HasIgnore(key) {
+		return &compareresult
+	}
+
+	//扫描目标zset中多出的member
+	cursor = uint64(0)
+	for {
+		if ctx.Err() != nil {
+			return &compareresult
+		}
+		targetresult, c, err := compare.Target.ZScan(targetkey, cursor, "*", ChunkSize(ctx, compare.BatchSize)).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Target zscan error"
+			reason["zscanerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		for i := 0; i < len(targetresult); i = i + 2 {
+			if compare.Rules.Ignored(key, targetresult[i]) || compare.Source.ZScore(key, targetresult[i]).Err() != redis.Nil {
+				continue
+			}
+			if !compare.FullDiff {
+				compareresult.IsEqual = false
+				reason["description"] = "Target zset member not exists in Source"
+				reason["member"] = targetresult[i]
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+			collector.Add(DiffExtra, map[string]interface{}{
+				"description": "Target zset member not exists in Source",
+				"member":      targetresult[i],
+				"targetscore": targetresult[i+1],
+			})
+		}
+
+		cursor = c
+		if c == 0 {
+			break
+		}
+	}
+	return collector.Apply(&compareresult)
+}
+
+//比较zset 长度是否一致
+func (compare *CompareSingle2Cluster) CompareZsetLen(key string) *CompareResult {
+	compareresult := NewCompareResult()
 	reason := make(map[string]interface{})
 
 	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "Zset"
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+
+	sourcelen := compare.Source.ZCard(key).Val()
+	targetlen := compare.Target.ZCard(targetkey).Val()
+	if sourcelen != targetlen {
+		compareresult.IsEqual = false
+		reason["description"] = "Zset length not equal"
+		reason["sourcelen"] = sourcelen
+		reason["targetlen"] = targetlen
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+		return &compareresult
+	}
+	return &compareresult
+}
+
+//比较set member 是否一致，全量差异模式下返回所有不一致的member
+func (compare *CompareSingle2Cluster) CompareSetMember(ctx context.Context, key string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
 	compareresult.KeyType = "set"
+	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
+	collector := NewDiffCollector(compare.MaxDiffPerKey)
 
 	cursor := uint64(0)
 	for {
-		sourceresult, c, err := compare.Source.SScan(key, cursor, "*", compare.BatchSize).Result()
+		if ctx.Err() != nil {
+			return &compareresult
+		}
+		sourceresult, c, err := compare.Source.SScan(key, cursor, "*", ChunkSize(ctx, compare.BatchSize)).Result()
 		if err != nil {
 			compareresult.IsEqual = false
 			reason["description"] = "Source sscan error"
@@ -435,13 +1097,31 @@ func (compare *CompareSingle2Cluster) CompareSetMember(key string) *CompareResul
 		}
 
 		for _, v := range sourceresult {
-			if !compare.Target.SIsMember(key, v).Val() {
+			if compare.Rules.Ignored(key, v) {
+				continue
+			}
+			exists, err := compare.Target.SIsMember(targetkey, v).Result()
+			if err != nil {
 				compareresult.IsEqual = false
-				reason["description"] = "Source set member not exists in Target"
+				reason["description"] = "Target sismember error"
 				reason["member"] = v
+				reason["sismembererror"] = err.Error()
 				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 				return &compareresult
 			}
+			if !exists {
+				if !compare.FullDiff {
+					compareresult.IsEqual = false
+					reason["description"] = "Source set member not exists in Target"
+					reason["member"] = v
+					compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+					return &compareresult
+				}
+				collector.Add(DiffMissing, map[string]interface{}{
+					"description": "Source set member not exists in Target",
+					"member":      v,
+				})
+			}
 		}
 
 		cursor = c
@@ -449,7 +1129,62 @@ func (compare *CompareSingle2Cluster) CompareSetMember(key string) *CompareResul
 			break
 		}
 	}
-	return &compareresult
+
+	//忽略部分field或member时未比较长度，需扫描目标中多出的元素
+	if !compare.FullDiff && !compare.Rules.HasIgnore(key) {
+		return &compareresult
+	}
+
+	//扫描目标set中多出的member
+	cursor = uint64(0)
+	for {
+		if ctx.Err() != nil {
+			return &compareresult
+		}
+		targetresult, c, err := compare.Target.SScan(targetkey, cursor, "*", ChunkSize(ctx, compare.BatchSize)).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Target sscan error"
+			reason["sscanerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		for _, v := range targetresult {
+			if compare.Rules.Ignored(key, v) {
+				continue
+			}
+			exists, err := compare.Source.SIsMember(key, v).Result()
+			if err != nil {
+				compareresult.IsEqual = false
+				reason["description"] = "Source sismember error"
+				reason["member"] = v
+				reason["sismembererror"] = err.Error()
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+			if exists {
+				continue
+			}
+			if !compare.FullDiff {
+				compareresult.IsEqual = false
+				reason["description"] = "Target set member not exists in Source"
+				reason["member"] = v
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+			collector.Add(DiffExtra, map[string]interface{}{
+				"description": "Target set member not exists in Source",
+				"member":      v,
+			})
+		}
+
+		cursor = c
+		if c == 0 {
+			break
+		}
+	}
+	return collector.Apply(&compareresult)
 }
 
 //比较set长度
@@ -459,12 +1194,14 @@ func (compare *CompareSingle2Cluster) CompareSetLen(key string) *CompareResult {
 	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
 	compareresult.KeyType = "set"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
 
 	sourcelen := compare.Source.SCard(key).Val()
-	targetlen := compare.Target.SCard(key).Val()
+	targetlen := compare.Target.SCard(targetkey).Val()
 	if sourcelen != targetlen {
 		compareresult.IsEqual = false
 		reason["description"] = "Set length not equal"
@@ -476,20 +1213,26 @@ func (compare *CompareSingle2Cluster) CompareSetLen(key string) *CompareResult {
 	return &compareresult
 }
 
-//比较hash field value 返回首个不相等的field
-func (compare *CompareSingle2Cluster) CompareHashFieldVal(key string) *CompareResult {
+//比较hash field value 返回首个不相等的field，全量差异模式下返回所有不相等的field
+func (compare *CompareSingle2Cluster) CompareHashFieldVal(ctx context.Context, key string) *CompareResult {
 	compareresult := NewCompareResult()
 	reason := make(map[string]interface{})
-	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
 	compareresult.KeyType = "hash"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
+	collector := NewDiffCollector(compare.MaxDiffPerKey)
 
 	cursor := uint64(0)
 	for {
-		sourceresult, c, err := compare.Source.HScan(key, cursor, "*", compare.BatchSize).Result()
+		if ctx.Err() != nil {
+			return &compareresult
+		}
+		sourceresult, c, err := compare.Source.HScan(key, cursor, "*", ChunkSize(ctx, compare.BatchSize)).Result()
 
 		if err != nil {
 			compareresult.IsEqual = false
@@ -500,23 +1243,107 @@ func (compare *CompareSingle2Cluster) CompareHashFieldVal(key string) *CompareRe
 		}
 
 		for i := 0; i < len(sourceresult); i = i + 2 {
-			targetfieldval := compare.Target.HGet(key, sourceresult[i]).Val()
-			if targetfieldval != sourceresult[i+1] {
+			if compare.Rules.Ignored(key, sourceresult[i]) {
+				continue
+			}
+			targetfieldval, err := compare.Target.HGet(targetkey, sourceresult[i]).Result()
+			if err != nil && err != redis.Nil {
 				compareresult.IsEqual = false
-				reason["description"] = "Field value not equal"
+				reason["description"] = "Target hget error"
 				reason["field"] = sourceresult[i]
-				reason["sourceval"] = sourceresult[i+1]
-				reason["targetval"] = targetfieldval
+				reason["hgeterror"] = err.Error()
 				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 				return &compareresult
 			}
+			if err == redis.Nil || !compare.Normalizers.Equal(key, sourceresult[i+1], targetfieldval, compare.Tolerance) && !compare.Rules.Equal(key, sourceresult[i], sourceresult[i+1], targetfieldval) {
+				if !compare.FullDiff {
+					compareresult.IsEqual = false
+					reason["description"] = "Field value not equal"
+					reason["field"] = sourceresult[i]
+					reason["sourceval"] = sourceresult[i+1]
+					reason["targetval"] = targetfieldval
+					compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+					return &compareresult
+				}
+
+				if err == redis.Nil {
+					collector.Add(DiffMissing, map[string]interface{}{
+						"description": "Source hash field not exists in Target",
+						"field":       sourceresult[i],
+						"sourceval":   sourceresult[i+1],
+					})
+					continue
+				}
+				collector.Add(DiffChanged, map[string]interface{}{
+					"description": "Field value not equal",
+					"field":       sourceresult[i],
+					"sourceval":   sourceresult[i+1],
+					"targetval":   targetfieldval,
+				})
+			}
 		}
 		cursor = c
 		if c == uint64(0) {
 			break
 		}
 	}
-	return &compareresult
+
+	//忽略部分field或member时未比较长度，需扫描目标中多出的元素
+	if !compare.FullDiff && !compare.Rules.HasIgnore(key) {
+		return &compareresult
+	}
+
+	//扫描目标hash中多出的field
+	cursor = uint64(0)
+	for {
+		if ctx.Err() != nil {
+			return &compareresult
+		}
+		targetresult, c, err := compare.Target.HScan(targetkey, cursor, "*", ChunkSize(ctx, compare.BatchSize)).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Target hscan error"
+			reason["hscanerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		for i := 0; i < len(targetresult); i = i + 2 {
+			if compare.Rules.Ignored(key, targetresult[i]) {
+				continue
+			}
+			exists, err := compare.Source.HExists(key, targetresult[i]).Result()
+			if err != nil {
+				compareresult.IsEqual = false
+				reason["description"] = "Source hexists error"
+				reason["field"] = targetresult[i]
+				reason["hexistserror"] = err.Error()
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+			if exists {
+				continue
+			}
+			if !compare.FullDiff {
+				compareresult.IsEqual = false
+				reason["description"] = "Target hash field not exists in Source"
+				reason["field"] = targetresult[i]
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+			collector.Add(DiffExtra, map[string]interface{}{
+				"description": "Target hash field not exists in Source",
+				"field":       targetresult[i],
+				"targetval":   targetresult[i+1],
+			})
+		}
+
+		cursor = c
+		if c == uint64(0) {
+			break
+		}
+	}
+	return collector.Apply(&compareresult)
 }
 
 //比较hash长度
@@ -526,12 +1353,14 @@ func (compare *CompareSingle2Cluster) CompareHashLen(key string) *CompareResult
 	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
 	compareresult.KeyType = "hash"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
 
 	sourcelen := compare.Source.HLen(key).Val()
-	targetlen := compare.Target.HLen(key).Val()
+	targetlen := compare.Target.HLen(targetkey).Val()
 
 	if sourcelen != targetlen {
 
@@ -545,73 +1374,81 @@ func (compare *CompareSingle2Cluster) CompareHashLen(key string) *CompareResult
 	return &compareresult
 }
 
-//比较list index对应值是否一致，返回第一条错误的index以及源和目标对应的值
-func (compare *CompareSingle2Cluster) CompareListIndexVal(key string) *CompareResult {
+//比较list index对应值是否一致，返回第一条错误的index以及源和目标对应的值，全量差异模式下返回所有不一致的index
+func (compare *CompareSingle2Cluster) CompareListIndexVal(ctx context.Context, key string) *CompareResult {
 	compareresult := NewCompareResult()
 	reason := make(map[string]interface{})
-	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
 	compareresult.KeyType = "list"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
+	collector := NewDiffCollector(compare.MaxDiffPerKey)
 
 	sourcelen := compare.Source.LLen(key).Val()
-	//targetlen := compare.Target.LLen(key).Val()
+	targetlen := compare.Target.LLen(targetkey).Val()
 
-	compareresult.Key = key
-	quotient := sourcelen / compare.BatchSize // integer division, decimals are truncated
-	remainder := sourcelen % compare.BatchSize
-
-	if quotient != 0 {
-		var lrangeend int64
-		for i := int64(0); i < quotient; i++ {
-			if i == quotient-int64(1) {
-				lrangeend = quotient * compare.BatchSize
-			} else {
-				lrangeend = (compare.BatchSize - 1) + i*compare.BatchSize
-			}
-			sourcevalues := compare.Source.LRange(key, int64(0)+i*compare.BatchSize, lrangeend).Val()
-			targetvalues := compare.Target.LRange(key, int64(0)+i*compare.BatchSize, lrangeend).Val()
-			for k, v := range sourcevalues {
-				if targetvalues[k] != v {
+	//全量差异模式下需覆盖目标list中多出的index
+	end := sourcelen
+	if compare.FullDiff && targetlen > end {
+		end = targetlen
+	}
+
+	for start := int64(0); start < end; start = start + ChunkSize(ctx, compare.BatchSize) {
+		if ctx.Err() != nil {
+			return &compareresult
+		}
+		stop := start + ChunkSize(ctx, compare.BatchSize) - 1
+		sourcevalues := compare.Source.LRange(key, start, stop).Val()
+		targetvalues := compare.Target.LRange(targetkey, start, stop).Val()
+
+		for k := 0; k < len(sourcevalues) || (compare.FullDiff && k < len(targetvalues)); k++ {
+			index := start + int64(k)
+			switch {
+			case k >= len(targetvalues):
+				if !compare.FullDiff {
+					compareresult.IsEqual = false
+					reason["description"] = "List index not exists in Target"
+					reason["Index"] = index
+					reason["sourceval"] = sourcevalues[k]
+					compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+					return &compareresult
+				}
+				collector.Add(DiffMissing, map[string]interface{}{
+					"description": "List index not exists in Target",
+					"Index":       index,
+					"sourceval":   sourcevalues[k],
+				})
+			case k >= len(sourcevalues):
+				collector.Add(DiffExtra, map[string]interface{}{
+					"description": "List index not exists in Source",
+					"Index":       index,
+					"targetval":   targetvalues[k],
+				})
+			case !compare.Tolerance.ValueEqual(sourcevalues[k], targetvalues[k]) && !compare.Rules.Equal(key, "", sourcevalues[k], targetvalues[k]):
+				if !compare.FullDiff {
 					compareresult.IsEqual = false
 					reason["description"] = "List index value not equal"
-					reason["Index"] = int64(k) + i*compare.BatchSize
-					reason["sourceval"] = v
+					reason["Index"] = index
+					reason["sourceval"] = sourcevalues[k]
 					reason["targetval"] = targetvalues[k]
 					compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 					return &compareresult
 				}
+				collector.Add(DiffChanged, map[string]interface{}{
+					"description": "List index value not equal",
+					"Index":       index,
+					"sourceval":   sourcevalues[k],
+					"targetval":   targetvalues[k],
+				})
 			}
 		}
 	}
 
-	if remainder != 0 {
-		var rangstart int64
-
-		if quotient == int64(0) {
-			rangstart = int64(0)
-		} else {
-			rangstart = quotient*compare.BatchSize + 1
-		}
-
-		sourcevalues := compare.Source.LRange(key, rangstart, remainder+quotient*compare.BatchSize).Val()
-		targetvalues := compare.Target.LRange(key, rangstart, remainder+quotient*compare.BatchSize).Val()
-		for k, v := range sourcevalues {
-			if targetvalues[k] != v {
-				compareresult.IsEqual = false
-				reason["description"] = "List index value not equal"
-				reason["Index"] = int64(k) + rangstart
-				reason["sourceval"] = v
-				reason["targetval"] = targetvalues[k]
-				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
-				return &compareresult
-			}
-		}
-	}
-
-	return &compareresult
+	return collector.Apply(&compareresult)
 
 }
 
@@ -622,12 +1459,14 @@ func (compare *CompareSingle2Cluster) CompareListLen(key string) *CompareResult
 	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
 	compareresult.KeyType = "list"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
 
 	sourcelen := compare.Source.LLen(key).Val()
-	targetlen := compare.Target.LLen(key).Val()
+	targetlen := compare.Target.LLen(targetkey).Val()
 
 	compareresult.Key = key
 	if sourcelen != targetlen {
@@ -642,27 +1481,292 @@ func (compare *CompareSingle2Cluster) CompareListLen(key string) *CompareResult
 }
 
 //对比string类型value是否一致
-func (compare *CompareSingle2Cluster) CompareStringVal(key string) *CompareResult {
+func (compare *CompareSingle2Cluster) CompareStringVal(ctx context.Context, key string) *CompareResult {
 	compareresult := NewCompareResult()
-	reason := make(map[string]interface{})
 	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
 	compareresult.KeyType = "string"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
 
-	sourceval := compare.Source.Get(key).Val()
-	targetval := compare.Target.Get(key).Val()
+	//先比较长度再分段比较，差异中只记录第一个不一致字节附近的预览
+	rule := StringCompare{ChunkSize: compare.StringChunkSize, Hash: compare.StringHash, Tolerance: compare.Tolerance, Normalizers: compare.Normalizers}
+	if reason := rule.Diff(ctx, compare.Source, compare.Target, key, targetkey); reason != nil && !compare.Rules.StringEqual(compare.Source, compare.Target, key, targetkey) {
+		compareresult.IsEqual = false
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+		return &compareresult
+	}
+	return &compareresult
+}
+
+//比较stream长度是否一致
+func (compare *CompareSingle2Cluster) CompareStreamLen(key string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
+	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "stream"
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+
+	sourcelen := compare.Source.XLen(key).Val()
+	targetlen := compare.Target.XLen(targetkey).Val()
+	if sourcelen != targetlen {
+		compareresult.IsEqual = false
+		reason["description"] = "Stream length not equal"
+		reason["sourcelen"] = sourcelen
+		reason["targetlen"] = targetlen
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+		return &compareresult
+	}
+	return &compareresult
+}
+
+//比较stream last-generated-id是否一致
+func (compare *CompareSingle2Cluster) CompareStreamLastID(key string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Key = key
-	if sourceval != targetval {
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "stream"
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+
+	sourceid, err := StreamInfoField(compare.Source.Do("xinfo", "stream", key), "last-generated-id")
+	if err != nil {
 		compareresult.IsEqual = false
-		reason["description"] = "String value not equal"
-		reason["sval"] = sourceval
-		reason["tval"] = targetval
+		reason["description"] = "Source xinfo stream error"
+		reason["xinfoerror"] = err.Error()
 		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
 		return &compareresult
 	}
+
+	targetid, err := StreamInfoField(compare.Target.Do("xinfo", "stream", targetkey), "last-generated-id")
+	if err != nil {
+		compareresult.IsEqual = false
+		reason["description"] = "Target xinfo stream error"
+		reason["xinfoerror"] = err.Error()
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+		return &compareresult
+	}
+
+	if sourceid != targetid {
+		compareresult.IsEqual = false
+		reason["description"] = "Stream last generated id not equal"
+		reason["sourceid"] = sourceid
+		reason["targetid"] = targetid
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+		return &compareresult
+	}
+	return &compareresult
+}
+
+//按批次比较stream entry id以及field/value，返回首个不一致的entry
+func (compare *CompareSingle2Cluster) CompareStreamEntries(ctx context.Context, key string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
+	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "stream"
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+
+	start := "-"
+	for {
+		if ctx.Err() != nil {
+			return &compareresult
+		}
+		sourceentries, err := compare.Source.XRangeN(key, start, "+", ChunkSize(ctx, compare.BatchSize)).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Source xrange error"
+			reason["xrangeerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		if len(sourceentries) == 0 {
+			break
+		}
+
+		targetentries, err := compare.Target.XRangeN(targetkey, start, "+", ChunkSize(ctx, compare.BatchSize)).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Target xrange error"
+			reason["xrangeerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		for k, v := range sourceentries {
+			if k >= len(targetentries) || targetentries[k].ID != v.ID {
+				compareresult.IsEqual = false
+				reason["description"] = "Source stream entry id not exists in Target"
+				reason["id"] = v.ID
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+
+			if !StreamValuesEqual(v.Values, targetentries[k].Values) && !compare.Rules.MapEqual(key, v.Values, targetentries[k].Values) {
+				compareresult.IsEqual = false
+				reason["description"] = "Stream entry value not equal"
+				reason["id"] = v.ID
+				reason["sourceval"] = v.Values
+				reason["targetval"] = targetentries[k].Values
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+		}
+
+		if int64(len(sourceentries)) < ChunkSize(ctx, compare.BatchSize) {
+			break
+		}
+
+		next, err := NextStreamID(sourceentries[len(sourceentries)-1].ID)
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Parse stream id error"
+			reason["streamiderror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+		start = next
+	}
+	return &compareresult
+}
+
+//比较stream consumer group的名称、last-delivered-id、consumer数量以及pending数量
+func (compare *CompareSingle2Cluster) CompareStreamGroups(key string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
+	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "stream"
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+
+	sourcegroups, err := StreamGroupsInfo(compare.Source.Do("xinfo", "groups", key))
+	if err != nil {
+		compareresult.IsEqual = false
+		reason["description"] = "Source xinfo groups error"
+		reason["xinfoerror"] = err.Error()
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+		return &compareresult
+	}
+
+	targetgroups, err := StreamGroupsInfo(compare.Target.Do("xinfo", "groups", targetkey))
+	if err != nil {
+		compareresult.IsEqual = false
+		reason["description"] = "Target xinfo groups error"
+		reason["xinfoerror"] = err.Error()
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+		return &compareresult
+	}
+
+	for name, sgroup := range sourcegroups {
+		tgroup, ok := targetgroups[name]
+		if !ok {
+			compareresult.IsEqual = false
+			reason["description"] = ReasonStreamGroupNotExists
+			reason["group"] = name
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		for _, field := range []string{"last-delivered-id", "consumers", "pending"} {
+			if fmt.Sprint(sgroup[field]) != fmt.Sprint(tgroup[field]) {
+				compareresult.IsEqual = false
+				reason["description"] = ReasonStreamGroupNotEqual
+				reason["group"] = name
+				reason["field"] = field
+				reason["sourceval"] = sgroup[field]
+				reason["targetval"] = tgroup[field]
+				compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+				return &compareresult
+			}
+		}
+	}
+
+	for name := range targetgroups {
+		if _, ok := sourcegroups[name]; !ok {
+			compareresult.IsEqual = false
+			reason["description"] = ReasonStreamGroupOnlyInTarget
+			reason["group"] = name
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+	}
+	return &compareresult
+}
+
+//比较各consumer group的XPENDING汇总信息
+func (compare *CompareSingle2Cluster) CompareStreamPending(key string) *CompareResult {
+	compareresult := NewCompareResult()
+	reason := make(map[string]interface{})
+	compareresult.Source = compare.Source.Options().Addr
+	compareresult.Target = compare.Target.Options().Addrs
+	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
+	compareresult.KeyType = "stream"
+	compareresult.SourceDB = compare.SourceDB
+	compareresult.TargetDB = compare.TargetDB
+
+	sourcegroups, err := StreamGroupsInfo(compare.Source.Do("xinfo", "groups", key))
+	if err != nil {
+		compareresult.IsEqual = false
+		reason["description"] = "Source xinfo groups error"
+		reason["xinfoerror"] = err.Error()
+		compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+		return &compareresult
+	}
+
+	for name := range sourcegroups {
+		sourcepending, err := compare.Source.XPending(key, name).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Source xpending error"
+			reason["group"] = name
+			reason["xpendingerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		targetpending, err := compare.Target.XPending(targetkey, name).Result()
+		if err != nil {
+			compareresult.IsEqual = false
+			reason["description"] = "Target xpending error"
+			reason["group"] = name
+			reason["xpendingerror"] = err.Error()
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+
+		if !reflect.DeepEqual(sourcepending, targetpending) {
+			compareresult.IsEqual = false
+			reason["description"] = ReasonStreamPendingNotEqual
+			reason["group"] = name
+			reason["sourcepending"] = sourcepending
+			reason["targetpending"] = targetpending
+			compareresult.KeyDiffReason = append(compareresult.KeyDiffReason, reason)
+			return &compareresult
+		}
+	}
 	return &compareresult
 }
 
@@ -673,12 +1777,14 @@ func (compare *CompareSingle2Cluster) DiffTTLOver(key string) *CompareResult {
 	compareresult.Target = compare.Target.Options().Addrs
 	compareresult.Source = compare.Source.Options().Addr
 	compareresult.Key = key
+	targetkey := compare.TargetKey(key)
+	compareresult.TargetKey = targetkey
 	compareresult.KeyType = "string"
 	compareresult.SourceDB = compare.SourceDB
 	compareresult.TargetDB = compare.TargetDB
 
 	sourcettl := compare.Source.PTTL(key).Val().Milliseconds()
-	targetttl := compare.Target.PTTL(key).Val().Milliseconds()
+	targetttl := compare.Target.PTTL(targetkey).Val().Milliseconds()
 
 	sub := targetttl - sourcettl
 	if math.Abs(float64(sub)) > compare.TTLDiff {
@@ -1,6 +1,7 @@
 package compare
 
 import (
+	"context"
 	"github.com/go-redis/redis/v7"
 	"rediscompare/commons"
 	"testing"
@@ -38,5 +39,5 @@ func TestCompareSingle2Single_CompareDB(t *testing.T) {
 		SourceDB:       0,               //源redis DB number
 		TargetDB:       0,               //目标redis DB number
 	}
-	csc.CompareDB()
+	csc.CompareDB(context.Background())
 }
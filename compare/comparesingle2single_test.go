@@ -1,6 +1,7 @@
 package compare
 
 import (
+	"context"
 	"github.com/go-redis/redis/v7"
 	"rediscompare/commons"
 	"testing"
@@ -56,5 +57,5 @@ func TestCompareSingle2Single_CompareKeysFromResultFile(t *testing.T) {
 		RecordResult:   true,
 		CompareThreads: 3,
 	}
-	compare.CompareKeysFromResultFile([]string{"../compare_20200308173929000.result"})
+	compare.CompareKeysFromResultFile(context.Background(), []string{"../compare_20200308173929000.result"})
 }
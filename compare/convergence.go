@@ -0,0 +1,126 @@
+package compare
+
+import (
+	"sort"
+	"time"
+)
+
+//报告中列出的已收敛key数量上限
+const maxTransientKeys = 100
+
+//复查策略，按指数退避的间隔复查上一轮的差异key
+type RecheckPolicy struct {
+	Interval    time.Duration //首次复查前的等待时间
+	Backoff     float64       //每轮等待时间的倍数，不大于1时间隔固定
+	MaxInterval time.Duration //等待时间上限，0表示不限制
+	RetryBudget int           //每个key的最大复查次数
+}
+
+//第round轮复查前的等待时间，round从0开始
+func (policy RecheckPolicy) Delay(round int) time.Duration {
+	delay := float64(policy.Interval)
+	for i := 0; i < round && policy.Backoff > 1; i++ {
+		delay *= policy.Backoff
+		if policy.MaxInterval > 0 && delay >= float64(policy.MaxInterval) {
+			return policy.MaxInterval
+		}
+	}
+	if policy.MaxInterval > 0 && delay > float64(policy.MaxInterval) {
+		return policy.MaxInterval
+	}
+	return time.Duration(delay)
+}
+
+//记录每个差异key的复查次数以及第几次复查后收敛，key可在不同轮次出现，各自计算复查次数
+type Convergence struct {
+	Rounds    int //已完成的复查轮次
+	budget    int
+	current   map[string]bool
+	attempts  map[string]int
+	converged map[string]int
+}
+
+//keys为首轮比较的差异key，rounds为恢复时已完成的复查轮次，budget为每个key的最大复查次数
+func NewConvergence(keys map[string]bool, rounds int, budget int) *Convergence {
+	convergence := &Convergence{
+		Rounds:    rounds,
+		budget:    budget,
+		current:   keys,
+		attempts:  make(map[string]int),
+		converged: make(map[string]int),
+	}
+	for k := range keys {
+		convergence.attempts[k] = rounds
+	}
+	return convergence
+}
+
+//key是否仍有复查次数，本轮只复查返回true的key
+func (convergence *Convergence) Recheck(key string) bool {
+	return convergence.attempts[key] < convergence.budget
+}
+
+//记录一轮复查后仍不一致的key，本轮复查且不在其中的key视为收敛，未复查的key保持不一致
+func (convergence *Convergence) Update(keys map[string]bool) {
+	convergence.Rounds++
+	next := make(map[string]bool, len(keys))
+	for k := range keys {
+		next[k] = true
+		//收敛后再次出现差异的key不再视为收敛
+		if !convergence.current[k] {
+			delete(convergence.converged, k)
+		}
+	}
+	for k := range convergence.current {
+		if !convergence.Recheck(k) {
+			next[k] = true
+			continue
+		}
+		convergence.attempts[k]++
+		if !keys[k] {
+			convergence.converged[k] = convergence.attempts[k]
+		}
+	}
+	convergence.current = next
+}
+
+//仍不一致且未用完复查次数的key数量，为0时停止复查
+func (convergence *Convergence) Remaining() int {
+	n := 0
+	for k := range convergence.current {
+		if convergence.Recheck(k) {
+			n++
+		}
+	}
+	return n
+}
+
+//区分复查后仍不一致的持久差异与已收敛的临时差异，返回报告元数据
+func (convergence *Convergence) Report() map[string]interface{} {
+	histogram := make(map[int]int)
+	var keys []string
+	for k, v := range convergence.converged {
+		histogram[v]++
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var transient []map[string]interface{}
+	for k, v := range keys {
+		if k >= maxTransientKeys {
+			break
+		}
+		transient = append(transient, map[string]interface{}{
+			"Key":    v,
+			"Rounds": convergence.converged[v],
+		})
+	}
+	return map[string]interface{}{
+		"Rounds":             convergence.Rounds,
+		"PersistentKeys":     len(convergence.current),
+		"TransientKeys":      len(convergence.converged),
+		"ConvergedRounds":    histogram,
+		"Transient":          transient,
+		"TransientTruncated": len(keys) > maxTransientKeys,
+	}
+}
@@ -0,0 +1,118 @@
+package compare
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+func TestRecheckPolicyDelay(t *testing.T) {
+	policy := RecheckPolicy{Interval: time.Second, Backoff: 2, MaxInterval: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for k, v := range want {
+		if got := policy.Delay(k); got != v {
+			t.Errorf("round %d got delay %s, want %s", k, got, v)
+		}
+	}
+
+	fixed := RecheckPolicy{Interval: time.Second, Backoff: 1}
+	if fixed.Delay(10) != time.Second {
+		t.Error("backoff 1 should keep interval fixed")
+	}
+}
+
+func TestConvergence(t *testing.T) {
+	convergence := NewConvergence(map[string]bool{"a": true, "b": true, "c": true}, 0, 2)
+	if convergence.Remaining() != 3 {
+		t.Fatalf("got %d remaining keys, want 3", convergence.Remaining())
+	}
+
+	convergence.Update(map[string]bool{"b": true, "c": true})
+	convergence.Update(map[string]bool{"c": true})
+	//c用完复查次数，停止复查
+	if convergence.Remaining() != 0 || convergence.Recheck("c") {
+		t.Errorf("got %d remaining keys, want 0", convergence.Remaining())
+	}
+
+	report := convergence.Report()
+	if report["Rounds"] != 2 || report["PersistentKeys"] != 1 || report["TransientKeys"] != 2 {
+		t.Errorf("got report %v", report)
+	}
+	histogram := report["ConvergedRounds"].(map[int]int)
+	if histogram[1] != 1 || histogram[2] != 1 {
+		t.Errorf("got converged rounds %v", histogram)
+	}
+	transient := report["Transient"].([]map[string]interface{})
+	if len(transient) != 2 || transient[0]["Key"] != "a" || transient[1]["Rounds"] != 2 {
+		t.Errorf("got transient keys %v", transient)
+	}
+
+	//差异为空时立即停止
+	if NewConvergence(map[string]bool{}, 0, 5).Remaining() != 0 {
+		t.Error("empty diff set should not be rechecked")
+	}
+}
+
+func TestConvergenceKeysEnterInDifferentRounds(t *testing.T) {
+	convergence := NewConvergence(map[string]bool{"a": true, "b": true}, 0, 2)
+
+	//第1轮b收敛，c首次出现
+	convergence.Update(map[string]bool{"a": true, "c": true})
+	if !convergence.Recheck("a") || !convergence.Recheck("c") || convergence.Remaining() != 2 {
+		t.Fatalf("got %d remaining keys, want 2", convergence.Remaining())
+	}
+
+	//第2轮a用完复查次数，c仍可复查
+	convergence.Update(map[string]bool{"a": true, "c": true})
+	if convergence.Recheck("a") || !convergence.Recheck("c") || convergence.Remaining() != 1 {
+		t.Fatalf("got %d remaining keys, want 1", convergence.Remaining())
+	}
+
+	//第3轮只复查c，未复查的a保持不一致
+	convergence.Update(map[string]bool{"a": true})
+	if convergence.Remaining() != 0 {
+		t.Errorf("got %d remaining keys, want 0", convergence.Remaining())
+	}
+	report := convergence.Report()
+	if report["Rounds"] != 3 || report["PersistentKeys"] != 1 || report["TransientKeys"] != 2 {
+		t.Errorf("got report %v", report)
+	}
+	//c在第2次复查后收敛
+	histogram := report["ConvergedRounds"].(map[int]int)
+	if histogram[1] != 1 || histogram[2] != 1 {
+		t.Errorf("got converged rounds %v", histogram)
+	}
+}
+
+func TestCompareKeysFromResultFileRecheck(t *testing.T) {
+	compare, source, target := newSampleCompare(t)
+	compare.RecordResult = true
+	source.Set(0, "x", fakeHash{"a": "1"})
+	source.Set(0, "y", fakeHash{"a": "1"})
+	target.Set(0, "x", fakeHash{"a": "2"})
+	target.Set(0, "y", fakeHash{"a": "2"})
+
+	previous := tempResultFile(t)
+	lines := `{"Key":"x","KeyDiffReason":[{"description":"carried"}]}` + "\n" + `{"Key":"y"}` + "\n"
+	if err := ioutil.WriteFile(previous, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//x已用完复查次数，不再比较且原样保留
+	compare.Recheck = func(key string) bool { return key != "x" }
+	if err := compare.CompareKeysFromResultFile(context.Background(), []string{previous}); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(compare.ResultFile)
+	if n := countCalls(source, "0 type x"); n != 0 {
+		t.Errorf("x should not be rechecked, got %d TYPE", n)
+	}
+	got := readResultLines(t, compare.ResultFile)
+	if len(got) != 2 || got[0] != `{"Key":"x","KeyDiffReason":[{"description":"carried"}]}` || gjson.Get(got[1], "Key").String() != "y" {
+		t.Errorf("got result lines %v", got)
+	}
+}
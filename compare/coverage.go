@@ -0,0 +1,117 @@
+package compare
+
+import (
+	"github.com/go-redis/redis/v7"
+	"sync/atomic"
+)
+
+//比较覆盖范围，比较被中断时用于说明部分报告覆盖了多少key
+type Coverage struct {
+	TotalKeys    int64 //开始比较时的DBSIZE，cluster为各master节点之和
+	ScannedKeys  int64 //scan获取并提交比较的key数量
+	ComparedKeys int64 //已完成比较的key数量
+	DiffKeys     int64 //不一致的key数量
+	ErrorKeys    int64 //获取类型出错等无法比较的key数量
+	ScanFinished bool  //scan是否已完成
+
+	finished int32 //ScanFinished的原子副本，供进度输出并发读取
+}
+
+func (coverage *Coverage) Scanned(n int) {
+	if coverage == nil {
+		return
+	}
+	atomic.AddInt64(&coverage.ScannedKeys, int64(n))
+}
+
+func (coverage *Coverage) Compared(n int) {
+	if coverage == nil {
+		return
+	}
+	atomic.AddInt64(&coverage.ComparedKeys, int64(n))
+}
+
+func (coverage *Coverage) Diffs(n int) {
+	if coverage == nil {
+		return
+	}
+	atomic.AddInt64(&coverage.DiffKeys, int64(n))
+}
+
+func (coverage *Coverage) Errors(n int) {
+	if coverage == nil {
+		return
+	}
+	atomic.AddInt64(&coverage.ErrorKeys, int64(n))
+}
+
+//从检查点恢复已完成批次的计数
+func (coverage *Coverage) Resume(state SourceCheckpoint) {
+	atomic.StoreInt64(&coverage.ScannedKeys, state.Scanned)
+	atomic.StoreInt64(&coverage.ComparedKeys, state.Compared)
+	atomic.StoreInt64(&coverage.DiffKeys, state.Diffs)
+	atomic.StoreInt64(&coverage.ErrorKeys, state.Errors)
+}
+
+func (coverage *Coverage) SetScanFinished(finished bool) {
+	coverage.ScanFinished = finished
+	value := int32(0)
+	if finished {
+		value = 1
+	}
+	atomic.StoreInt32(&coverage.finished, value)
+}
+
+func (coverage *Coverage) Finished() bool {
+	return atomic.LoadInt32(&coverage.finished) == 1
+}
+
+//已比较key占DBSIZE的百分比，DBSIZE为0时返回0
+func (coverage *Coverage) Percent() float64 {
+	total := atomic.LoadInt64(&coverage.TotalKeys)
+	if total <= 0 {
+		return 0
+	}
+	percent := float64(atomic.LoadInt64(&coverage.ComparedKeys)) * 100 / float64(total)
+	if percent > 100 {
+		percent = 100
+	}
+	return percent
+}
+
+//报告元数据
+func (coverage *Coverage) Report() map[string]interface{} {
+	report := make(map[string]interface{})
+	report["TotalKeys"] = atomic.LoadInt64(&coverage.TotalKeys)
+	report["ScannedKeys"] = atomic.LoadInt64(&coverage.ScannedKeys)
+	report["ComparedKeys"] = atomic.LoadInt64(&coverage.ComparedKeys)
+	report["DiffKeys"] = atomic.LoadInt64(&coverage.DiffKeys)
+	report["ErrorKeys"] = atomic.LoadInt64(&coverage.ErrorKeys)
+	report["ScanFinished"] = coverage.ScanFinished
+	report["Percent"] = coverage.Percent()
+	return report
+}
+
+//返回cluster各master节点DBSIZE之和
+func ClusterDBSize(client *redis.ClusterClient) int64 {
+	var size int64
+	client.ForEachMaster(func(node *redis.Client) error {
+		atomic.AddInt64(&size, node.DBSize().Val())
+		return nil
+	})
+	return size
+}
+
+//合并多个比较的覆盖范围，用于多源场景的报告汇总
+func MergeCoverage(coverages ...*Coverage) *Coverage {
+	merged := &Coverage{ScanFinished: true}
+	for _, v := range coverages {
+		merged.TotalKeys += atomic.LoadInt64(&v.TotalKeys)
+		merged.ScannedKeys += atomic.LoadInt64(&v.ScannedKeys)
+		merged.ComparedKeys += atomic.LoadInt64(&v.ComparedKeys)
+		merged.DiffKeys += atomic.LoadInt64(&v.DiffKeys)
+		merged.ErrorKeys += atomic.LoadInt64(&v.ErrorKeys)
+		merged.ScanFinished = merged.ScanFinished && v.ScanFinished
+	}
+	return merged
+}
@@ -0,0 +1,84 @@
+package compare
+
+const (
+	DiffMissing = "missing" //源中存在目标中不存在
+	DiffExtra   = "extra"   //目标中存在源中不存在
+	DiffChanged = "changed" //源与目标值不一致
+)
+
+const DefaultMaxDiffPerKey = 100
+
+//全量差异模式下收集单个key的所有差异元素
+type DiffCollector struct {
+	MaxDiff   int //单个key记录差异的上限，超出部分只计数
+	Missing   int64
+	Extra     int64
+	Changed   int64
+	Truncated bool
+	reasons   []interface{}
+}
+
+func NewDiffCollector(maxdiff int) *DiffCollector {
+	if maxdiff <= 0 {
+		maxdiff = DefaultMaxDiffPerKey
+	}
+	return &DiffCollector{
+		MaxDiff: maxdiff,
+	}
+}
+
+//记录一个差异元素，kind取值为DiffMissing、DiffExtra、DiffChanged
+func (collector *DiffCollector) Add(kind string, reason map[string]interface{}) {
+	switch kind {
+	case DiffMissing:
+		collector.Missing++
+	case DiffExtra:
+		collector.Extra++
+	case DiffChanged:
+		collector.Changed++
+	}
+
+	if len(collector.reasons) >= collector.MaxDiff {
+		collector.Truncated = true
+		return
+	}
+	reason["diff"] = kind
+	collector.reasons = append(collector.reasons, reason)
+}
+
+func (collector *DiffCollector) Count() int64 {
+	return collector.Missing + collector.Extra + collector.Changed
+}
+
+func (collector *DiffCollector) Summary() map[string]interface{} {
+	summary := make(map[string]interface{})
+	summary["description"] = ReasonDiffSummary
+	summary[DiffMissing] = collector.Missing
+	summary[DiffExtra] = collector.Extra
+	summary[DiffChanged] = collector.Changed
+	summary["truncated"] = collector.Truncated
+	return summary
+}
+
+//将收集到的差异以及汇总写入CompareResult
+func (collector *DiffCollector) Apply(result *CompareResult) *CompareResult {
+	if collector.Count() == 0 {
+		return result
+	}
+	result.IsEqual = false
+	result.KeyDiffReason = append(result.KeyDiffReason, collector.reasons...)
+	result.KeyDiffReason = append(result.KeyDiffReason, collector.Summary())
+	return result
+}
+
+//合并同一key多个比较步骤的结果
+func MergeCompareResult(result *CompareResult, others ...*CompareResult) *CompareResult {
+	for _, v := range others {
+		if v.IsEqual {
+			continue
+		}
+		result.IsEqual = false
+		result.KeyDiffReason = append(result.KeyDiffReason, v.KeyDiffReason...)
+	}
+	return result
+}
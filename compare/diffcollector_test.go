@@ -0,0 +1,35 @@
+package compare
+
+import "testing"
+
+func TestDiffCollector(t *testing.T) {
+	collector := NewDiffCollector(2)
+	collector.Add(DiffMissing, map[string]interface{}{"member": "a"})
+	collector.Add(DiffExtra, map[string]interface{}{"member": "b"})
+	collector.Add(DiffChanged, map[string]interface{}{"member": "c"})
+
+	if collector.Count() != 3 {
+		t.Errorf("got count %d, want 3", collector.Count())
+	}
+	if !collector.Truncated {
+		t.Error("collector should be truncated")
+	}
+
+	result := NewCompareResult()
+	collector.Apply(&result)
+	if result.IsEqual {
+		t.Error("result should not be equal")
+	}
+	//两条差异加一条汇总
+	if len(result.KeyDiffReason) != 3 {
+		t.Errorf("got %d reasons, want 3", len(result.KeyDiffReason))
+	}
+}
+
+func TestDiffCollectorNoDiff(t *testing.T) {
+	result := NewCompareResult()
+	NewDiffCollector(0).Apply(&result)
+	if !result.IsEqual || len(result.KeyDiffReason) != 0 {
+		t.Error("result without diff should be equal")
+	}
+}
@@ -0,0 +1,155 @@
+package compare
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v7"
+	"sync/atomic"
+)
+
+//lua摘要允许的默认最大元素数量以及string最大字节数
+const (
+	DefaultDigestMaxLength = 10000
+	DefaultDigestMaxSize   = 16 << 20
+)
+
+//按类型以规范顺序计算集合内容的摘要，set与hash排序后计算
+//脚本整体读取key会阻塞服务端，元素数量超过ARGV[1]或string超过ARGV[2]字节以及不支持的类型返回nil
+var digestScript = redis.NewScript(`
+local key = KEYS[1]
+local keytype = redis.call('TYPE', key)['ok']
+local lencmd = {string = 'STRLEN', list = 'LLEN', set = 'SCARD', zset = 'ZCARD', hash = 'HLEN'}
+if lencmd[keytype] == nil then
+	return false
+end
+local limit = tonumber(ARGV[1])
+if keytype == 'string' then
+	limit = tonumber(ARGV[2])
+end
+if redis.call(lencmd[keytype], key) > limit then
+	return false
+end
+local digest = ''
+local function mix(element)
+	digest = redis.sha1hex(digest .. #element .. ':' .. element)
+end
+
+if keytype == 'string' then
+	mix(redis.call('GET', key))
+elseif keytype == 'list' then
+	for _, v in ipairs(redis.call('LRANGE', key, 0, -1)) do
+		mix(v)
+	end
+elseif keytype == 'set' then
+	local members = redis.call('SMEMBERS', key)
+	table.sort(members)
+	for _, v in ipairs(members) do
+		mix(v)
+	end
+elseif keytype == 'zset' then
+	for _, v in ipairs(redis.call('ZRANGE', key, 0, -1, 'WITHSCORES')) do
+		mix(v)
+	end
+elseif keytype == 'hash' then
+	local kvs = redis.call('HGETALL', key)
+	local fields = {}
+	for i = 1, #kvs, 2 do
+		fields[#fields + 1] = i
+	end
+	table.sort(fields, function(a, b) return kvs[a] < kvs[b] end)
+	for _, i in ipairs(fields) do
+		mix(kvs[i])
+		mix(kvs[i + 1])
+	end
+end
+return keytype .. ':' .. digest
+`)
+
+//single与cluster client均满足该接口
+type DigestClient interface {
+	Do(args ...interface{}) *redis.Cmd
+	Eval(script string, keys []string, args ...interface{}) *redis.Cmd
+	EvalSha(sha1 string, keys []string, args ...interface{}) *redis.Cmd
+	ScriptExists(hashes ...string) *redis.BoolSliceCmd
+	ScriptLoad(script string) *redis.StringCmd
+}
+
+//获取key摘要，优先使用DEBUG DIGEST-VALUE，不可用时使用lua脚本，均不可用时放弃
+type KeyDigester struct {
+	MaxLength int64 //lua摘要允许的最大元素数量，0时使用DefaultDigestMaxLength
+	MaxSize   int64 //lua摘要允许的string最大字节数，0时使用DefaultDigestMaxSize
+
+	debugDisabled int32
+	evalDisabled  int32
+}
+
+//返回源与目标key摘要是否一致，ok为false表示无法获取摘要
+func (digester *KeyDigester) Equal(source DigestClient, target DigestClient, sourcekey string, targetkey string) (equal bool, ok bool) {
+	if atomic.LoadInt32(&digester.debugDisabled) == 0 {
+		sdigest, serr := DebugDigest(source, sourcekey)
+		tdigest, terr := DebugDigest(target, targetkey)
+		if serr == nil && terr == nil {
+			return sdigest == tdigest, true
+		}
+		if atomic.CompareAndSwapInt32(&digester.debugDisabled, 0, 1) {
+			zaplogger.Sugar().Info("DEBUG DIGEST-VALUE unavailable, fall back to lua digest: ", serr, terr)
+		}
+	}
+
+	if atomic.LoadInt32(&digester.evalDisabled) == 0 {
+		maxlength, maxsize := digester.limits()
+		sdigest, serr := ScriptDigest(source, sourcekey, maxlength, maxsize)
+		if serr == redis.Nil {
+			return false, false
+		}
+		tdigest, terr := ScriptDigest(target, targetkey, maxlength, maxsize)
+		if serr == nil && terr == nil {
+			return sdigest == tdigest, true
+		}
+		//超过长度上限或类型不支持
+		if terr == redis.Nil {
+			return false, false
+		}
+		if atomic.CompareAndSwapInt32(&digester.evalDisabled, 0, 1) {
+			zaplogger.Sugar().Info("Lua digest unavailable, fall back to element compare: ", serr, terr)
+		}
+	}
+	return false, false
+}
+
+func DebugDigest(client DigestClient, key string) (string, error) {
+	//DEBUG命令不携带key信息，cluster client无法路由到key所在节点
+	if _, ok := client.(*redis.ClusterClient); ok {
+		return "", errors.New("debug digest-value not supported by cluster client")
+	}
+
+	result, err := client.Do("debug", "digest-value", key).Result()
+	if err != nil {
+		return "", err
+	}
+
+	digests, ok := result.([]interface{})
+	if !ok || len(digests) != 1 {
+		return "", errors.New("unexpected debug digest-value reply")
+	}
+	digest, ok := digests[0].(string)
+	if !ok {
+		return "", errors.New("unexpected debug digest-value reply")
+	}
+	return digest, nil
+}
+
+func (digester *KeyDigester) limits() (int64, int64) {
+	maxlength, maxsize := digester.MaxLength, digester.MaxSize
+	if maxlength <= 0 {
+		maxlength = DefaultDigestMaxLength
+	}
+	if maxsize <= 0 {
+		maxsize = DefaultDigestMaxSize
+	}
+	return maxlength, maxsize
+}
+
+//通过lua脚本获取摘要，元素数量超过maxlength或string超过maxsize字节时返回redis.Nil
+func ScriptDigest(client DigestClient, key string, maxlength int64, maxsize int64) (string, error) {
+	return digestScript.Run(client, []string{key}, maxlength, maxsize).Text()
+}
@@ -0,0 +1,79 @@
+package compare
+
+import (
+	"github.com/go-redis/redis/v7"
+	"testing"
+)
+
+func TestDebugDigestClusterClient(t *testing.T) {
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{"127.0.0.1:16379"},
+	})
+	defer client.Close()
+
+	if _, err := DebugDigest(client, "key"); err == nil {
+		t.Error("DebugDigest should not be used with cluster client")
+	}
+}
+
+func digestValues() map[string][2]interface{} {
+	return map[string][2]interface{}{
+		"string": {"abc", "abd"},
+		"list":   {fakeList{"a", "b"}, fakeList{"b", "a"}},
+		"hash":   {fakeHash{"f1": "a", "f2": "b"}, fakeHash{"f1": "a", "f2": "c"}},
+		"set":    {fakeSet{"a": true, "b": true}, fakeSet{"a": true, "c": true}},
+		"zset":   {fakeZset{"a": 1, "b": 2}, fakeZset{"a": 1, "b": 2.5}},
+	}
+}
+
+func TestKeyDigesterEqual(t *testing.T) {
+	for _, debug := range []bool{true, false} {
+		source := newFakeRedis(t)
+		target := newFakeRedis(t)
+		if !debug {
+			//DEBUG不可用时使用lua摘要
+			source.Fail("debug", "ERR DEBUG command not allowed")
+		}
+		digester := &KeyDigester{}
+		for keytype, v := range digestValues() {
+			source.Set(0, keytype, v[0])
+			target.Set(0, keytype, v[0])
+			target.Set(0, keytype+":diff", v[1])
+			if equal, ok := digester.Equal(source.Client(0), target.Client(0), keytype, keytype); !equal || !ok {
+				t.Errorf("debug %v %s got %v, %v, want equal", debug, keytype, equal, ok)
+			}
+			if equal, ok := digester.Equal(source.Client(0), target.Client(0), keytype, keytype+":diff"); equal || !ok {
+				t.Errorf("debug %v %s got %v, %v, want different", debug, keytype, equal, ok)
+			}
+		}
+	}
+}
+
+func TestKeyDigesterScriptLimit(t *testing.T) {
+	source := newFakeRedis(t)
+	target := newFakeRedis(t)
+	source.Fail("debug", "ERR DEBUG command not allowed")
+	source.Set(0, "list", fakeList{"a", "b", "c"})
+	target.Set(0, "list", fakeList{"a", "b", "c"})
+	source.Set(0, "string", "abcdef")
+	target.Set(0, "string", "abcdef")
+
+	//未设置上限时使用默认值
+	digester := &KeyDigester{}
+	if equal, ok := digester.Equal(source.Client(0), target.Client(0), "list", "list"); !equal || !ok {
+		t.Errorf("got %v, %v, want equal", equal, ok)
+	}
+
+	//超过上限的key不计算摘要，且不影响后续key使用lua摘要
+	digester = &KeyDigester{MaxLength: 2, MaxSize: 4}
+	for _, key := range []string{"list", "string"} {
+		if _, ok := digester.Equal(source.Client(0), target.Client(0), key, key); ok {
+			t.Errorf("%s over limit should not be digested", key)
+		}
+	}
+	source.Set(0, "small", fakeList{"a"})
+	target.Set(0, "small", fakeList{"a"})
+	if equal, ok := digester.Equal(source.Client(0), target.Client(0), "small", "small"); !equal || !ok {
+		t.Errorf("got %v, %v, want equal", equal, ok)
+	}
+}
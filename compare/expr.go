@@ -0,0 +1,605 @@
+package compare
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//自定义比较规则的表达式，变量s、t为源与目标value，field为hash field、stream field或zset member，key为源key
+//支持数字、字符串、true/false字面量，运算符|| && ! == != < <= > >= + - * / %以及括号
+//优先级从低到高为|| && ! 比较 +- */% 负号，!作用于整个比较，比较不能连用，括号嵌套不超过maxExprDepth层
+//两端均可转为数字时按数值比较，否则按字符串比较，NaN与任何值都不相等
+//函数：abs(x) num(x) len(x) lower(x) upper(x) trim(x) min(x, y) max(x, y)
+//between(x, lo, hi) match(x, regex) contains(x, sub) prefix(x, p) suffix(x, p)
+type Expr struct {
+	Source string
+	eval   exprFunc
+}
+
+//表达式求值的变量
+type ExprEnv struct {
+	Key    string
+	Field  string
+	Source string
+	Target string
+}
+
+type exprFunc func(env *ExprEnv) (interface{}, error)
+
+//括号、!以及负号的嵌套层数上限
+const maxExprDepth = 100
+
+//编译表达式
+func CompileExpr(source string) (*Expr, error) {
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	parser := &exprParser{tokens: tokens}
+	eval, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression %q", parser.tokens[parser.pos].text, source)
+	}
+	return &Expr{Source: source, eval: eval}, nil
+}
+
+//求值，结果不是bool时返回错误
+func (expr *Expr) Bool(env *ExprEnv) (bool, error) {
+	v, err := expr.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q is not a condition", expr.Source)
+	}
+	return b, nil
+}
+
+const (
+	tokenNumber = iota
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	num  float64
+}
+
+func tokenizeExpr(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(source) && source[i+1] >= '0' && source[i+1] <= '9':
+			j := i
+			for j < len(source) && (source[j] >= '0' && source[j] <= '9' || source[j] == '.' ||
+				source[j] == 'e' || source[j] == 'E' || (source[j] == '+' || source[j] == '-') && (source[j-1] == 'e' || source[j-1] == 'E')) {
+				j++
+			}
+			num, err := strconv.ParseFloat(source[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q in expression", source[i:j])
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: source[i:j], num: num})
+			i = j
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(source) && source[j] != c; j++ {
+				if source[j] == '\\' && j+1 < len(source) {
+					j++
+				}
+				b.WriteByte(source[j])
+			}
+			if j >= len(source) {
+				return nil, errors.New("unterminated string in expression")
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: b.String()})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(source) && (source[j] == '_' || unicode.IsLetter(rune(source[j])) || unicode.IsDigit(rune(source[j]))) {
+				j++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: source[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, v := range []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","} {
+				if strings.HasPrefix(source[i:], v) {
+					op = v
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q in expression", string(c))
+			}
+			tokens = append(tokens, exprToken{kind: tokenOp, text: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	depth  int
+}
+
+//进入一层嵌套，超过上限时返回错误
+func (parser *exprParser) enter() error {
+	parser.depth++
+	if parser.depth > maxExprDepth {
+		return errors.New("expression nested too deep")
+	}
+	return nil
+}
+
+//当前token为指定运算符时前进并返回true
+func (parser *exprParser) accept(op string) bool {
+	if parser.pos < len(parser.tokens) && parser.tokens[parser.pos].kind == tokenOp && parser.tokens[parser.pos].text == op {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func (parser *exprParser) parseOr() (exprFunc, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("||") {
+		l := left
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = func(env *ExprEnv) (interface{}, error) {
+			lv, err := evalBool(l, env)
+			if err != nil || lv {
+				return lv, err
+			}
+			return evalBool(right, env)
+		}
+	}
+	return left, nil
+}
+
+func (parser *exprParser) parseAnd() (exprFunc, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("&&") {
+		l := left
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = func(env *ExprEnv) (interface{}, error) {
+			lv, err := evalBool(l, env)
+			if err != nil || !lv {
+				return lv, err
+			}
+			return evalBool(right, env)
+		}
+	}
+	return left, nil
+}
+
+func (parser *exprParser) parseNot() (exprFunc, error) {
+	if parser.accept("!") {
+		if err := parser.enter(); err != nil {
+			return nil, err
+		}
+		operand, err := parser.parseNot()
+		parser.depth--
+		if err != nil {
+			return nil, err
+		}
+		return func(env *ExprEnv) (interface{}, error) {
+			v, err := evalBool(operand, env)
+			return !v, err
+		}, nil
+	}
+	return parser.parseComparison()
+}
+
+func (parser *exprParser) parseComparison() (exprFunc, error) {
+	left, err := parser.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if parser.accept(op) {
+			right, err := parser.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			operator := op
+			return func(env *ExprEnv) (interface{}, error) {
+				lv, err := left(env)
+				if err != nil {
+					return nil, err
+				}
+				rv, err := right(env)
+				if err != nil {
+					return nil, err
+				}
+				return compareValues(operator, lv, rv)
+			}, nil
+		}
+	}
+	return left, nil
+}
+
+func (parser *exprParser) parseAdditive() (exprFunc, error) {
+	left, err := parser.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		if parser.accept("+") {
+			op = "+"
+		} else if parser.accept("-") {
+			op = "-"
+		} else {
+			return left, nil
+		}
+		right, err := parser.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(op, left, right)
+	}
+}
+
+func (parser *exprParser) parseMultiplicative() (exprFunc, error) {
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		if parser.accept("*") {
+			op = "*"
+		} else if parser.accept("/") {
+			op = "/"
+		} else if parser.accept("%") {
+			op = "%"
+		} else {
+			return left, nil
+		}
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = arithmetic(op, left, right)
+	}
+}
+
+func (parser *exprParser) parseUnary() (exprFunc, error) {
+	if parser.accept("-") {
+		if err := parser.enter(); err != nil {
+			return nil, err
+		}
+		operand, err := parser.parseUnary()
+		parser.depth--
+		if err != nil {
+			return nil, err
+		}
+		return func(env *ExprEnv) (interface{}, error) {
+			v, err := evalNumber(operand, env)
+			return -v, err
+		}, nil
+	}
+	return parser.parsePrimary()
+}
+
+func (parser *exprParser) parsePrimary() (exprFunc, error) {
+	if parser.pos >= len(parser.tokens) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	token := parser.tokens[parser.pos]
+	parser.pos++
+	switch token.kind {
+	case tokenNumber:
+		return func(env *ExprEnv) (interface{}, error) { return token.num, nil }, nil
+	case tokenString:
+		return func(env *ExprEnv) (interface{}, error) { return token.text, nil }, nil
+	case tokenIdent:
+		if parser.accept("(") {
+			if err := parser.enter(); err != nil {
+				return nil, err
+			}
+			call, err := parser.parseCall(token.text)
+			parser.depth--
+			return call, err
+		}
+		return variable(token.text)
+	}
+	if token.text == "(" {
+		if err := parser.enter(); err != nil {
+			return nil, err
+		}
+		inner, err := parser.parseOr()
+		parser.depth--
+		if err != nil {
+			return nil, err
+		}
+		if !parser.accept(")") {
+			return nil, errors.New("missing ) in expression")
+		}
+		return inner, nil
+	}
+	return nil, fmt.Errorf("unexpected %q in expression", token.text)
+}
+
+func variable(name string) (exprFunc, error) {
+	switch name {
+	case "s":
+		return func(env *ExprEnv) (interface{}, error) { return env.Source, nil }, nil
+	case "t":
+		return func(env *ExprEnv) (interface{}, error) { return env.Target, nil }, nil
+	case "field":
+		return func(env *ExprEnv) (interface{}, error) { return env.Field, nil }, nil
+	case "key":
+		return func(env *ExprEnv) (interface{}, error) { return env.Key, nil }, nil
+	case "true":
+		return func(env *ExprEnv) (interface{}, error) { return true, nil }, nil
+	case "false":
+		return func(env *ExprEnv) (interface{}, error) { return false, nil }, nil
+	}
+	return nil, fmt.Errorf("unknown variable %q in expression", name)
+}
+
+func (parser *exprParser) parseCall(name string) (exprFunc, error) {
+	var args []exprFunc
+	var literals []*exprToken
+	if !parser.accept(")") {
+		for {
+			var literal *exprToken
+			start := parser.pos
+			arg, err := parser.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			//参数只有一个字符串token时才视为字面量
+			if parser.pos == start+1 && parser.tokens[start].kind == tokenString {
+				literal = &parser.tokens[start]
+			}
+			args = append(args, arg)
+			literals = append(literals, literal)
+			if parser.accept(")") {
+				break
+			}
+			if !parser.accept(",") {
+				return nil, fmt.Errorf("missing ) after arguments of %s", name)
+			}
+		}
+	}
+
+	arity := map[string]int{"abs": 1, "num": 1, "len": 1, "lower": 1, "upper": 1, "trim": 1, "min": 2, "max": 2,
+		"between": 3, "match": 2, "contains": 2, "prefix": 2, "suffix": 2}
+	n, ok := arity[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q in expression", name)
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("%s takes %d arguments", name, n)
+	}
+
+	switch name {
+	case "abs", "num":
+		return func(env *ExprEnv) (interface{}, error) {
+			v, err := evalNumber(args[0], env)
+			if name == "abs" {
+				v = math.Abs(v)
+			}
+			return v, err
+		}, nil
+	case "len", "lower", "upper", "trim":
+		return func(env *ExprEnv) (interface{}, error) {
+			v, err := evalString(args[0], env)
+			switch name {
+			case "len":
+				return float64(len(v)), err
+			case "lower":
+				return strings.ToLower(v), err
+			case "upper":
+				return strings.ToUpper(v), err
+			}
+			return strings.TrimSpace(v), err
+		}, nil
+	case "min", "max", "between":
+		return func(env *ExprEnv) (interface{}, error) {
+			var nums []float64
+			for _, v := range args {
+				num, err := evalNumber(v, env)
+				if err != nil {
+					return nil, err
+				}
+				nums = append(nums, num)
+			}
+			switch name {
+			case "min":
+				return math.Min(nums[0], nums[1]), nil
+			case "max":
+				return math.Max(nums[0], nums[1]), nil
+			}
+			return nums[0] >= nums[1] && nums[0] <= nums[2], nil
+		}, nil
+	case "match":
+		//正则为字面量时编译期检查
+		var re *regexp.Regexp
+		if literals[1] != nil {
+			compiled, err := regexp.Compile(literals[1].text)
+			if err != nil {
+				return nil, err
+			}
+			re = compiled
+		}
+		return func(env *ExprEnv) (interface{}, error) {
+			v, err := evalString(args[0], env)
+			if err != nil {
+				return nil, err
+			}
+			pattern := re
+			if pattern == nil {
+				p, err := evalString(args[1], env)
+				if err != nil {
+					return nil, err
+				}
+				if pattern, err = regexp.Compile(p); err != nil {
+					return nil, err
+				}
+			}
+			return pattern.MatchString(v), nil
+		}, nil
+	}
+	return func(env *ExprEnv) (interface{}, error) {
+		v, err := evalString(args[0], env)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := evalString(args[1], env)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "contains":
+			return strings.Contains(v, sub), nil
+		case "prefix":
+			return strings.HasPrefix(v, sub), nil
+		}
+		return strings.HasSuffix(v, sub), nil
+	}, nil
+}
+
+func arithmetic(op string, left, right exprFunc) exprFunc {
+	return func(env *ExprEnv) (interface{}, error) {
+		lv, err := evalNumber(left, env)
+		if err != nil {
+			return nil, err
+		}
+		rv, err := evalNumber(right, env)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "+":
+			return lv + rv, nil
+		case "-":
+			return lv - rv, nil
+		case "*":
+			return lv * rv, nil
+		case "/":
+			return lv / rv, nil
+		}
+		return math.Mod(lv, rv), nil
+	}
+}
+
+//两端均可转为数字时按数值比较，否则按字符串比较
+func compareValues(op string, left, right interface{}) (interface{}, error) {
+	lb, lok := left.(bool)
+	rb, rok := right.(bool)
+	if lok || rok {
+		if !lok || !rok || (op != "==" && op != "!=") {
+			return nil, fmt.Errorf("invalid comparison %v %s %v", left, op, right)
+		}
+		return (lb == rb) == (op == "=="), nil
+	}
+
+	var c int
+	ln, lerr := toNumber(left)
+	rn, rerr := toNumber(right)
+	if lerr == nil && rerr == nil {
+		if math.IsNaN(ln) || math.IsNaN(rn) {
+			return op == "!=", nil
+		}
+		switch {
+		case ln < rn:
+			c = -1
+		case ln > rn:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(fmt.Sprint(left), fmt.Sprint(right))
+	}
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func toNumber(v interface{}) (float64, error) {
+	switch value := v.(type) {
+	case float64:
+		return value, nil
+	case string:
+		num, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", value)
+		}
+		return num, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+func evalNumber(f exprFunc, env *ExprEnv) (float64, error) {
+	v, err := f(env)
+	if err != nil {
+		return 0, err
+	}
+	return toNumber(v)
+}
+
+func evalString(f exprFunc, env *ExprEnv) (string, error) {
+	v, err := f(env)
+	if err != nil {
+		return "", err
+	}
+	if num, ok := v.(float64); ok {
+		return strconv.FormatFloat(num, 'g', -1, 64), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+func evalBool(f exprFunc, env *ExprEnv) (bool, error) {
+	v, err := f(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%v is not a condition", v)
+	}
+	return b, nil
+}
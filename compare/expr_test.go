@@ -0,0 +1,232 @@
+package compare
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExprBool(t *testing.T) {
+	env := &ExprEnv{Key: "user:1", Field: "updated_at", Source: "100.5", Target: "101"}
+	cases := map[string]bool{
+		`abs(s - t) <= 1`:                              true,
+		`abs(s - t) < 0.5`:                             false,
+		`between(t, 100, 200) && s != t`:               true,
+		`num(s) * 2 == 201`:                            true,
+		`-s + 1 < 0`:                                   true,
+		`10 % 3 == 1`:                                  true,
+		`min(s, t) == 100.5 && max(s, t) == 101`:       true,
+		`"10" == "1e1"`:                                true,
+		`"abc" < "abd"`:                                true,
+		`match(field, "^updated_")`:                    true,
+		`match(key, "^order:")`:                        false,
+		`prefix(key, "user:") && suffix(field, "_at")`: true,
+		`contains(upper(field), "AT")`:                 true,
+		`len(trim(" ab ")) == 2 && lower("A") == "a"`:  true,
+		`!(s == t) || false`:                           true,
+		`true == (1 < 2)`:                              true,
+	}
+	for k, v := range cases {
+		expr, err := CompileExpr(k)
+		if err != nil {
+			t.Errorf("compile %s: %v", k, err)
+			continue
+		}
+		got, err := expr.Bool(env)
+		if err != nil || got != v {
+			t.Errorf("%s got %v, %v, want %v", k, got, err, v)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, v := range []string{`s ==`, `(s == t`, `foo(s)`, `abs(s, t)`, `x == 1`, `match(s, "[")`, `"abc`, `s == t)`, `s # t`} {
+		if _, err := CompileExpr(v); err == nil {
+			t.Errorf("%s should fail to compile", v)
+		}
+	}
+
+	//非数字的算术运算以及非bool结果求值失败
+	env := &ExprEnv{Source: "abc", Target: "1"}
+	for _, v := range []string{`s + 1 == 2`, `t + 1`, `true < false`, `s && true`} {
+		expr, err := CompileExpr(v)
+		if err != nil {
+			t.Fatalf("compile %s: %v", v, err)
+		}
+		if _, err := expr.Bool(env); err == nil {
+			t.Errorf("%s should fail to evaluate", v)
+		}
+	}
+
+	//短路求值时右侧不会出错
+	expr, _ := CompileExpr(`t == 1 || s + 1 == 2`)
+	if ok, err := expr.Bool(env); !ok || err != nil {
+		t.Errorf("got %v, %v", ok, err)
+	}
+}
+
+func evalExpr(t *testing.T, source string, env *ExprEnv) (bool, error) {
+	expr, err := CompileExpr(source)
+	if err != nil {
+		t.Fatalf("compile %s: %v", source, err)
+	}
+	return expr.Bool(env)
+}
+
+func TestExprPrecedence(t *testing.T) {
+	env := &ExprEnv{Source: "3", Target: "4"}
+	cases := map[string]bool{
+		`1 + 2 * 3 == 7`:            true,
+		`(1 + 2) * 3 == 9`:          true,
+		`10 - 4 - 3 == 3`:           true,
+		`100 / 10 / 5 == 2`:         true,
+		`2 * 3 % 4 == 2`:            true,
+		`-2 * 3 == -6`:              true,
+		`- -2 == 2`:                 true,
+		`-(1 + 2) == -3`:            true,
+		`s + t * 2 == 11`:           true,
+		`true || false && false`:    true,
+		`false && false || true`:    true,
+		`!false && false`:           false,
+		`!(false && false)`:         true,
+		`!1 == 2`:                   true,
+		`!!true`:                    true,
+		`(s < t) == true`:           true,
+		`1 + 1 == 2 && 2 * 2 == 4`:  true,
+		`s == 3 || t == 3 && false`: true,
+	}
+	for k, v := range cases {
+		expr, err := CompileExpr(k)
+		if err != nil {
+			t.Errorf("compile %s: %v", k, err)
+			continue
+		}
+		got, err := expr.Bool(env)
+		if err != nil || got != v {
+			t.Errorf("%s got %v, %v, want %v", k, got, err, v)
+		}
+	}
+	//比较不能连用
+	if _, err := CompileExpr(`s < t == true`); err == nil {
+		t.Error("chained comparison should fail to compile")
+	}
+}
+
+func TestExprShortCircuit(t *testing.T) {
+	//右侧求值会出错，短路时不求值
+	env := &ExprEnv{Source: "abc", Target: "["}
+	for k, v := range map[string]bool{
+		`false && s + 1 == 2`:          false,
+		`true || s + 1 == 2`:           true,
+		`false && match(s, t)`:         false,
+		`s == "abc" || abs(s) == 1`:    true,
+		`(false && s) || !(true || s)`: false,
+	} {
+		got, err := evalExpr(t, k, env)
+		if err != nil || got != v {
+			t.Errorf("%s got %v, %v, want %v", k, got, err, v)
+		}
+	}
+	for _, v := range []string{`true && s + 1 == 2`, `false || s + 1 == 2`, `true && match(s, t)`} {
+		if _, err := evalExpr(t, v, env); err == nil {
+			t.Errorf("%s should fail to evaluate", v)
+		}
+	}
+}
+
+func TestExprTypes(t *testing.T) {
+	env := &ExprEnv{Source: "abc", Target: "1", Field: "["}
+	for _, v := range []string{
+		`s * 2 == 1`,
+		`-s < 0`,
+		`abs(s) == 1`,
+		`min(s, 1) == 1`,
+		`between(1, s, 2)`,
+		`1 + 1`,
+		`len(s)`,
+		`s`,
+		`true < false`,
+		`true == 1`,
+		`1 != false`,
+		`s && true`,
+		`!s`,
+		`match(s, field)`,
+		//字面量参与运算时不作为预编译的正则
+		`match(s, "a" + "b")`,
+	} {
+		if _, err := evalExpr(t, v, env); err == nil {
+			t.Errorf("%s should fail to evaluate", v)
+		}
+	}
+
+	for k, v := range map[string]bool{
+		`"abc" == s`:            true,
+		`t == 1.0`:              true,
+		`t == " 1.0 "`:          true,
+		`s > 1`:                 true,
+		`len(s) == 3`:           true,
+		`upper(1.5) == "1.5"`:   true,
+		`lower(true) == "true"`: true,
+		`match(t + 1, "^2$")`:   true,
+	} {
+		got, err := evalExpr(t, k, env)
+		if err != nil || got != v {
+			t.Errorf("%s got %v, %v, want %v", k, got, err, v)
+		}
+	}
+}
+
+func TestExprNaN(t *testing.T) {
+	env := &ExprEnv{Source: "NaN", Target: "nan", Field: "inf"}
+	for k, v := range map[string]bool{
+		`s == t`:          false,
+		`s != t`:          true,
+		`s == 1`:          false,
+		`s < 1 || s >= 1`: false,
+		`0 / 0 == 0 / 0`:  false,
+		`abs(s - t) <= 1`: false,
+		`field > 1e308`:   true,
+		`1 / 0 == field`:  true,
+	} {
+		got, err := evalExpr(t, k, env)
+		if err != nil || got != v {
+			t.Errorf("%s got %v, %v, want %v", k, got, err, v)
+		}
+	}
+}
+
+func TestExprSyntax(t *testing.T) {
+	env := &ExprEnv{}
+	for _, v := range []string{
+		`"a\"b" == 'a"b'`,
+		`'it\'s' == "it's"`,
+		`.5 == 0.5`,
+		`1e3 == 1000`,
+		`1E+3 == 1000`,
+		`2.5e-1 == 0.25`,
+		"\t1\n==\r1 ",
+	} {
+		if got, err := evalExpr(t, v, env); err != nil || !got {
+			t.Errorf("%s got %v, %v", v, got, err)
+		}
+	}
+
+	for _, v := range []string{`1 < 2 < 3`, `1..2`, `s == t &&`, `()`, `abs()`, `min(1,)`, `match(s, "(")`, `"a" "b"`, `s = t`, `s & t`} {
+		if _, err := CompileExpr(v); err == nil {
+			t.Errorf("%s should fail to compile", v)
+		}
+	}
+
+	//嵌套层数上限
+	nested := func(n int) string {
+		return strings.Repeat("(", n) + "true" + strings.Repeat(")", n)
+	}
+	if _, err := CompileExpr(nested(maxExprDepth)); err != nil {
+		t.Error(err)
+	}
+	for _, v := range []string{nested(maxExprDepth + 1), strings.Repeat("!", maxExprDepth+1) + "true", strings.Repeat("-", maxExprDepth+1) + "1 == 1",
+		strings.Repeat("abs(", maxExprDepth+1) + "1" + strings.Repeat(")", maxExprDepth+1) + " == 1"} {
+		if _, err := CompileExpr(v); err == nil || !strings.Contains(err.Error(), "too deep") {
+			t.Errorf("got %v", err)
+		}
+	}
+}
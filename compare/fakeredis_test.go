@@ -0,0 +1,699 @@
+package compare
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+//测试用的内存redis服务端，只实现测试用到的命令
+type fakeRedis struct {
+	t         *testing.T
+	listener  net.Listener
+	mu        sync.Mutex
+	dbs       map[int]map[string]interface{}
+	ttls      map[int]map[string]int64
+	fail      map[string]string        //命令名到错误信息，用于模拟服务端错误
+	calls     []string                 //收到的命令，按"db command key"记录
+	info      string                   //INFO命令的返回内容
+	randomkey int                      //RANDOMKEY轮流返回key的位置
+	block     map[string]chan struct{} //命令名到阻塞channel，用于模拟慢命令
+}
+
+type fakeSet map[string]bool
+type fakeZset map[string]float64
+type fakeHash map[string]string
+type fakeList []string
+
+type fakeStream struct {
+	entries []redis.XMessage
+	lastID  string
+	groups  []map[string]interface{} //XINFO GROUPS的字段
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeRedis{
+		t:        t,
+		listener: listener,
+		dbs:      make(map[int]map[string]interface{}),
+		ttls:     make(map[int]map[string]int64),
+		fail:     make(map[string]string),
+		block:    make(map[string]chan struct{}),
+	}
+	go server.serve()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *fakeRedis) Addr() string {
+	return server.listener.Addr().String()
+}
+
+func (server *fakeRedis) Client(db int) *redis.Client {
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), DB: db, MaxRetries: -1})
+	server.t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func (server *fakeRedis) Close() {
+	server.listener.Close()
+}
+
+func (server *fakeRedis) Set(db int, key string, value interface{}) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.db(db)[key] = value
+}
+
+func (server *fakeRedis) Get(db int, key string) interface{} {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.db(db)[key]
+}
+
+func (server *fakeRedis) SetTTL(db int, key string, ms int64) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.ttls[db] == nil {
+		server.ttls[db] = make(map[string]int64)
+	}
+	server.ttls[db][key] = ms
+}
+
+func (server *fakeRedis) SetInfo(info string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.info = info
+}
+
+func (server *fakeRedis) Fail(command string, message string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	//message为空时恢复正常
+	if message == "" {
+		delete(server.fail, command)
+		return
+	}
+	server.fail[command] = message
+}
+
+//阻塞该命令直到调用返回的函数
+func (server *fakeRedis) Block(command string) func() {
+	ch := make(chan struct{})
+	server.mu.Lock()
+	server.block[command] = ch
+	server.mu.Unlock()
+	return func() {
+		server.mu.Lock()
+		delete(server.block, command)
+		server.mu.Unlock()
+		close(ch)
+	}
+}
+
+func (server *fakeRedis) Calls() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]string(nil), server.calls...)
+}
+
+func (server *fakeRedis) db(db int) map[string]interface{} {
+	if server.dbs[db] == nil {
+		server.dbs[db] = make(map[string]interface{})
+	}
+	return server.dbs[db]
+}
+
+func (server *fakeRedis) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.handle(conn)
+	}
+}
+
+func (server *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	db := 0
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToLower(args[0])
+		if name == "select" && len(args) == 2 {
+			db, _ = strconv.Atoi(args[1])
+			writeReply(writer, "OK")
+		} else {
+			writeReply(writer, server.exec(db, name, args[1:]))
+		}
+		if writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimRight(header, "\r\n")[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+//string为状态回复，[]byte为bulk回复，nil为空回复
+func writeReply(writer *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		writer.WriteString("$-1\r\n")
+	case error:
+		writer.WriteString("-" + v.Error() + "\r\n")
+	case string:
+		writer.WriteString("+" + v + "\r\n")
+	case []byte:
+		writer.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + string(v) + "\r\n")
+	case int64:
+		writer.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case int:
+		writer.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case []interface{}:
+		writer.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeReply(writer, e)
+		}
+	case []string:
+		writer.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeReply(writer, []byte(e))
+		}
+	default:
+		panic(fmt.Sprintf("unsupported reply %T", reply))
+	}
+}
+
+func (server *fakeRedis) exec(db int, name string, args []string) interface{} {
+	server.mu.Lock()
+	block := server.block[name]
+	server.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	call := strconv.Itoa(db) + " " + name
+	if len(args) > 0 {
+		call += " " + args[0]
+	}
+	server.calls = append(server.calls, call)
+	if message, ok := server.fail[name]; ok {
+		return errors.New(message)
+	}
+
+	data := server.db(db)
+	var value interface{}
+	if len(args) > 0 {
+		value = data[args[0]]
+	}
+	wrongtype := errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+	switch name {
+	case "ping":
+		return "PONG"
+	case "info":
+		return []byte(server.info)
+	case "exists":
+		n := 0
+		for _, v := range args {
+			if _, ok := data[v]; ok {
+				n++
+			}
+		}
+		return n
+	case "del":
+		n := 0
+		for _, v := range args {
+			if _, ok := data[v]; ok {
+				delete(data, v)
+				n++
+			}
+		}
+		return n
+	case "type":
+		return fakeType(value)
+	case "dbsize":
+		return len(data)
+	case "randomkey":
+		//按key顺序轮流返回，结果可复现
+		if len(data) == 0 {
+			return nil
+		}
+		keys := sortedKeys(data)
+		server.randomkey++
+		return []byte(keys[server.randomkey%len(keys)])
+	case "scan":
+		//一次返回全部匹配的key，支持MATCH以及TYPE
+		match, keytype := "*", ""
+		for i := 1; i+1 < len(args); i += 2 {
+			switch strings.ToLower(args[i]) {
+			case "match":
+				match = args[i+1]
+			case "type":
+				keytype = args[i+1]
+			}
+		}
+		keys := []string{}
+		for _, k := range sortedKeys(data) {
+			if ok, _ := path.Match(match, k); ok && (keytype == "" || fakeType(data[k]) == keytype) {
+				keys = append(keys, k)
+			}
+		}
+		return []interface{}{[]byte("0"), keys}
+	case "pttl":
+		if value == nil {
+			return -2
+		}
+		if ms, ok := server.ttls[db][args[0]]; ok {
+			return ms
+		}
+		return -1
+	case "get", "strlen":
+		if value == nil {
+			if name == "strlen" {
+				return 0
+			}
+			return nil
+		}
+		s, ok := value.(string)
+		if !ok {
+			return wrongtype
+		}
+		if name == "strlen" {
+			return len(s)
+		}
+		return []byte(s)
+	case "set":
+		data[args[0]] = args[1]
+		return "OK"
+	case "dump":
+		if value == nil {
+			return nil
+		}
+		return []byte("fake-payload")
+	case "restore":
+		//不解析payload，模拟RDB版本不兼容
+		return errors.New("ERR DUMP payload version or checksum are wrong")
+	case "rename":
+		if value == nil {
+			return errors.New("ERR no such key")
+		}
+		delete(data, args[0])
+		data[args[1]] = value
+		delete(server.ttls[db], args[1])
+		if ms, ok := server.ttls[db][args[0]]; ok {
+			delete(server.ttls[db], args[0])
+			server.ttls[db][args[1]] = ms
+		}
+		return "OK"
+	case "pexpireat":
+		if value == nil {
+			return 0
+		}
+		at, _ := strconv.ParseInt(args[1], 10, 64)
+		if server.ttls[db] == nil {
+			server.ttls[db] = make(map[string]int64)
+		}
+		server.ttls[db][args[0]] = at - time.Now().UnixNano()/int64(time.Millisecond)
+		return 1
+	case "hmset":
+		h, ok := value.(fakeHash)
+		if !ok && value != nil {
+			return wrongtype
+		}
+		if h == nil {
+			h = fakeHash{}
+			data[args[0]] = h
+		}
+		for i := 1; i+1 < len(args); i += 2 {
+			h[args[i]] = args[i+1]
+		}
+		return "OK"
+	case "hlen", "hget", "hexists", "hrandfield", "hscan", "hgetall":
+		h, ok := value.(fakeHash)
+		if !ok && value != nil {
+			return wrongtype
+		}
+		switch name {
+		case "hlen":
+			return len(h)
+		case "hget":
+			if v, ok := h[args[1]]; ok {
+				return []byte(v)
+			}
+			return nil
+		case "hexists":
+			if _, ok := h[args[1]]; ok {
+				return 1
+			}
+			return 0
+		case "hrandfield":
+			count, _ := strconv.Atoi(args[1])
+			var reply []string
+			for _, k := range sortedKeys(h) {
+				if len(reply) >= count*2 {
+					break
+				}
+				reply = append(reply, k, h[k])
+			}
+			return reply
+		}
+		var reply []string
+		for _, k := range sortedKeys(h) {
+			reply = append(reply, k, h[k])
+		}
+		if name == "hgetall" {
+			return reply
+		}
+		return []interface{}{[]byte("0"), reply}
+	case "scard", "sismember", "srandmember", "sscan", "smembers":
+		s, ok := value.(fakeSet)
+		if !ok && value != nil {
+			return wrongtype
+		}
+		switch name {
+		case "scard":
+			return len(s)
+		case "sismember":
+			if s[args[1]] {
+				return 1
+			}
+			return 0
+		case "srandmember":
+			count, _ := strconv.Atoi(args[1])
+			members := sortedKeys(s)
+			if len(members) > count {
+				members = members[:count]
+			}
+			return members
+		case "smembers":
+			return sortedKeys(s)
+		}
+		return []interface{}{[]byte("0"), sortedKeys(s)}
+	case "zcard", "zscore", "zscan", "zrandmember":
+		z, ok := value.(fakeZset)
+		if !ok && value != nil {
+			return wrongtype
+		}
+		switch name {
+		case "zcard":
+			return len(z)
+		case "zscore":
+			if score, ok := z[args[1]]; ok {
+				return []byte(strconv.FormatFloat(score, 'g', -1, 64))
+			}
+			return nil
+		}
+		count := len(z)
+		if name == "zrandmember" {
+			count, _ = strconv.Atoi(args[1])
+		}
+		var reply []string
+		for _, k := range sortedKeys(z) {
+			if len(reply) >= count*2 {
+				break
+			}
+			reply = append(reply, k, strconv.FormatFloat(z[k], 'g', -1, 64))
+		}
+		if name == "zrandmember" {
+			return reply
+		}
+		return []interface{}{[]byte("0"), reply}
+	case "llen", "lrange":
+		l, ok := value.(fakeList)
+		if !ok && value != nil {
+			return wrongtype
+		}
+		if name == "llen" {
+			return len(l)
+		}
+		start, _ := strconv.Atoi(args[1])
+		stop, _ := strconv.Atoi(args[2])
+		if stop < 0 || stop >= len(l) {
+			stop = len(l) - 1
+		}
+		if start >= len(l) || start > stop {
+			return []string{}
+		}
+		return []string(l[start : stop+1])
+	case "xrange":
+		st, ok := value.(*fakeStream)
+		if !ok && value != nil {
+			return wrongtype
+		}
+		count := -1
+		if len(args) == 5 {
+			count, _ = strconv.Atoi(args[4])
+		}
+		reply := []interface{}{}
+		for _, v := range st.rangeFrom(args[1]) {
+			if count >= 0 && len(reply) >= count {
+				break
+			}
+			var fields []string
+			for _, k := range sortedKeys(v.Values) {
+				fields = append(fields, k, v.Values[k].(string))
+			}
+			reply = append(reply, []interface{}{[]byte(v.ID), fields})
+		}
+		return reply
+	case "xinfo":
+		st, ok := data[args[1]].(*fakeStream)
+		if !ok {
+			return errors.New("ERR no such key")
+		}
+		if strings.ToLower(args[0]) == "stream" {
+			return []interface{}{[]byte("length"), len(st.entries), []byte("last-generated-id"), []byte(st.lastID)}
+		}
+		reply := []interface{}{}
+		for _, group := range st.groups {
+			var fields []interface{}
+			for _, k := range sortedKeys(group) {
+				fields = append(fields, []byte(k))
+				switch v := group[k].(type) {
+				case string:
+					fields = append(fields, []byte(v))
+				default:
+					fields = append(fields, v)
+				}
+			}
+			reply = append(reply, fields)
+		}
+		return reply
+	case "debug":
+		//DEBUG DIGEST-VALUE
+		value = data[args[1]]
+		if value == nil {
+			return []string{strings.Repeat("0", 40)}
+		}
+		return []string{fakeDigest(value)}
+	case "script":
+		switch strings.ToLower(args[0]) {
+		case "load":
+			return []byte(digestScript.Hash())
+		case "exists":
+			return []interface{}{1}
+		}
+	case "evalsha", "eval":
+		if name == "evalsha" && args[0] != digestScript.Hash() {
+			return errors.New("NOSCRIPT No matching script")
+		}
+		n, _ := strconv.Atoi(args[1])
+		return server.scriptDigest(data, args[2], args[2+n:])
+	}
+	return fmt.Errorf("ERR unknown command '%s'", name)
+}
+
+//模拟digestScript，超过长度上限以及不支持的类型返回空回复
+func (server *fakeRedis) scriptDigest(data map[string]interface{}, key string, argv []string) interface{} {
+	value := data[key]
+	maxlength, _ := strconv.Atoi(argv[0])
+	maxsize, _ := strconv.Atoi(argv[1])
+	length := 0
+	switch v := value.(type) {
+	case string:
+		if len(v) > maxsize {
+			return nil
+		}
+	case fakeList:
+		length = len(v)
+	case fakeHash:
+		length = len(v)
+	case fakeSet:
+		length = len(v)
+	case fakeZset:
+		length = len(v)
+	default:
+		return nil
+	}
+	if length > maxlength {
+		return nil
+	}
+	return []byte(fakeType(value) + ":" + fakeDigest(value))
+}
+
+func (st *fakeStream) rangeFrom(start string) []redis.XMessage {
+	if start == "-" {
+		return st.entries
+	}
+	for k, v := range st.entries {
+		if compareStreamIDs(v.ID, start) >= 0 {
+			return st.entries[k:]
+		}
+	}
+	return nil
+}
+
+func compareStreamIDs(a, b string) int {
+	parse := func(id string) (int64, int64) {
+		parts := strings.SplitN(id, "-", 2)
+		ms, _ := strconv.ParseInt(parts[0], 10, 64)
+		var seq int64
+		if len(parts) == 2 {
+			seq, _ = strconv.ParseInt(parts[1], 10, 64)
+		}
+		return ms, seq
+	}
+	ams, aseq := parse(a)
+	bms, bseq := parse(b)
+	switch {
+	case ams != bms:
+		if ams < bms {
+			return -1
+		}
+		return 1
+	case aseq < bseq:
+		return -1
+	case aseq > bseq:
+		return 1
+	}
+	return 0
+}
+
+func fakeType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "none"
+	case string:
+		return "string"
+	case fakeList:
+		return "list"
+	case fakeHash:
+		return "hash"
+	case fakeSet:
+		return "set"
+	case fakeZset:
+		return "zset"
+	case *fakeStream:
+		return "stream"
+	}
+	return "none"
+}
+
+//按规范顺序计算value的摘要
+func fakeDigest(value interface{}) string {
+	var elements []string
+	switch v := value.(type) {
+	case string:
+		elements = []string{v}
+	case fakeList:
+		elements = v
+	case fakeSet:
+		elements = sortedKeys(v)
+	case fakeHash:
+		for _, k := range sortedKeys(v) {
+			elements = append(elements, k, v[k])
+		}
+	case fakeZset:
+		for _, k := range sortedKeys(v) {
+			elements = append(elements, k, strconv.FormatFloat(v[k], 'g', -1, 64))
+		}
+	}
+	digest := ""
+	for _, v := range elements {
+		sum := sha1.Sum([]byte(digest + strconv.Itoa(len(v)) + ":" + v))
+		digest = hex.EncodeToString(sum[:])
+	}
+	return digest
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case fakeHash:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case fakeSet:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case fakeZset:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]interface{}:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,387 @@
+package compare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v7"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	HealthStatusHealthy = "healthy"
+	HealthStatusSlow    = "slow"    //超过阈值，worker每处理一个key前等待SlowDelay
+	HealthStatusPaused  = "paused"  //超过阈值的PauseRatio倍，worker暂停直到恢复
+	HealthStatusAborted = "aborted" //持续不健康超过AbortAfter，比较中止
+)
+
+const (
+	DefaultHealthInterval = 5 * time.Second
+	DefaultSlowDelay      = 10 * time.Millisecond
+	DefaultPauseRatio     = 1.5
+)
+
+//服务端健康阈值，0表示不检查该项
+type HealthThreshold struct {
+	MaxOpsPerSec  int64 //INFO stats中的instantaneous_ops_per_sec
+	MaxClients    int64 //INFO clients中的connected_clients
+	MaxUsedMemory int64 //INFO memory中的used_memory，单位byte
+	MaxLatency    int64 //PING延迟，单位millisecond
+}
+
+func (threshold HealthThreshold) Enabled() bool {
+	return threshold.MaxOpsPerSec > 0 || threshold.MaxClients > 0 || threshold.MaxUsedMemory > 0 || threshold.MaxLatency > 0
+}
+
+//节流状态变化事件，写入报告用于解释比较耗时
+type ThrottleEvent struct {
+	Time   string
+	Server string
+	Status string
+	Reason string
+}
+
+//后台轮询源与目标的INFO以及PING延迟，超过阈值时减慢或暂停比较，持续不健康时中止
+type HealthMonitor struct {
+	Threshold  HealthThreshold
+	Interval   time.Duration //轮询间隔
+	SlowDelay  time.Duration //减速状态下每个key的等待时间
+	PauseRatio float64       //指标超过阈值该倍数时暂停
+	AbortAfter time.Duration //持续不健康超过该时长时中止，0表示不中止
+
+	servers        []healthServer
+	status         atomic.Value
+	unhealthySince time.Time
+	abortReason    string
+	events         []ThrottleEvent
+	mu             sync.Mutex
+	cond           *sync.Cond
+	stop           chan struct{}
+	stopOnce       sync.Once
+	probes         map[string]*redis.Client //按节点地址与DB缓存的探测client
+	probeMu        sync.Mutex
+}
+
+type healthServer struct {
+	name  string
+	nodes func() []*redis.Client
+}
+
+//阈值均为0时返回nil
+func NewHealthMonitor(threshold HealthThreshold, interval time.Duration, abortafter time.Duration) *HealthMonitor {
+	if !threshold.Enabled() {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+
+	monitor := &HealthMonitor{
+		Threshold:  threshold,
+		Interval:   interval,
+		SlowDelay:  DefaultSlowDelay,
+		PauseRatio: DefaultPauseRatio,
+		AbortAfter: abortafter,
+		stop:       make(chan struct{}),
+	}
+	monitor.cond = sync.NewCond(&monitor.mu)
+	monitor.status.Store(HealthStatusHealthy)
+	return monitor
+}
+
+func (monitor *HealthMonitor) AddClient(name string, client *redis.Client) {
+	if monitor == nil || client == nil {
+		return
+	}
+	monitor.servers = append(monitor.servers, healthServer{
+		name: name,
+		nodes: func() []*redis.Client {
+			return []*redis.Client{client}
+		},
+	})
+}
+
+//cluster按master节点分别检查，节点列表每次轮询时重新获取
+func (monitor *HealthMonitor) AddCluster(name string, client *redis.ClusterClient) {
+	if monitor == nil || client == nil {
+		return
+	}
+	monitor.servers = append(monitor.servers, healthServer{
+		name: name,
+		nodes: func() []*redis.Client {
+			var mu sync.Mutex
+			var nodes []*redis.Client
+			client.ForEachMaster(func(node *redis.Client) error {
+				mu.Lock()
+				nodes = append(nodes, node)
+				mu.Unlock()
+				return nil
+			})
+			return nodes
+		},
+	})
+}
+
+func (monitor *HealthMonitor) Start() {
+	if monitor == nil {
+		return
+	}
+	monitor.Check()
+	go func() {
+		ticker := time.NewTicker(monitor.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-monitor.stop:
+				return
+			case <-ticker.C:
+				monitor.Check()
+			}
+		}
+	}()
+}
+
+func (monitor *HealthMonitor) Stop() {
+	if monitor == nil {
+		return
+	}
+	monitor.stopOnce.Do(func() {
+		close(monitor.stop)
+	})
+	monitor.probeMu.Lock()
+	defer monitor.probeMu.Unlock()
+	for k, v := range monitor.probes {
+		v.Close()
+		delete(monitor.probes, k)
+	}
+}
+
+//返回节点的探测client，比较使用的client挂载了限速等hook，PING延迟会包含限速等待
+func (monitor *HealthMonitor) probe(node *redis.Client) *redis.Client {
+	opt := *node.Options()
+	id := opt.Addr + "/" + strconv.Itoa(opt.DB)
+	monitor.probeMu.Lock()
+	defer monitor.probeMu.Unlock()
+	if client, ok := monitor.probes[id]; ok {
+		return client
+	}
+	if monitor.probes == nil {
+		monitor.probes = make(map[string]*redis.Client)
+	}
+	opt.PoolSize = 1
+	opt.MinIdleConns = 0
+	client := redis.NewClient(&opt)
+	monitor.probes[id] = client
+	return client
+}
+
+//检查所有服务端并更新状态，返回最严重的超限比例以及原因
+func (monitor *HealthMonitor) Check() {
+	worstratio := float64(0)
+	worstserver := ""
+	worstreason := ""
+	for _, server := range monitor.servers {
+		for _, node := range server.nodes() {
+			ratio, reason := monitor.checkNode(node)
+			if ratio > worstratio {
+				worstratio = ratio
+				worstserver = server.name + " " + node.Options().Addr
+				worstreason = reason
+			}
+		}
+	}
+
+	status := HealthStatusHealthy
+	if worstratio >= monitor.PauseRatio {
+		status = HealthStatusPaused
+	} else if worstratio >= 1 {
+		status = HealthStatusSlow
+	}
+	monitor.setStatus(status, worstserver, worstreason)
+}
+
+//返回节点各项指标相对阈值的最大比例，无法获取指标时视为暂停
+func (monitor *HealthMonitor) checkNode(node *redis.Client) (float64, string) {
+	node = monitor.probe(node)
+	ratio := float64(0)
+	reason := ""
+	exceed := func(name string, value int64, threshold int64) {
+		if threshold <= 0 {
+			return
+		}
+		r := float64(value) / float64(threshold)
+		if r > ratio {
+			ratio = r
+			reason = fmt.Sprintf("%s %d exceeds %d", name, value, threshold)
+		}
+	}
+
+	begin := time.Now()
+	if err := node.Ping().Err(); err != nil {
+		return monitor.PauseRatio, "ping error: " + err.Error()
+	}
+	exceed("ping latency ms", time.Since(begin).Milliseconds(), monitor.Threshold.MaxLatency)
+
+	sections := []struct {
+		section   string
+		field     string
+		threshold int64
+	}{
+		{"stats", "instantaneous_ops_per_sec", monitor.Threshold.MaxOpsPerSec},
+		{"clients", "connected_clients", monitor.Threshold.MaxClients},
+		{"memory", "used_memory", monitor.Threshold.MaxUsedMemory},
+	}
+	for _, v := range sections {
+		if v.threshold <= 0 {
+			continue
+		}
+		value, err := InfoField(node, v.section, v.field)
+		if err != nil {
+			return monitor.PauseRatio, "info " + v.section + " error: " + err.Error()
+		}
+		exceed(v.field, value, v.threshold)
+	}
+	return ratio, reason
+}
+
+func (monitor *HealthMonitor) setStatus(status string, server string, reason string) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	current := monitor.Status()
+	if current == HealthStatusAborted {
+		return
+	}
+
+	if status == HealthStatusHealthy {
+		monitor.unhealthySince = time.Time{}
+	} else if monitor.unhealthySince.IsZero() {
+		monitor.unhealthySince = time.Now()
+	} else if monitor.AbortAfter > 0 && time.Since(monitor.unhealthySince) >= monitor.AbortAfter {
+		status = HealthStatusAborted
+		reason = fmt.Sprintf("unhealthy for %s, %s", time.Since(monitor.unhealthySince).Truncate(time.Second), reason)
+		monitor.abortReason = server + " " + reason
+	}
+
+	if status != current {
+		monitor.events = append(monitor.events, ThrottleEvent{
+			Time:   time.Now().Format("2006-01-02 15:04:05"),
+			Server: server,
+			Status: status,
+			Reason: reason,
+		})
+		zaplogger.Sugar().Info("Health status changed to ", status, ": ", server, " ", reason)
+	}
+	monitor.status.Store(status)
+	monitor.cond.Broadcast()
+}
+
+func (monitor *HealthMonitor) Status() string {
+	if monitor == nil {
+		return HealthStatusHealthy
+	}
+	return monitor.status.Load().(string)
+}
+
+func (monitor *HealthMonitor) Aborted() bool {
+	return monitor.Status() == HealthStatusAborted
+}
+
+//中止时返回原因
+func (monitor *HealthMonitor) Err() error {
+	if !monitor.Aborted() {
+		return nil
+	}
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	return errors.New("compare aborted, " + monitor.abortReason)
+}
+
+//worker处理key前调用，减速状态下等待，暂停状态下阻塞到恢复或ctx取消，返回false表示比较已中止或被中断
+func (monitor *HealthMonitor) Wait(ctx context.Context) bool {
+	if monitor == nil {
+		return ctx.Err() == nil
+	}
+
+	switch monitor.Status() {
+	case HealthStatusHealthy:
+		return ctx.Err() == nil
+	case HealthStatusSlow:
+		time.Sleep(monitor.SlowDelay)
+		return ctx.Err() == nil
+	}
+
+	//ctx取消时唤醒暂停中的worker
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			monitor.mu.Lock()
+			monitor.cond.Broadcast()
+			monitor.mu.Unlock()
+		case <-done:
+		}
+	}()
+
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	for monitor.Status() == HealthStatusPaused && ctx.Err() == nil {
+		monitor.cond.Wait()
+	}
+	return monitor.Status() != HealthStatusAborted && ctx.Err() == nil
+}
+
+func (monitor *HealthMonitor) Events() []ThrottleEvent {
+	if monitor == nil {
+		return nil
+	}
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+	return append([]ThrottleEvent{}, monitor.events...)
+}
+
+//报告元数据
+func (monitor *HealthMonitor) Report() map[string]interface{} {
+	report := make(map[string]interface{})
+	report["HealthStatus"] = monitor.Status()
+	report["HealthThreshold"] = monitor.Threshold
+	report["ThrottleEvents"] = monitor.Events()
+	if err := monitor.Err(); err != nil {
+		report["AbortReason"] = err.Error()
+	}
+	return report
+}
+
+//获取INFO指定section中的整数字段
+func InfoField(client *redis.Client, section string, field string) (int64, error) {
+	info, err := client.Info(section).Result()
+	if err != nil {
+		return 0, err
+	}
+	value, ok := ParseInfo(info)[field]
+	if !ok {
+		return 0, errors.New(field + " not found in info " + section)
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+//将INFO命令结果解析为字段与值的映射
+func ParseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	return fields
+}
@@ -0,0 +1,106 @@
+package compare
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseInfo(t *testing.T) {
+	info := "# Stats\r\ninstantaneous_ops_per_sec:120\r\ntotal_net_input_bytes:3456\r\n\r\n# Clients\r\nconnected_clients:8\r\n"
+	fields := ParseInfo(info)
+	if fields["instantaneous_ops_per_sec"] != "120" || fields["connected_clients"] != "8" {
+		t.Errorf("unexpected info fields %v", fields)
+	}
+}
+
+func TestHealthMonitorStatus(t *testing.T) {
+	if NewHealthMonitor(HealthThreshold{}, 0, 0) != nil {
+		t.Fatal("monitor without threshold should be nil")
+	}
+
+	monitor := NewHealthMonitor(HealthThreshold{MaxOpsPerSec: 100}, time.Second, 50*time.Millisecond)
+	monitor.setStatus(HealthStatusPaused, "source", "instantaneous_ops_per_sec 200 exceeds 100")
+
+	//暂停状态下worker阻塞到恢复
+	resumed := make(chan bool)
+	go func() {
+		resumed <- monitor.Wait(context.Background())
+	}()
+	select {
+	case <-resumed:
+		t.Fatal("worker should wait while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	monitor.setStatus(HealthStatusHealthy, "", "")
+	if !<-resumed {
+		t.Error("worker should resume after healthy")
+	}
+
+	//暂停状态下ctx取消时worker返回false
+	monitor.setStatus(HealthStatusPaused, "source", "instantaneous_ops_per_sec 200 exceeds 100")
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		resumed <- monitor.Wait(ctx)
+	}()
+	cancel()
+	if <-resumed {
+		t.Error("worker should stop after cancel")
+	}
+	monitor.setStatus(HealthStatusHealthy, "", "")
+
+	//持续不健康超过AbortAfter时中止
+	monitor.setStatus(HealthStatusSlow, "target", "connected_clients 120 exceeds 100")
+	time.Sleep(60 * time.Millisecond)
+	monitor.setStatus(HealthStatusSlow, "target", "connected_clients 120 exceeds 100")
+	if !monitor.Aborted() || monitor.Wait(context.Background()) || monitor.Err() == nil {
+		t.Error("monitor should abort after staying unhealthy")
+	}
+
+	statuses := []string{}
+	for _, v := range monitor.Events() {
+		statuses = append(statuses, v.Status)
+	}
+	want := []string{HealthStatusPaused, HealthStatusHealthy, HealthStatusPaused, HealthStatusHealthy, HealthStatusSlow, HealthStatusAborted}
+	if len(statuses) != len(want) {
+		t.Fatalf("got events %v, want %v", statuses, want)
+	}
+	for k := range want {
+		if statuses[k] != want[k] {
+			t.Errorf("got events %v, want %v", statuses, want)
+			break
+		}
+	}
+
+	var nilmonitor *HealthMonitor
+	if !nilmonitor.Wait(context.Background()) || nilmonitor.Err() != nil {
+		t.Error("nil monitor should never throttle")
+	}
+}
+
+func TestHealthMonitorIgnoresRateLimit(t *testing.T) {
+	server := newFakeRedis(t)
+	server.SetInfo("# Clients\r\nconnected_clients:8\r\n")
+	client := server.Client(0)
+	NewRateLimit(1, 0).Apply(context.Background(), client)
+	client.Ping()
+
+	//比较client的下一条命令需等待限速，探测不经过限速hook
+	monitor := NewHealthMonitor(HealthThreshold{MaxLatency: 300, MaxClients: 10}, time.Second, 0)
+	defer monitor.Stop()
+	monitor.AddClient("source", client)
+	begin := time.Now()
+	monitor.Check()
+	if elapsed := time.Since(begin); elapsed > 300*time.Millisecond {
+		t.Errorf("health check waited %s for rate limit", elapsed)
+	}
+	if monitor.Status() != HealthStatusHealthy {
+		t.Errorf("got status %s, events %v", monitor.Status(), monitor.Events())
+	}
+
+	server.SetInfo("# Clients\r\nconnected_clients:12\r\n")
+	monitor.Check()
+	if monitor.Status() != HealthStatusSlow {
+		t.Errorf("got status %s, want slow", monitor.Status())
+	}
+}
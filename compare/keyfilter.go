@@ -0,0 +1,228 @@
+package compare
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v7"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+//按key名称(glob、正则)以及类型过滤参与比较的key，nil表示不过滤
+type KeyFilter struct {
+	Include      []string //key需匹配其中之一的glob规则
+	Exclude      []string //匹配其中之一即排除的glob规则
+	IncludeRegex []string //key需匹配其中之一的正则规则
+	ExcludeRegex []string //匹配其中之一即排除的正则规则
+	Types        []string //仅比较的key类型
+	ExcludeTypes []string //不比较的key类型
+
+	include             []*regexp.Regexp
+	exclude             []*regexp.Regexp
+	scanTypeUnsupported int32
+}
+
+//编译过滤规则，规则均为空时返回nil
+func NewKeyFilter(include, exclude, includeregex, excluderegex, types, excludetypes []string) (*KeyFilter, error) {
+	if len(include)+len(exclude)+len(includeregex)+len(excluderegex)+len(types)+len(excludetypes) == 0 {
+		return nil, nil
+	}
+
+	filter := &KeyFilter{
+		Include:      include,
+		Exclude:      exclude,
+		IncludeRegex: includeregex,
+		ExcludeRegex: excluderegex,
+		Types:        types,
+		ExcludeTypes: excludetypes,
+	}
+
+	for _, v := range include {
+		re, err := regexp.Compile(GlobToRegexp(v))
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, re)
+	}
+	for _, v := range exclude {
+		re, err := regexp.Compile(GlobToRegexp(v))
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, re)
+	}
+	for _, v := range includeregex {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, re)
+	}
+	for _, v := range excluderegex {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, re)
+	}
+	return filter, nil
+}
+
+func (filter *KeyFilter) MatchKey(key string) bool {
+	if filter == nil {
+		return true
+	}
+
+	if len(filter.include) > 0 {
+		matched := false
+		for _, v := range filter.include {
+			if v.MatchString(key) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for _, v := range filter.exclude {
+		if v.MatchString(key) {
+			return false
+		}
+	}
+	return true
+}
+
+//是否配置了类型过滤规则
+func (filter *KeyFilter) HasTypeRules() bool {
+	return filter != nil && (len(filter.Types) > 0 || len(filter.ExcludeTypes) > 0)
+}
+
+func (filter *KeyFilter) MatchType(keytype string) bool {
+	if filter == nil {
+		return true
+	}
+
+	if len(filter.Types) > 0 && !containsString(filter.Types, keytype) {
+		return false
+	}
+	return !containsString(filter.ExcludeTypes, keytype)
+}
+
+//仅有一条glob包含规则时可交由服务端SCAN MATCH过滤
+func (filter *KeyFilter) ScanMatch() string {
+	if filter == nil || len(filter.Include) != 1 || len(filter.IncludeRegex) != 0 {
+		return "*"
+	}
+	return filter.Include[0]
+}
+
+//仅包含一种类型时可交由服务端SCAN TYPE过滤，redis 6.0以上支持
+func (filter *KeyFilter) ScanType() string {
+	if filter == nil || len(filter.Types) != 1 || atomic.LoadInt32(&filter.scanTypeUnsupported) == 1 {
+		return ""
+	}
+	return filter.Types[0]
+}
+
+//按过滤规则scan key，服务端不支持SCAN TYPE时退化为客户端过滤
+func ScanKeys(client *redis.Client, cursor uint64, count int64, filter *KeyFilter) ([]string, uint64, error) {
+	return ScanKeysMatch(client, cursor, count, filter.ScanMatch(), filter)
+}
+
+//以指定的MATCH规则scan key，只使用filter的SCAN TYPE规则
+func ScanKeysMatch(client *redis.Client, cursor uint64, count int64, match string, filter *KeyFilter) ([]string, uint64, error) {
+	keytype := filter.ScanType()
+	if keytype == "" {
+		return client.Scan(cursor, match, count).Result()
+	}
+
+	keys, c, err := scanWithType(client, cursor, match, count, keytype)
+	if err != nil && strings.HasPrefix(err.Error(), "ERR") {
+		atomic.StoreInt32(&filter.scanTypeUnsupported, 1)
+		zaplogger.Sugar().Info("SCAN TYPE unsupported, filter key type in client: ", err)
+		return client.Scan(cursor, match, count).Result()
+	}
+	return keys, c, err
+}
+
+func scanWithType(client *redis.Client, cursor uint64, match string, count int64, keytype string) ([]string, uint64, error) {
+	result, err := client.Do("scan", cursor, "match", match, "count", count, "type", keytype).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reply, ok := result.([]interface{})
+	if !ok || len(reply) != 2 {
+		return nil, 0, errors.New("unexpected scan reply")
+	}
+
+	cursorstr, ok := reply[0].(string)
+	if !ok {
+		return nil, 0, errors.New("unexpected scan cursor")
+	}
+	c, err := strconv.ParseUint(cursorstr, 10, 64)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items, ok := reply[1].([]interface{})
+	if !ok {
+		return nil, 0, errors.New("unexpected scan keys")
+	}
+	keys := make([]string, 0, len(items))
+	for _, v := range items {
+		if key, ok := v.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, c, nil
+}
+
+//将redis glob规则转换为正则表达式
+func GlobToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	inclass := false
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case inclass:
+			if c == ']' {
+				inclass = false
+				b.WriteByte(c)
+			} else if c == '^' && glob[i-1] == '[' {
+				b.WriteByte(c)
+			} else if c == '-' {
+				b.WriteByte(c)
+			} else {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		case c == '*':
+			b.WriteString("(?s:.*)")
+		case c == '?':
+			b.WriteString("(?s:.)")
+		case c == '[' && strings.IndexByte(glob[i+1:], ']') > 0:
+			inclass = true
+			b.WriteByte(c)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
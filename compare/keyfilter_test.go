@@ -0,0 +1,83 @@
+package compare
+
+import "testing"
+
+func TestKeyFilterMatchKey(t *testing.T) {
+	filter, err := NewKeyFilter([]string{"order:*"}, []string{"order:cache:*"}, nil, []string{`^order:\d+:tmp$`}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"order:1":           true,
+		"order:a/b":         true,
+		"order:cache:1":     false,
+		"order:12:tmp":      false,
+		"session:1":         false,
+		"xorder:1":          false,
+		"order:12:tmp:keep": true,
+	}
+	for key, want := range cases {
+		if got := filter.MatchKey(key); got != want {
+			t.Errorf("MatchKey(%s) = %v, want %v", key, got, want)
+		}
+	}
+
+	if filter.ScanMatch() != "order:*" {
+		t.Errorf("ScanMatch() = %s, want order:*", filter.ScanMatch())
+	}
+}
+
+func TestKeyFilterMatchType(t *testing.T) {
+	filter, err := NewKeyFilter(nil, nil, nil, nil, []string{"hash"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filter.MatchType("hash") || filter.MatchType("string") {
+		t.Error("only hash type should match")
+	}
+	if filter.ScanType() != "hash" {
+		t.Errorf("ScanType() = %s, want hash", filter.ScanType())
+	}
+
+	filter, _ = NewKeyFilter(nil, nil, nil, nil, nil, []string{"stream"})
+	if filter.MatchType("stream") || !filter.MatchType("list") {
+		t.Error("stream type should be excluded")
+	}
+}
+
+func TestKeyFilterNil(t *testing.T) {
+	filter, err := NewKeyFilter(nil, nil, nil, nil, nil, nil)
+	if err != nil || filter != nil {
+		t.Fatal("empty rules should return nil filter")
+	}
+	if !filter.MatchKey("any") || !filter.MatchType("string") || filter.ScanMatch() != "*" || filter.ScanType() != "" {
+		t.Error("nil filter should match everything")
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	cases := []struct {
+		glob  string
+		key   string
+		match bool
+	}{
+		{"h?llo", "hello", true},
+		{"h?llo", "heello", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a.b", "axb", false},
+	}
+	for _, v := range cases {
+		filter, err := NewKeyFilter([]string{v.glob}, nil, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filter.MatchKey(v.key); got != v.match {
+			t.Errorf("glob %s match %s = %v, want %v", v.glob, v.key, got, v.match)
+		}
+	}
+}
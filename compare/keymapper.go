@@ -0,0 +1,161 @@
+package compare
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//key前缀替换规则
+type PrefixRule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+//key正则替换规则，Replace中可使用$1等引用分组
+type RegexRule struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+//源key到目标key的映射，优先级依次为映射文件、前缀替换、正则替换，均未命中时保持原名
+type KeyMapper struct {
+	Prefix   []PrefixRule `json:"prefix"`
+	Regex    []RegexRule  `json:"regex"`
+	MapFile  string       `json:"file"`     //映射文件，每行为源key与目标key，以tab或空格分隔
+	DBPrefix string       `json:"dbprefix"` //源DB合并到cluster目标时追加的key前缀，在其他规则之后生效
+
+	mapping        map[string]string
+	reversemapping map[string]string
+	regex          []*regexp.Regexp
+}
+
+//编译正则并加载映射文件，规则均为空时返回nil
+func NewKeyMapper(prefix []PrefixRule, regex []RegexRule, mapfile string) (*KeyMapper, error) {
+	if len(prefix) == 0 && len(regex) == 0 && mapfile == "" {
+		return nil, nil
+	}
+
+	mapper := &KeyMapper{
+		Prefix:         prefix,
+		Regex:          regex,
+		MapFile:        mapfile,
+		mapping:        make(map[string]string),
+		reversemapping: make(map[string]string),
+	}
+
+	for _, v := range regex {
+		re, err := regexp.Compile(v.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		mapper.regex = append(mapper.regex, re)
+	}
+
+	if mapfile != "" {
+		if err := mapper.loadMapFile(mapfile); err != nil {
+			return nil, err
+		}
+	}
+	return mapper, nil
+}
+
+func (mapper *KeyMapper) loadMapFile(mapfile string) error {
+	fi, err := os.Open(mapfile)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+
+	scanner := bufio.NewScanner(fi)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sep := "\t"
+		if !strings.Contains(line, sep) {
+			sep = " "
+		}
+		kv := strings.SplitN(line, sep, 2)
+		if len(kv) != 2 {
+			return errors.New("invalid key map line: " + line)
+		}
+		source := strings.TrimSpace(kv[0])
+		target := strings.TrimSpace(kv[1])
+		mapper.mapping[source] = target
+		mapper.reversemapping[target] = source
+	}
+	return scanner.Err()
+}
+
+//返回追加DB前缀后的映射规则副本，prefix为空时返回原规则
+func (mapper *KeyMapper) WithDBPrefix(prefix string) *KeyMapper {
+	if prefix == "" {
+		return mapper
+	}
+	if mapper == nil {
+		return &KeyMapper{DBPrefix: prefix}
+	}
+	dbmapper := *mapper
+	dbmapper.DBPrefix = prefix
+	return &dbmapper
+}
+
+//返回源key对应的目标key
+func (mapper *KeyMapper) Map(key string) string {
+	if mapper == nil {
+		return key
+	}
+	return mapper.DBPrefix + mapper.mapRules(key)
+}
+
+func (mapper *KeyMapper) mapRules(key string) string {
+	if target, ok := mapper.mapping[key]; ok {
+		return target
+	}
+
+	for _, v := range mapper.Prefix {
+		if strings.HasPrefix(key, v.From) {
+			return v.To + strings.TrimPrefix(key, v.From)
+		}
+	}
+
+	for k, v := range mapper.regex {
+		if v.MatchString(key) {
+			return v.ReplaceAllString(key, mapper.Regex[k].Replace)
+		}
+	}
+	return key
+}
+
+//判断目标key是否带有该规则的DB前缀，即是否可能由该源DB映射而来
+func (mapper *KeyMapper) HasDBPrefix(key string) bool {
+	return mapper == nil || strings.HasPrefix(key, mapper.DBPrefix)
+}
+
+//返回目标key对应的源key，正则规则不可逆，仅支持映射文件与前缀替换
+func (mapper *KeyMapper) Reverse(key string) string {
+	if mapper == nil {
+		return key
+	}
+
+	key = strings.TrimPrefix(key, mapper.DBPrefix)
+	if source, ok := mapper.reversemapping[key]; ok {
+		return source
+	}
+
+	for _, v := range mapper.Prefix {
+		if strings.HasPrefix(key, v.To) {
+			return v.From + strings.TrimPrefix(key, v.To)
+		}
+	}
+	return key
+}
+
+func (mapper *KeyMapper) Reversible() bool {
+	return mapper == nil || len(mapper.regex) == 0
+}
@@ -0,0 +1,88 @@
+package compare
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestKeyMapper(t *testing.T) {
+	mapfile, err := ioutil.TempFile("", "keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(mapfile.Name())
+	mapfile.WriteString("# source target\nold:order:1\tnew:order:1\nlegacy new\n")
+	mapfile.Close()
+
+	mapper, err := NewKeyMapper(
+		[]PrefixRule{{From: "order:", To: "tenant1:order:"}},
+		[]RegexRule{{Pattern: `^user:(\d+)$`, Replace: "user:{$1}"}},
+		mapfile.Name(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"old:order:1": "new:order:1",
+		"legacy":      "new",
+		"order:9":     "tenant1:order:9",
+		"user:42":     "user:{42}",
+		"session:1":   "session:1",
+	}
+	for source, target := range cases {
+		if got := mapper.Map(source); got != target {
+			t.Errorf("Map(%s) = %s, want %s", source, got, target)
+		}
+	}
+
+	if got := mapper.Reverse("tenant1:order:9"); got != "order:9" {
+		t.Errorf("Reverse(tenant1:order:9) = %s, want order:9", got)
+	}
+	if got := mapper.Reverse("new:order:1"); got != "old:order:1" {
+		t.Errorf("Reverse(new:order:1) = %s, want old:order:1", got)
+	}
+	if mapper.Reversible() {
+		t.Error("mapper with regex rules should not be reversible")
+	}
+}
+
+func TestKeyMapperNil(t *testing.T) {
+	mapper, err := NewKeyMapper(nil, nil, "")
+	if err != nil || mapper != nil {
+		t.Fatal("empty rules should return nil mapper")
+	}
+	if mapper.Map("key") != "key" || mapper.Reverse("key") != "key" || !mapper.Reversible() {
+		t.Error("nil mapper should keep key name")
+	}
+}
+
+func TestKeyMapperDBPrefix(t *testing.T) {
+	mapper, err := NewKeyMapper([]PrefixRule{{From: "order:", To: "o:"}}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbmapper := mapper.WithDBPrefix("db3:")
+	if got := dbmapper.Map("order:1"); got != "db3:o:1" {
+		t.Errorf("Map(order:1) = %s, want db3:o:1", got)
+	}
+	if got := dbmapper.Reverse("db3:o:1"); got != "order:1" {
+		t.Errorf("Reverse(db3:o:1) = %s, want order:1", got)
+	}
+	if !dbmapper.HasDBPrefix("db3:o:1") || dbmapper.HasDBPrefix("db5:o:1") {
+		t.Error("HasDBPrefix should only match keys with db prefix")
+	}
+	if mapper.Map("order:1") != "o:1" {
+		t.Error("WithDBPrefix should not change origin mapper")
+	}
+
+	var nilmapper *KeyMapper
+	if got := nilmapper.WithDBPrefix("db5:").Map("k"); got != "db5:k" {
+		t.Errorf("Map(k) = %s, want db5:k", got)
+	}
+	if nilmapper.WithDBPrefix("") != nil {
+		t.Error("empty db prefix should keep nil mapper")
+	}
+}
@@ -0,0 +1,39 @@
+package compare
+
+import (
+	"errors"
+	"github.com/go-redis/redis/v7"
+)
+
+const DefaultMemberSampleSize = 100
+
+//通过HRANDFIELD WITHVALUES随机抽取hash field，返回field与value交替的列表，redis 6.2以上支持
+func RandHashFields(client *redis.Client, key string, count int64) ([]string, error) {
+	return randMembers(client, "hrandfield", key, count, "withvalues")
+}
+
+//通过ZRANDMEMBER WITHSCORES随机抽取zset member，返回member与score交替的列表，redis 6.2以上支持
+func RandZsetMembers(client *redis.Client, key string, count int64) ([]string, error) {
+	return randMembers(client, "zrandmember", key, count, "withscores")
+}
+
+func randMembers(client *redis.Client, command string, key string, count int64, with string) ([]string, error) {
+	result, err := client.Do(command, key, count, with).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := result.([]interface{})
+	if !ok || len(items)%2 != 0 {
+		return nil, errors.New("unexpected " + command + " reply")
+	}
+	members := make([]string, 0, len(items))
+	for _, v := range items {
+		member, ok := v.(string)
+		if !ok {
+			return nil, errors.New("unexpected " + command + " reply")
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
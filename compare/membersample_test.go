@@ -0,0 +1,186 @@
+package compare
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func newSampleCompare(t *testing.T) (*CompareSingle2Single, *fakeRedis, *fakeRedis) {
+	source := newFakeRedis(t)
+	target := newFakeRedis(t)
+	compare := &CompareSingle2Single{
+		Source:                source.Client(0),
+		Target:                target.Client(0),
+		BatchSize:             10,
+		TTLDiff:               1000,
+		MemberSampleThreshold: 3,
+		MemberSampleSize:      2,
+	}
+	return compare, source, target
+}
+
+func firstReason(result *CompareResult) map[string]interface{} {
+	if result == nil || len(result.KeyDiffReason) == 0 {
+		return nil
+	}
+	reason, _ := result.KeyDiffReason[0].(map[string]interface{})
+	return reason
+}
+
+func countCalls(server *fakeRedis, prefix string) int {
+	n := 0
+	for _, v := range server.Calls() {
+		if strings.HasPrefix(v, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRandMembers(t *testing.T) {
+	server := newFakeRedis(t)
+	server.Set(0, "h", fakeHash{"a": "1", "b": "2", "c": "3"})
+	server.Set(0, "z", fakeZset{"a": 1, "b": 2.5})
+	fields, err := RandHashFields(server.Client(0), "h", 2)
+	if err != nil || len(fields) != 4 || fields[0] != "a" || fields[1] != "1" {
+		t.Errorf("got %v, %v", fields, err)
+	}
+	members, err := RandZsetMembers(server.Client(0), "z", 5)
+	if err != nil || len(members) != 4 || members[3] != "2.5" {
+		t.Errorf("got %v, %v", members, err)
+	}
+	server.Fail("hrandfield", "ERR unknown command 'hrandfield'")
+	if _, err := RandHashFields(server.Client(0), "h", 2); err == nil {
+		t.Error("HRANDFIELD error should be returned")
+	}
+}
+
+func TestCompareHashSampled(t *testing.T) {
+	compare, source, target := newSampleCompare(t)
+	ctx := context.Background()
+	source.Set(0, "h", fakeHash{"a": "1", "b": "2", "c": "3", "d": "4"})
+
+	//长度不一致时不再抽样
+	target.Set(0, "h", fakeHash{"a": "1", "b": "2", "c": "3"})
+	result := compare.CompareHash(ctx, "h")
+	if reason := firstReason(result); result.IsEqual || reason["description"] != "Hash length not equal" {
+		t.Errorf("got %+v", result)
+	}
+	if n := countCalls(source, "0 hrandfield"); n != 0 {
+		t.Errorf("length mismatch should not sample, got %d HRANDFIELD", n)
+	}
+
+	//只比较抽取的field，未抽取的d不一致时仍视为一致
+	target.Set(0, "h", fakeHash{"a": "1", "b": "2", "c": "3", "d": "x"})
+	if result := compare.CompareHash(ctx, "h"); !result.IsEqual {
+		t.Errorf("got %+v", result)
+	}
+	if n := countCalls(target, "0 hget"); n != 2 {
+		t.Errorf("got %d HGET, want sample size 2", n)
+	}
+
+	//抽取的field不一致
+	target.Set(0, "h", fakeHash{"a": "1", "b": "x", "c": "3", "d": "4"})
+	result = compare.CompareHash(ctx, "h")
+	reason := firstReason(result)
+	if result.IsEqual || reason["description"] != "Field value not equal" || reason["field"] != "b" || reason["sampled"] != true {
+		t.Errorf("got %+v", result)
+	}
+
+	//HGET错误不作为value差异
+	target.Fail("hget", "ERR busy")
+	result = compare.CompareHash(ctx, "h")
+	reason = firstReason(result)
+	if result.IsEqual || reason["description"] != "Target hget error" || reason["hgeterror"] != "ERR busy" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestCompareHashSampledFallback(t *testing.T) {
+	compare, source, target := newSampleCompare(t)
+	source.Set(0, "h", fakeHash{"a": "1", "b": "2", "c": "3", "d": "4"})
+	target.Set(0, "h", fakeHash{"a": "1", "b": "2", "c": "3", "d": "x"})
+
+	//源不支持HRANDFIELD时逐field比较
+	source.Fail("hrandfield", "ERR unknown command 'hrandfield'")
+	result := compare.CompareHash(context.Background(), "h")
+	if reason := firstReason(result); result.IsEqual || reason["field"] != "d" || reason["sampled"] != nil {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestCompareSetSampled(t *testing.T) {
+	compare, source, target := newSampleCompare(t)
+	ctx := context.Background()
+	source.Set(0, "s", fakeSet{"a": true, "b": true, "c": true, "d": true})
+
+	target.Set(0, "s", fakeSet{"a": true, "b": true})
+	if result := compare.CompareSet(ctx, "s"); result.IsEqual || firstReason(result)["description"] != "Set length not equal" {
+		t.Errorf("got %+v", result)
+	}
+
+	target.Set(0, "s", fakeSet{"a": true, "x": true, "c": true, "d": true})
+	result := compare.CompareSet(ctx, "s")
+	if reason := firstReason(result); result.IsEqual || reason["member"] != "b" || reason["sampled"] != true {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestCompareZsetSampled(t *testing.T) {
+	compare, source, target := newSampleCompare(t)
+	ctx := context.Background()
+	source.Set(0, "z", fakeZset{"a": 1, "b": 2, "c": 3, "d": 4})
+
+	target.Set(0, "z", fakeZset{"a": 1})
+	if result := compare.CompareZset(ctx, "z"); result.IsEqual || firstReason(result)["description"] != "Zset length not equal" {
+		t.Errorf("got %+v", result)
+	}
+
+	target.Set(0, "z", fakeZset{"a": 1, "b": 2.5, "c": 3, "d": 4})
+	result := compare.CompareZset(ctx, "z")
+	if reason := firstReason(result); result.IsEqual || reason["member"] != "b" || reason["sampled"] != true {
+		t.Errorf("got %+v", result)
+	}
+
+	target.Fail("zscore", "ERR busy")
+	result = compare.CompareZset(ctx, "z")
+	if reason := firstReason(result); result.IsEqual || reason["description"] != "Target zscore error" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestCompareMembershipError(t *testing.T) {
+	compare, source, target := newSampleCompare(t)
+	ctx := context.Background()
+	source.Set(0, "s", fakeSet{"a": true, "b": true, "c": true, "d": true})
+	target.Set(0, "s", fakeSet{"a": true, "b": true, "c": true, "d": true})
+	source.Set(0, "h", fakeHash{"a": "1"})
+	target.Set(0, "h", fakeHash{"a": "1"})
+
+	//SISMEMBER出错时不能当作member不存在
+	target.Fail("sismember", "ERR busy")
+	result := compare.CompareSet(ctx, "s")
+	if reason := firstReason(result); result.IsEqual || reason["description"] != "Target sismember error" || reason["sismembererror"] != "ERR busy" {
+		t.Errorf("got %+v", result)
+	}
+	compare.MemberSampleThreshold = 0
+	result = compare.CompareSetMember(ctx, "s")
+	if reason := firstReason(result); result.IsEqual || reason["description"] != "Target sismember error" {
+		t.Errorf("got %+v", result)
+	}
+
+	//全量比较时扫描目标多出的元素，源端出错也要报告
+	compare.FullDiff = true
+	source.Fail("sismember", "ERR busy")
+	source.Fail("hexists", "ERR busy")
+	target.Fail("sismember", "")
+	result = compare.CompareSetMember(ctx, "s")
+	if reason := firstReason(result); result.IsEqual || reason["description"] != "Source sismember error" || reason["member"] == nil {
+		t.Errorf("got %+v", result)
+	}
+	result = compare.CompareHashFieldVal(ctx, "h")
+	if reason := firstReason(result); result.IsEqual || reason["description"] != "Source hexists error" || reason["field"] != "a" || reason["hexistserror"] != "ERR busy" {
+		t.Errorf("got %+v", result)
+	}
+}
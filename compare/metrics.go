@@ -0,0 +1,209 @@
+package compare
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+//prometheus指标，通过--metrics-addr开启
+type Metrics struct {
+	registry     *prometheus.Registry
+	keysCompared *prometheus.CounterVec
+	diffs        *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	poolRunning  *prometheus.GaugeVec
+	poolCapacity *prometheus.GaugeVec
+	round        *prometheus.GaugeVec
+	compareTimes *prometheus.GaugeVec
+	server       *http.Server
+	hooked       sync.Map
+}
+
+//绑定scenario以及源地址标签的指标
+type SourceMetrics struct {
+	metrics  *Metrics
+	scenario string
+	source   string
+}
+
+type latencyHook struct {
+	metrics  *Metrics
+	scenario string
+	role     string
+	addr     string
+}
+
+type latencyStartKey struct{}
+
+func NewMetrics() *Metrics {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+		keysCompared: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rediscompare_keys_compared_total",
+			Help: "Keys compared",
+		}, []string{"scenario", "source"}),
+		diffs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rediscompare_diffs_total",
+			Help: "Different keys by key type and reason",
+		}, []string{"scenario", "source", "type", "reason"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rediscompare_errors_total",
+			Help: "Keys that could not be compared",
+		}, []string{"scenario", "source"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rediscompare_command_duration_seconds",
+			Help:    "Redis command latency of source and target",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{"scenario", "role", "addr", "command"}),
+		poolRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rediscompare_pool_running_workers",
+			Help: "Running workers of compare pool",
+		}, []string{"scenario", "source"}),
+		poolCapacity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rediscompare_pool_capacity",
+			Help: "Capacity of compare pool",
+		}, []string{"scenario", "source"}),
+		round: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rediscompare_round",
+			Help: "Current compare round, 1 is the first scan",
+		}, []string{"scenario", "source"}),
+		compareTimes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rediscompare_compare_times",
+			Help: "Configured compare rounds",
+		}, []string{"scenario"}),
+	}
+	metrics.registry.MustRegister(metrics.keysCompared, metrics.diffs, metrics.errors, metrics.latency,
+		metrics.poolRunning, metrics.poolCapacity, metrics.round, metrics.compareTimes)
+	return metrics
+}
+
+//在addr上提供/metrics，监听失败时返回错误
+func (metrics *Metrics) Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}))
+	metrics.server = &http.Server{Addr: addr, Handler: mux}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- metrics.server.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+func (metrics *Metrics) Stop() {
+	if metrics == nil || metrics.server == nil {
+		return
+	}
+	metrics.server.Close()
+}
+
+func (metrics *Metrics) CompareTimes(scenario string, times int) {
+	if metrics == nil {
+		return
+	}
+	metrics.compareTimes.WithLabelValues(scenario).Set(float64(times))
+}
+
+//返回绑定标签的指标，metrics为nil时返回nil
+func (metrics *Metrics) Source(scenario string, source string) *SourceMetrics {
+	if metrics == nil {
+		return nil
+	}
+	return &SourceMetrics{metrics: metrics, scenario: scenario, source: source}
+}
+
+//以hook方式统计client的命令延迟，role为source或target，同一client只挂载一次
+func (metrics *Metrics) Hook(scenario string, role string, addr string, client HookClient) {
+	if metrics == nil || client == nil || reflect.ValueOf(client).IsNil() {
+		return
+	}
+	if _, loaded := metrics.hooked.LoadOrStore(client, true); loaded {
+		return
+	}
+	client.AddHook(&latencyHook{metrics: metrics, scenario: scenario, role: role, addr: addr})
+}
+
+func (metrics *SourceMetrics) Compared() {
+	if metrics == nil {
+		return
+	}
+	metrics.metrics.keysCompared.WithLabelValues(metrics.scenario, metrics.source).Inc()
+}
+
+//每个差异key计数一次，reason取第一条差异的description
+func (metrics *SourceMetrics) Diff(result *CompareResult) {
+	if metrics == nil || result == nil {
+		return
+	}
+	reason := "unknown"
+	if len(result.KeyDiffReason) > 0 {
+		if m, ok := result.KeyDiffReason[0].(map[string]interface{}); ok {
+			if description, ok := m["description"].(string); ok {
+				reason = description
+			}
+		}
+	}
+	metrics.metrics.diffs.WithLabelValues(metrics.scenario, metrics.source, result.KeyType, reason).Inc()
+}
+
+func (metrics *SourceMetrics) Error() {
+	if metrics == nil {
+		return
+	}
+	metrics.metrics.errors.WithLabelValues(metrics.scenario, metrics.source).Inc()
+}
+
+func (metrics *SourceMetrics) Pool(running int, capacity int) {
+	if metrics == nil {
+		return
+	}
+	metrics.metrics.poolRunning.WithLabelValues(metrics.scenario, metrics.source).Set(float64(running))
+	metrics.metrics.poolCapacity.WithLabelValues(metrics.scenario, metrics.source).Set(float64(capacity))
+}
+
+//round从1开始，1为首次scan比较，之后为复查轮次
+func (metrics *SourceMetrics) Round(round int) {
+	if metrics == nil {
+		return
+	}
+	metrics.metrics.round.WithLabelValues(metrics.scenario, metrics.source).Set(float64(round))
+}
+
+func (hook *latencyHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, latencyStartKey{}, time.Now()), nil
+}
+
+func (hook *latencyHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	hook.observe(ctx, cmd.Name())
+	return nil
+}
+
+func (hook *latencyHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, latencyStartKey{}, time.Now()), nil
+}
+
+func (hook *latencyHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	hook.observe(ctx, "pipeline")
+	return nil
+}
+
+func (hook *latencyHook) observe(ctx context.Context, command string) {
+	start, ok := ctx.Value(latencyStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	hook.metrics.latency.WithLabelValues(hook.scenario, hook.role, hook.addr, command).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,107 @@
+package compare
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSourceMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	source := metrics.Source("single2single", "127.0.0.1:6379/0")
+
+	source.Compared()
+	source.Compared()
+	source.Error()
+	source.Diff(&CompareResult{
+		KeyType: "hash",
+		KeyDiffReason: []interface{}{
+			map[string]interface{}{"description": "Field value not equal"},
+			map[string]interface{}{"description": "Field value not equal"},
+			map[string]interface{}{"description": "Field not exists in target"},
+		},
+	})
+	source.Diff(&CompareResult{
+		KeyType:       "hash",
+		KeyDiffReason: []interface{}{map[string]interface{}{"description": "Field value not equal"}},
+	})
+	source.Pool(3, 8)
+	source.Round(2)
+
+	if v := testutil.ToFloat64(metrics.keysCompared.WithLabelValues("single2single", "127.0.0.1:6379/0")); v != 2 {
+		t.Errorf("got %v keys compared, want 2", v)
+	}
+	if v := testutil.ToFloat64(metrics.errors.WithLabelValues("single2single", "127.0.0.1:6379/0")); v != 1 {
+		t.Errorf("got %v errors, want 1", v)
+	}
+	//每个差异key只计数一次
+	if v := testutil.ToFloat64(metrics.diffs.WithLabelValues("single2single", "127.0.0.1:6379/0", "hash", "Field value not equal")); v != 2 {
+		t.Errorf("got %v diffs, want 2", v)
+	}
+	if v := testutil.ToFloat64(metrics.diffs.WithLabelValues("single2single", "127.0.0.1:6379/0", "hash", "Field not exists in target")); v != 0 {
+		t.Errorf("got %v diffs, want 0", v)
+	}
+	if v := testutil.ToFloat64(metrics.poolRunning.WithLabelValues("single2single", "127.0.0.1:6379/0")); v != 3 {
+		t.Errorf("got %v running workers, want 3", v)
+	}
+	if v := testutil.ToFloat64(metrics.round.WithLabelValues("single2single", "127.0.0.1:6379/0")); v != 2 {
+		t.Errorf("got round %v, want 2", v)
+	}
+
+	//未开启指标时所有方法均可安全调用
+	var disabled *Metrics
+	disabled.Source("single2single", "127.0.0.1:6379/0").Compared()
+	disabled.Hook("single2single", "source", "127.0.0.1:6379", redis.NewClient(&redis.Options{}))
+	disabled.Stop()
+}
+
+func TestMetricsServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	metrics := NewMetrics()
+	if err := metrics.Serve(addr); err != nil {
+		t.Fatal(err)
+	}
+	defer metrics.Stop()
+
+	//命令失败时同样统计延迟
+	client := redis.NewClient(&redis.Options{Addr: addr, DialTimeout: 100 * time.Millisecond, MaxRetries: -1})
+	defer client.Close()
+	metrics.Hook("single2single", "source", addr, client)
+	metrics.Hook("single2single", "source", addr, client)
+	client.Ping()
+	if n := testutil.CollectAndCount(metrics.latency); n != 1 {
+		t.Errorf("got %d latency series, want 1", n)
+	}
+	metrics.CompareTimes("single2single", 3)
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	for _, v := range []string{
+		`rediscompare_compare_times{scenario="single2single"} 3`,
+		`rediscompare_command_duration_seconds_count{addr="` + addr + `",command="ping",role="source",scenario="single2single"} 1`,
+	} {
+		if !strings.Contains(string(body), v) {
+			t.Errorf("metrics output missing %s", v)
+		}
+	}
+
+	if err := NewMetrics().Serve(addr); err == nil {
+		t.Error("serve on used address should fail")
+	}
+}
@@ -0,0 +1,233 @@
+package compare
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+//msgpack嵌套层数上限
+const maxMsgpackDepth = 1000
+
+//array与map按声明长度预分配的元素数量上限，声明长度只能说明剩余字节数量的上限，嵌套时按声明长度预分配会放大内存占用
+const maxMsgpackPrealloc = 64
+
+var errMsgpackShort = errors.New("msgpack value truncated")
+
+//msgpack转为规范化的JSON，bin转为base64字符串，ext转为{"exttype","data"}对象
+func msgpackToJSON(value []byte) ([]byte, error) {
+	decoder := &msgpackDecoder{data: value}
+	v, err := decoder.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.pos != len(decoder.data) {
+		return nil, errors.New("msgpack value has trailing bytes")
+	}
+	return marshalCanonical(v)
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (decoder *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(decoder.data)-decoder.pos < n {
+		return nil, errMsgpackShort
+	}
+	b := decoder.data[decoder.pos : decoder.pos+n]
+	decoder.pos += n
+	return b, nil
+}
+
+//读取n字节的大端无符号整数
+func (decoder *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := decoder.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+//读取n字节长度后的内容
+func (decoder *msgpackDecoder) sized(n int) ([]byte, error) {
+	length, err := decoder.uint(n)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(decoder.data)) {
+		return nil, errMsgpackShort
+	}
+	return decoder.next(int(length))
+}
+
+func (decoder *msgpackDecoder) decode(depth int) (interface{}, error) {
+	if depth > maxMsgpackDepth {
+		return nil, errors.New("msgpack value nested too deep")
+	}
+	b, err := decoder.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return decoder.decodeMap(int(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return decoder.decodeArray(int(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		s, err := decoder.next(int(c & 0x1f))
+		return string(s), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		bin, err := decoder.sized(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), bin...), nil
+	case 0xc7, 0xc8, 0xc9:
+		length, err := decoder.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		if length > uint64(len(decoder.data)) {
+			return nil, errMsgpackShort
+		}
+		return decoder.decodeExt(int(length))
+	case 0xca:
+		u, err := decoder.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := decoder.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return decoder.uint(1 << (c - 0xcc))
+	case 0xd0:
+		u, err := decoder.uint(1)
+		return int64(int8(u)), err
+	case 0xd1:
+		u, err := decoder.uint(2)
+		return int64(int16(u)), err
+	case 0xd2:
+		u, err := decoder.uint(4)
+		return int64(int32(u)), err
+	case 0xd3:
+		u, err := decoder.uint(8)
+		return int64(u), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return decoder.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		s, err := decoder.sized(1 << (c - 0xd9))
+		return string(s), err
+	case 0xdc, 0xdd:
+		length, err := decoder.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		if length > uint64(len(decoder.data)) {
+			return nil, errMsgpackShort
+		}
+		return decoder.decodeArray(int(length), depth)
+	case 0xde, 0xdf:
+		length, err := decoder.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		if length > uint64(len(decoder.data)) {
+			return nil, errMsgpackShort
+		}
+		return decoder.decodeMap(int(length), depth)
+	}
+	return nil, fmt.Errorf("invalid msgpack type 0x%x", c)
+}
+
+//每个元素至少占1字节，剩余字节不足时直接返回错误
+func (decoder *msgpackDecoder) checkLength(length int) error {
+	if length > len(decoder.data)-decoder.pos {
+		return errMsgpackShort
+	}
+	return nil
+}
+
+func prealloc(length int) int {
+	if length > maxMsgpackPrealloc {
+		return maxMsgpackPrealloc
+	}
+	return length
+}
+
+func (decoder *msgpackDecoder) decodeArray(length int, depth int) (interface{}, error) {
+	if err := decoder.checkLength(length); err != nil {
+		return nil, err
+	}
+	array := make([]interface{}, 0, prealloc(length))
+	for i := 0; i < length; i++ {
+		v, err := decoder.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, v)
+	}
+	return array, nil
+}
+
+//非字符串的map key转为字符串
+func (decoder *msgpackDecoder) decodeMap(length int, depth int) (interface{}, error) {
+	if err := decoder.checkLength(length); err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, prealloc(length))
+	for i := 0; i < length; i++ {
+		k, err := decoder.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := decoder.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (decoder *msgpackDecoder) decodeExt(length int) (interface{}, error) {
+	t, err := decoder.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decoder.next(length)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"exttype": int8(t[0]),
+		"data":    append([]byte(nil), data...),
+	}, nil
+}
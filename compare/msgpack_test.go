@@ -0,0 +1,107 @@
+package compare
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+//包含各种类型的合法msgpack
+var msgpackSample = []byte{
+	0x87,
+	0xa1, 'a', 0x93, 0x01, 0xd0, 0x80, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+	0xa1, 'b', 0xc4, 0x02, 0x01, 0x02,
+	0xa1, 'c', 0xd9, 0x03, 'x', 'y', 'z',
+	0xa1, 'd', 0xde, 0x00, 0x01, 0x01, 0xc3,
+	0xa1, 'e', 0xc7, 0x02, 0x05, 0x01, 0x02,
+	0xa1, 'f', 0xdc, 0x00, 0x02, 0xc0, 0xcf, 0, 0, 0, 0, 0, 0, 0x01, 0x00,
+	0xa1, 'g', 0xd6, 0x01, 0x00, 0x00, 0x00, 0x01,
+}
+
+func TestMsgpackSample(t *testing.T) {
+	got, err := msgpackToJSON(msgpackSample)
+	want := `{"a":[1,-128,1.5],"b":"AQI=","c":"xyz","d":{"1":true},"e":{"data":"AQI=","exttype":5},"f":[null,256],"g":{"data":"AAAAAQ==","exttype":1}}`
+	if err != nil || string(got) != want {
+		t.Errorf("got %s, %v", got, err)
+	}
+}
+
+func TestMsgpackTruncated(t *testing.T) {
+	//任意位置截断都返回错误
+	for i := 0; i < len(msgpackSample); i++ {
+		if _, err := msgpackToJSON(msgpackSample[:i]); err == nil {
+			t.Errorf("truncated at %d should fail", i)
+		}
+	}
+	if _, err := msgpackToJSON(append(append([]byte{}, msgpackSample...), 0xc0)); err == nil {
+		t.Error("trailing bytes should fail")
+	}
+}
+
+func TestMsgpackMalformed(t *testing.T) {
+	cases := map[string][]byte{
+		"reserved type":  {0xc1},
+		"array32 length": {0xdd, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"map32 length":   {0xdf, 0xff, 0xff, 0xff, 0xff, 0x01, 0x01},
+		"map16 length":   {0xde, 0x00, 0x02, 0x01, 0x01},
+		"str32 length":   {0xdb, 0xff, 0xff, 0xff, 0xff, 'a'},
+		"bin32 length":   {0xc6, 0x80, 0x00, 0x00, 0x00},
+		"ext32 length":   {0xc9, 0xff, 0xff, 0xff, 0xff, 0x01},
+		"fixext data":    {0xd8, 0x01, 0x00},
+		"float64":        {0xcb, 0x00, 0x00},
+		"uint64":         {0xcf, 0x00},
+		"empty":          {},
+	}
+	for name, v := range cases {
+		if _, err := msgpackToJSON(v); err == nil {
+			t.Errorf("%s % x should fail", name, v)
+		}
+	}
+
+	//随机输入不应panic
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		b := make([]byte, random.Intn(64))
+		random.Read(b)
+		msgpackToJSON(b)
+		//在合法值中随机修改一个字节
+		mutated := append([]byte{}, msgpackSample...)
+		mutated[random.Intn(len(mutated))] = byte(random.Intn(256))
+		msgpackToJSON(mutated)
+	}
+}
+
+func TestMsgpackDepth(t *testing.T) {
+	nested := func(depth int) []byte {
+		return append(bytes.Repeat([]byte{0x91}, depth), 0x01)
+	}
+	got, err := msgpackToJSON(nested(maxMsgpackDepth))
+	if err != nil || string(got) != strings.Repeat("[", maxMsgpackDepth)+"1"+strings.Repeat("]", maxMsgpackDepth) {
+		t.Errorf("got %v", err)
+	}
+	if _, err := msgpackToJSON(nested(maxMsgpackDepth + 1)); err == nil || !strings.Contains(err.Error(), "too deep") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMsgpackPrealloc(t *testing.T) {
+	//每层array32声明的长度等于剩余字节数量，按声明长度预分配时内存随嵌套层数成倍放大
+	depth := 1000
+	value := make([]byte, 5*depth)
+	for i := 0; i < depth; i++ {
+		value[i*5] = 0xdd
+		binary.BigEndian.PutUint32(value[i*5+1:], uint32(len(value)-i*5-5))
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := msgpackToJSON(value); err == nil {
+		t.Error("truncated nested array should fail")
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 8<<20 {
+		t.Errorf("decoding %d bytes allocated %d bytes", len(value), alloc)
+	}
+}
@@ -0,0 +1,239 @@
+package compare
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+//value规范化方式
+const (
+	NormalizeJSON    = "json"    //JSON规范化，对象key排序、去掉空白并统一数字格式
+	NormalizeGzip    = "gzip"    //gzip解压
+	NormalizeZlib    = "zlib"    //zlib解压
+	NormalizeSnappy  = "snappy"  //snappy解压，支持block与framing格式
+	NormalizeMsgpack = "msgpack" //msgpack转为规范化的JSON
+	NormalizeTrim    = "trim"    //去掉首尾空白
+)
+
+//解压后value的大小上限，避免压缩炸弹
+const maxNormalizedSize = 256 << 20
+
+//snappy framing格式的stream identifier
+const snappyStreamHeader = "\xff\x06\x00\x00sNaPpY"
+
+//value规范化函数，无法处理时返回错误
+type Normalizer func(value []byte) ([]byte, error)
+
+var normalizers = map[string]Normalizer{
+	NormalizeJSON:    canonicalJSON,
+	NormalizeGzip:    gunzip,
+	NormalizeZlib:    unzlib,
+	NormalizeSnappy:  unsnappy,
+	NormalizeMsgpack: msgpackToJSON,
+	NormalizeTrim: func(value []byte) ([]byte, error) {
+		return bytes.TrimSpace(value), nil
+	},
+}
+
+//注册自定义规范化方式，需在NewNormalizers之前调用
+func RegisterNormalizer(name string, normalizer Normalizer) {
+	normalizers[name] = normalizer
+}
+
+//key glob规则与依次执行的规范化方式
+type NormalizeRule struct {
+	Pattern string   `json:"pattern"`
+	Codecs  []string `json:"codecs"`
+}
+
+//解析"pattern=codec,codec"格式的规范化规则
+func ParseNormalizeRule(rule string) (NormalizeRule, error) {
+	i := strings.LastIndex(rule, "=")
+	if i <= 0 || i == len(rule)-1 {
+		return NormalizeRule{}, errors.New("normalize rule should be pattern=codec[,codec]: " + rule)
+	}
+	return NormalizeRule{Pattern: rule[:i], Codecs: strings.Split(rule[i+1:], ",")}, nil
+}
+
+//按key匹配的value规范化规则，nil时不规范化
+type Normalizers struct {
+	Rules []NormalizeRule
+
+	patterns []*regexp.Regexp
+	codecs   [][]Normalizer
+}
+
+//编译规范化规则，规则为空时返回nil
+func NewNormalizers(rules []NormalizeRule) (*Normalizers, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	n := &Normalizers{Rules: rules}
+	for _, v := range rules {
+		re, err := regexp.Compile(GlobToRegexp(v.Pattern))
+		if err != nil {
+			return nil, err
+		}
+		if len(v.Codecs) == 0 {
+			return nil, errors.New("normalize rule without codecs: " + v.Pattern)
+		}
+		var codecs []Normalizer
+		for _, c := range v.Codecs {
+			normalizer, ok := normalizers[strings.TrimSpace(c)]
+			if !ok {
+				return nil, errors.New("unknown normalize codec: " + c)
+			}
+			codecs = append(codecs, normalizer)
+		}
+		n.patterns = append(n.patterns, re)
+		n.codecs = append(n.codecs, codecs)
+	}
+	return n, nil
+}
+
+//返回key匹配的第一条规则的规范化方式
+func (n *Normalizers) codecsOf(key string) []Normalizer {
+	if n == nil {
+		return nil
+	}
+	for k, v := range n.patterns {
+		if v.MatchString(key) {
+			return n.codecs[k]
+		}
+	}
+	return nil
+}
+
+//判断key是否匹配规范化规则
+func (n *Normalizers) Match(key string) bool {
+	return n.codecsOf(key) != nil
+}
+
+//依次执行key匹配的规范化方式，无法处理的方式跳过，value保持不变
+//例如gzip,json规则下未压缩的JSON仍会被规范化；未匹配规则时返回false
+func (n *Normalizers) Normalize(key, value string) (string, bool) {
+	codecs := n.codecsOf(key)
+	if codecs == nil {
+		return value, false
+	}
+	normalized := []byte(value)
+	for _, v := range codecs {
+		if result, err := v(normalized); err == nil {
+			normalized = result
+		}
+	}
+	return string(normalized), true
+}
+
+//规范化后比较源与目标value，tolerance为nil时要求完全一致
+func (n *Normalizers) Equal(key, source, target string, tolerance *Tolerance) bool {
+	if tolerance.ValueEqual(source, target) {
+		return true
+	}
+	if !n.Match(key) {
+		return false
+	}
+	source, _ = n.Normalize(key, source)
+	target, _ = n.Normalize(key, target)
+	return tolerance.ValueEqual(source, target)
+}
+
+func gunzip(value []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readLimited(reader)
+}
+
+func unzlib(value []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readLimited(reader)
+}
+
+func unsnappy(value []byte) ([]byte, error) {
+	if bytes.HasPrefix(value, []byte(snappyStreamHeader)) {
+		return readLimited(snappy.NewReader(bytes.NewReader(value)))
+	}
+	length, err := snappy.DecodedLen(value)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxNormalizedSize {
+		return nil, errors.New("snappy decoded value too large")
+	}
+	return snappy.Decode(nil, value)
+}
+
+func readLimited(reader io.Reader) ([]byte, error) {
+	value, err := ioutil.ReadAll(io.LimitReader(reader, maxNormalizedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(value) > maxNormalizedSize {
+		return nil, errors.New("decompressed value too large")
+	}
+	return value, nil
+}
+
+//JSON规范化，对象key排序并去掉空白，数字统一格式，1.0与1视为相同
+func canonicalJSON(value []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("invalid character after top-level JSON value")
+	}
+	return marshalCanonical(canonicalNumbers(v))
+}
+
+//整数保持原样，其他数字按最短格式输出
+func canonicalNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, e := range value {
+			value[k] = canonicalNumbers(e)
+		}
+	case []interface{}:
+		for k, e := range value {
+			value[k] = canonicalNumbers(e)
+		}
+	case json.Number:
+		if _, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return value
+		}
+		if f, err := strconv.ParseFloat(string(value), 64); err == nil {
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	}
+	return v
+}
+
+//输出对象key有序、不转义HTML字符的紧凑JSON
+func marshalCanonical(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
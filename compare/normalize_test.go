@@ -0,0 +1,115 @@
+package compare
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func TestParseNormalizeRule(t *testing.T) {
+	rule, err := ParseNormalizeRule("user:*=gzip,json")
+	if err != nil || rule.Pattern != "user:*" || len(rule.Codecs) != 2 || rule.Codecs[1] != "json" {
+		t.Errorf("got %+v, %v", rule, err)
+	}
+	if _, err := ParseNormalizeRule("user:*"); err == nil {
+		t.Error("rule without codecs should be rejected")
+	}
+	if _, err := NewNormalizers([]NormalizeRule{{Pattern: "*", Codecs: []string{"brotli"}}}); err == nil {
+		t.Error("unknown codec should be rejected")
+	}
+	if n, _ := NewNormalizers(nil); n != nil || n.Match("a") {
+		t.Error("empty rules should not normalize")
+	}
+}
+
+func TestNormalizersEqual(t *testing.T) {
+	n, err := NewNormalizers([]NormalizeRule{
+		{Pattern: "user:*", Codecs: []string{NormalizeGzip, NormalizeZlib, NormalizeJSON}},
+		{Pattern: "blob:*", Codecs: []string{NormalizeSnappy, NormalizeTrim}},
+		{Pattern: "cache:*", Codecs: []string{NormalizeMsgpack, NormalizeJSON}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//压缩方式与JSON key顺序不同
+	gz := &bytes.Buffer{}
+	gzipwriter, _ := gzip.NewWriterLevel(gz, gzip.BestCompression)
+	gzipwriter.Write([]byte(`{"name": "a", "age": 1.0, "tags": ["<x>"]}`))
+	gzipwriter.Close()
+	zl := &bytes.Buffer{}
+	zlibwriter := zlib.NewWriter(zl)
+	zlibwriter.Write([]byte(`{"tags":["<x>"],"age":1,"name":"a"}`))
+	zlibwriter.Close()
+	if !n.Equal("user:1", gz.String(), zl.String(), nil) {
+		t.Error("gzip and zlib encoded JSON should be equal")
+	}
+	//未压缩的JSON跳过解压
+	if !n.Equal("user:1", gz.String(), `{"age":1,"name":"a","tags":["<x>"]}`, nil) {
+		t.Error("plain JSON should be equal to compressed JSON")
+	}
+	if n.Equal("user:1", gz.String(), `{"age":2,"name":"a","tags":["<x>"]}`, nil) {
+		t.Error("different JSON should not be equal")
+	}
+	//未匹配规则的key不规范化
+	if n.Equal("order:1", `{"a":1}`, `{ "a": 1 }`, nil) {
+		t.Error("unmatched key should be compared as is")
+	}
+
+	block := snappy.Encode(nil, []byte("hello\n"))
+	framed := &bytes.Buffer{}
+	framewriter := snappy.NewBufferedWriter(framed)
+	framewriter.Write([]byte("hello"))
+	framewriter.Close()
+	if !n.Equal("blob:1", string(block), framed.String(), nil) {
+		t.Error("snappy block and framed values should be equal")
+	}
+
+	//{"b":[1,2.5,true,nil],"a":"x"}
+	msgpack := []byte{0x82, 0xa1, 'b', 0x94, 0x01, 0xcb, 0x40, 0x04, 0, 0, 0, 0, 0, 0, 0xc3, 0xc0, 0xa1, 'a', 0xa1, 'x'}
+	if got, ok := n.Normalize("cache:1", string(msgpack)); !ok || got != `{"a":"x","b":[1,2.5,true,null]}` {
+		t.Errorf("got %s", got)
+	}
+	if !n.Equal("cache:1", string(msgpack), `{"a": "x", "b": [1.0, 2.5, true, null]}`, nil) {
+		t.Error("msgpack should be equal to the same JSON")
+	}
+
+	//string value规范化后比较，差异预览为规范化后的value
+	source := &stringClient{values: map[string]string{"user:1": gz.String()}}
+	target := &stringClient{values: map[string]string{"user:1": zl.String()}}
+	rule := StringCompare{Normalizers: n}
+	if reason := rule.Diff(context.Background(), source, target, "user:1", "user:1"); reason != nil {
+		t.Errorf("got reason %v", reason)
+	}
+	target.values["user:1"] = `{"age":2}`
+	reason := rule.Diff(context.Background(), source, target, "user:1", "user:1")
+	if reason == nil || reason["normalized"] != true || reason["tval"] != `{"age":2}` || reason["offset"] != int64(7) {
+		t.Errorf("got reason %v", reason)
+	}
+}
+
+func TestMsgpackToJSON(t *testing.T) {
+	cases := map[string][]byte{
+		`-1`:                           {0xff},
+		`-128`:                         {0xd0, 0x80},
+		`65535`:                        {0xcd, 0xff, 0xff},
+		`"AQI="`:                       {0xc4, 0x02, 0x01, 0x02},
+		`{"1":false}`:                  {0x81, 0x01, 0xc2},
+		`{"data":"AA==","exttype":-1}`: {0xd4, 0xff, 0x00},
+	}
+	for k, v := range cases {
+		got, err := msgpackToJSON(v)
+		if err != nil || string(got) != k {
+			t.Errorf("msgpack % x got %s, %v, want %s", v, got, err, k)
+		}
+	}
+	for _, v := range [][]byte{{0xc1}, {0x92, 0x01}, {0xdb, 0xff, 0xff, 0xff, 0xff}, {0x01, 0x02}} {
+		if _, err := msgpackToJSON(v); err == nil {
+			t.Errorf("invalid msgpack % x should fail", v)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package compare
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DefaultProgressInterval = time.Second
+
+//单个源DB(或cluster节点)的进度快照
+type ProgressSnapshot struct {
+	Name          string
+	TotalKeys     int64
+	ScannedKeys   int64
+	ComparedKeys  int64
+	DiffKeys      int64
+	ErrorKeys     int64
+	KeysPerSecond float64
+	Percent       float64
+	ScanFinished  bool
+	Started       bool
+	ETA           time.Duration //剩余时间估算，-1表示无法估算
+}
+
+type progressEntry struct {
+	name     string
+	total    int64 //开始比较前获取的DBSIZE
+	coverage *Coverage
+	started  time.Time
+}
+
+//汇总一次比较中各源的计数，估算剩余时间并定期输出进度行
+type ProgressTracker struct {
+	Scenario string
+	Interval time.Duration
+
+	entries []*progressEntry
+	start   time.Time
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+var (
+	runningMu       sync.Mutex
+	runningTrackers []*ProgressTracker
+)
+
+func NewProgressTracker(scenario string) *ProgressTracker {
+	return &ProgressTracker{
+		Scenario: scenario,
+		Interval: DefaultProgressInterval,
+		start:    time.Now(),
+	}
+}
+
+//返回正在运行的比较进度，用于交互式命令行查询
+func RunningProgress() []*ProgressTracker {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	return append([]*ProgressTracker{}, runningTrackers...)
+}
+
+//预先登记源以及DBSIZE，未开始比较的源也计入剩余时间
+func (tracker *ProgressTracker) Add(name string, total int64) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	if tracker.entry(name) == nil {
+		tracker.entries = append(tracker.entries, &progressEntry{name: name, total: total})
+	}
+}
+
+//开始比较某个源时关联其计数
+func (tracker *ProgressTracker) Track(name string, coverage *Coverage) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	entry := tracker.entry(name)
+	if entry == nil {
+		entry = &progressEntry{name: name}
+		tracker.entries = append(tracker.entries, entry)
+	}
+	entry.coverage = coverage
+	entry.started = time.Now()
+}
+
+func (tracker *ProgressTracker) entry(name string) *progressEntry {
+	for _, v := range tracker.entries {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+//返回各源的进度
+func (tracker *ProgressTracker) Snapshot() []ProgressSnapshot {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	snapshots := make([]ProgressSnapshot, 0, len(tracker.entries))
+	for _, v := range tracker.entries {
+		snapshot := ProgressSnapshot{Name: v.name, TotalKeys: v.total, ETA: -1}
+		if v.coverage != nil {
+			snapshot.Started = true
+			if total := atomic.LoadInt64(&v.coverage.TotalKeys); total > 0 {
+				snapshot.TotalKeys = total
+			}
+			snapshot.ScannedKeys = atomic.LoadInt64(&v.coverage.ScannedKeys)
+			snapshot.ComparedKeys = atomic.LoadInt64(&v.coverage.ComparedKeys)
+			snapshot.DiffKeys = atomic.LoadInt64(&v.coverage.DiffKeys)
+			snapshot.ErrorKeys = atomic.LoadInt64(&v.coverage.ErrorKeys)
+			snapshot.ScanFinished = v.coverage.Finished()
+			if elapsed := time.Since(v.started).Seconds(); elapsed > 0 {
+				snapshot.KeysPerSecond = float64(snapshot.ComparedKeys) / elapsed
+			}
+		}
+		if snapshot.TotalKeys > 0 {
+			snapshot.Percent = float64(snapshot.ComparedKeys) * 100 / float64(snapshot.TotalKeys)
+			if snapshot.Percent > 100 {
+				snapshot.Percent = 100
+			}
+		}
+		if snapshot.ScanFinished {
+			snapshot.Percent = 100
+			snapshot.ETA = 0
+		} else if snapshot.KeysPerSecond > 0 {
+			snapshot.ETA = estimate(snapshot.TotalKeys-snapshot.ComparedKeys, snapshot.KeysPerSecond)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+//汇总所有源的进度，剩余时间按整体速度估算，包括尚未开始的源
+func (tracker *ProgressTracker) Total() ProgressSnapshot {
+	total := ProgressSnapshot{Name: tracker.Scenario, ScanFinished: true}
+	var remaining int64
+	for _, v := range tracker.Snapshot() {
+		total.TotalKeys += v.TotalKeys
+		total.ScannedKeys += v.ScannedKeys
+		total.ComparedKeys += v.ComparedKeys
+		total.DiffKeys += v.DiffKeys
+		total.ErrorKeys += v.ErrorKeys
+		total.ScanFinished = total.ScanFinished && v.ScanFinished
+		total.Started = total.Started || v.Started
+		if !v.ScanFinished && v.TotalKeys > v.ComparedKeys {
+			remaining += v.TotalKeys - v.ComparedKeys
+		}
+	}
+
+	if elapsed := time.Since(tracker.start).Seconds(); elapsed > 0 {
+		total.KeysPerSecond = float64(total.ComparedKeys) / elapsed
+	}
+	if total.TotalKeys > 0 {
+		total.Percent = float64(total.TotalKeys-remaining) * 100 / float64(total.TotalKeys)
+	}
+	total.ETA = -1
+	if total.ScanFinished {
+		total.ETA = 0
+	} else if total.KeysPerSecond > 0 {
+		total.ETA = estimate(remaining, total.KeysPerSecond)
+	}
+	return total
+}
+
+func estimate(remaining int64, speed float64) time.Duration {
+	if remaining <= 0 {
+		return 0
+	}
+	return (time.Duration(float64(remaining)/speed) * time.Second).Truncate(time.Second)
+}
+
+//单行进度文本
+func (tracker *ProgressTracker) Line() string {
+	total := tracker.Total()
+	eta := "unknown"
+	if total.ETA >= 0 {
+		eta = total.ETA.String()
+	}
+	return fmt.Sprintf("%s compared %d/%d (%.1f%%) scanned %d diffs %d errors %d %.0f keys/s ETA %s",
+		tracker.Scenario, total.ComparedKeys, total.TotalKeys, total.Percent, total.ScannedKeys,
+		total.DiffKeys, total.ErrorKeys, total.KeysPerSecond, eta)
+}
+
+//登记为运行中的比较，out不为nil时每隔Interval在终端同一行刷新进度
+func (tracker *ProgressTracker) Start(out io.Writer) {
+	runningMu.Lock()
+	runningTrackers = append(runningTrackers, tracker)
+	runningMu.Unlock()
+
+	if out == nil {
+		return
+	}
+	tracker.stop = make(chan struct{})
+	tracker.stopped = make(chan struct{})
+	go func() {
+		defer close(tracker.stopped)
+		ticker := time.NewTicker(tracker.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-tracker.stop:
+				fmt.Fprintf(out, "\r\033[K%s\n", tracker.Line())
+				return
+			case <-ticker.C:
+				fmt.Fprintf(out, "\r\033[K%s", tracker.Line())
+			}
+		}
+	}()
+}
+
+func (tracker *ProgressTracker) Stop() {
+	runningMu.Lock()
+	for k, v := range runningTrackers {
+		if v == tracker {
+			runningTrackers = append(runningTrackers[:k], runningTrackers[k+1:]...)
+			break
+		}
+	}
+	runningMu.Unlock()
+
+	if tracker.stop != nil {
+		close(tracker.stop)
+		<-tracker.stopped
+		tracker.stop = nil
+	}
+}
@@ -0,0 +1,62 @@
+package compare
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressTracker(t *testing.T) {
+	tracker := NewProgressTracker("multisingle2single")
+	tracker.Add("127.0.0.1:6379/0", 1000)
+	tracker.Add("127.0.0.1:6379/1", 1000)
+	tracker.start = time.Now().Add(-10 * time.Second)
+
+	coverage := &Coverage{TotalKeys: 1000}
+	tracker.Track("127.0.0.1:6379/0", coverage)
+	tracker.entries[0].started = tracker.start
+	coverage.Scanned(600)
+	coverage.Compared(500)
+	coverage.Diffs(3)
+	coverage.Errors(1)
+
+	snapshots := tracker.Snapshot()
+	if len(snapshots) != 2 {
+		t.Fatalf("got %d snapshots, want 2", len(snapshots))
+	}
+	first := snapshots[0]
+	if first.ComparedKeys != 500 || first.DiffKeys != 3 || first.ErrorKeys != 1 || first.Percent != 50 {
+		t.Errorf("got snapshot %+v", first)
+	}
+	if first.ETA < 9*time.Second || first.ETA > 11*time.Second {
+		t.Errorf("got ETA %s, want about 10s", first.ETA)
+	}
+	if snapshots[1].Started || snapshots[1].ETA != -1 {
+		t.Errorf("second source should be waiting, got %+v", snapshots[1])
+	}
+
+	//未开始的源计入剩余key数量
+	total := tracker.Total()
+	if total.TotalKeys != 2000 || total.ComparedKeys != 500 || total.Percent != 25 {
+		t.Errorf("got total %+v", total)
+	}
+	if total.ETA < 29*time.Second || total.ETA > 31*time.Second {
+		t.Errorf("got total ETA %s, want about 30s", total.ETA)
+	}
+
+	coverage.SetScanFinished(true)
+	if snapshot := tracker.Snapshot()[0]; snapshot.ETA != 0 || snapshot.Percent != 100 {
+		t.Errorf("finished source got %+v", snapshot)
+	}
+}
+
+func TestRunningProgress(t *testing.T) {
+	tracker := NewProgressTracker("single2single")
+	tracker.Start(nil)
+	if running := RunningProgress(); len(running) != 1 || running[0] != tracker {
+		t.Fatalf("got running %v", running)
+	}
+	tracker.Stop()
+	if len(RunningProgress()) != 0 {
+		t.Error("stopped tracker should not be running")
+	}
+}
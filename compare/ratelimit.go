@@ -0,0 +1,156 @@
+package compare
+
+import (
+	"context"
+	"github.com/go-redis/redis/v7"
+	"rediscompare/commons"
+	"reflect"
+	"sync"
+)
+
+//限制redis client的ops/sec以及带宽，以go-redis hook挂载到client上，对使用该client的所有worker生效
+type RateLimit struct {
+	OpsPerSecond   int64 //每秒命令数上限，0表示不限制
+	BytesPerSecond int64 //每秒请求与响应字节数上限，0表示不限制
+
+	ops     *commons.RateLimiter
+	bytes   *commons.RateLimiter
+	applied sync.Map
+}
+
+//single与cluster client均满足该接口
+type HookClient interface {
+	AddHook(hook redis.Hook)
+}
+
+//ops与bytes均不大于0时返回nil
+func NewRateLimit(ops int64, bytes int64) *RateLimit {
+	if ops <= 0 && bytes <= 0 {
+		return nil
+	}
+	return &RateLimit{
+		OpsPerSecond:   ops,
+		BytesPerSecond: bytes,
+		ops:            commons.NewRateLimiter(ops),
+		bytes:          commons.NewRateLimiter(bytes),
+	}
+}
+
+//将限速挂载到client，同一client只挂载一次，ctx取消时等待中的命令立即返回
+func (limit *RateLimit) Apply(ctx context.Context, client HookClient) {
+	if limit == nil || client == nil || reflect.ValueOf(client).IsNil() {
+		return
+	}
+	if _, loaded := limit.applied.LoadOrStore(client, true); loaded {
+		return
+	}
+	client.AddHook(&rateLimitHook{limit: limit, ctx: ctx})
+}
+
+//直接计入ops与字节数，用于不经过hook的client
+func (limit *RateLimit) Throttle(ctx context.Context, ops int64, bytes int64) error {
+	if limit == nil {
+		return nil
+	}
+	if err := limit.ops.Wait(ctx, ops); err != nil {
+		return err
+	}
+	return limit.bytes.Wait(ctx, bytes)
+}
+
+//挂载到client的限速hook，命令未携带可取消的context时使用Apply传入的context
+type rateLimitHook struct {
+	limit *RateLimit
+	ctx   context.Context
+}
+
+func (hook *rateLimitHook) context(ctx context.Context) context.Context {
+	if ctx == nil || ctx.Done() == nil {
+		return hook.ctx
+	}
+	return ctx
+}
+
+func (hook *rateLimitHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, hook.limit.Throttle(hook.context(ctx), 1, argsSize(cmd.Args()))
+}
+
+//响应大小在命令返回后才能得知，计入带宽后由后续命令等待，取消时不影响已返回的结果
+func (hook *rateLimitHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	hook.limit.bytes.Wait(hook.context(ctx), replySize(cmd))
+	return nil
+}
+
+func (hook *rateLimitHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	var size int64
+	for _, v := range cmds {
+		size += argsSize(v.Args())
+	}
+	return ctx, hook.limit.Throttle(hook.context(ctx), int64(len(cmds)), size)
+}
+
+func (hook *rateLimitHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var size int64
+	for _, v := range cmds {
+		size += replySize(v)
+	}
+	hook.limit.bytes.Wait(hook.context(ctx), size)
+	return nil
+}
+
+func argsSize(args []interface{}) int64 {
+	var size int64
+	for _, v := range args {
+		size += valueSize(reflect.ValueOf(v))
+	}
+	return size
+}
+
+//通过各类Cmd的Val方法估算响应字节数
+func replySize(cmd redis.Cmder) int64 {
+	method := reflect.ValueOf(cmd).MethodByName("Val")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return 0
+	}
+	return valueSize(method.Call(nil)[0])
+}
+
+func valueSize(v reflect.Value) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return int64(v.Len())
+		}
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += valueSize(v.Index(i))
+		}
+		return size
+	case reflect.Map:
+		var size int64
+		iter := v.MapRange()
+		for iter.Next() {
+			size += valueSize(iter.Key()) + valueSize(iter.Value())
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				size += valueSize(v.Field(i))
+			}
+		}
+		return size
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return valueSize(v.Elem())
+	case reflect.Invalid:
+		return 0
+	default:
+		return 8
+	}
+}
@@ -0,0 +1,78 @@
+package compare
+
+import (
+	"context"
+	"github.com/go-redis/redis/v7"
+	"testing"
+	"time"
+)
+
+type countHookClient struct {
+	hooks int
+}
+
+func (client *countHookClient) AddHook(hook redis.Hook) {
+	client.hooks++
+}
+
+func TestRateLimitApply(t *testing.T) {
+	if NewRateLimit(0, 0) != nil {
+		t.Fatal("rate limit without ops and bytes should be nil")
+	}
+
+	limit := NewRateLimit(100, 0)
+	client := &countHookClient{}
+	limit.Apply(context.Background(), client)
+	limit.Apply(context.Background(), client)
+	if client.hooks != 1 {
+		t.Errorf("got %d hooks, want 1", client.hooks)
+	}
+
+	var nolimit *RateLimit
+	nolimit.Apply(context.Background(), client)
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	server := newFakeRedis(t)
+	client := server.Client(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	limit := NewRateLimit(1, 0)
+	limit.Apply(ctx, client)
+	if err := client.Ping().Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	//令牌用完后下一条命令需等待约1秒，取消后立即返回ctx.Err()
+	time.AfterFunc(50*time.Millisecond, cancel)
+	begin := time.Now()
+	if err := client.Ping().Err(); err != context.Canceled {
+		t.Errorf("got %v, want context canceled", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Errorf("canceled command waited %s", elapsed)
+	}
+	if err := limit.Throttle(ctx, 10, 0); err != context.Canceled {
+		t.Errorf("got %v, want context canceled", err)
+	}
+}
+
+func TestReplySize(t *testing.T) {
+	cases := []struct {
+		cmd  redis.Cmder
+		size int64
+	}{
+		{redis.NewStringResult("hello", nil), 5},
+		{redis.NewStringSliceResult([]string{"ab", "cde"}, nil), 5},
+		{redis.NewCmdResult([]interface{}{"ab", int64(1)}, nil), 10},
+		{redis.NewStringStringMapResult(map[string]string{"f": "val"}, nil), 4},
+	}
+	for _, v := range cases {
+		if got := replySize(v.cmd); got != v.size {
+			t.Errorf("%s reply size %d, want %d", v.cmd.Name(), got, v.size)
+		}
+	}
+
+	if got := argsSize([]interface{}{"set", "key", []byte("value")}); got != 11 {
+		t.Errorf("args size %d, want 11", got)
+	}
+}
@@ -0,0 +1,170 @@
+package compare
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+//修复脚本格式
+const (
+	ScriptFormatCli  = "cli"  //redis-cli可执行的命令文件，每行一条命令
+	ScriptFormatResp = "resp" //RESP协议文件，用于redis-cli --pipe
+)
+
+//将修复命令写入脚本文件供审核后执行，不写目标库
+type RemediationScript struct {
+	File    string
+	Format  string
+	Cluster bool //目标为cluster时不生成SELECT
+
+	file     *os.File
+	writer   *bufio.Writer
+	db       int
+	commands int64
+	mu       sync.Mutex
+}
+
+func NewRemediationScript(file string, format string, cluster bool) (*RemediationScript, error) {
+	if format == "" {
+		format = ScriptFormatCli
+	}
+	if format != ScriptFormatCli && format != ScriptFormatResp {
+		return nil, errors.New("Script format must be " + ScriptFormatCli + " or " + ScriptFormatResp)
+	}
+	//redis-cli --pipe不处理MOVED重定向，cluster目标使用cli格式通过redis-cli -c执行
+	if format == ScriptFormatResp && cluster {
+		return nil, errors.New("Script format " + ScriptFormatResp + " is not supported for cluster target, use " + ScriptFormatCli + " with redis-cli -c")
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &RemediationScript{
+		File:    file,
+		Format:  format,
+		Cluster: cluster,
+		file:    f,
+		writer:  bufio.NewWriter(f),
+		db:      -1,
+	}, nil
+}
+
+//写入一个key在目标DB中执行的全部命令，DB变化时先写入SELECT
+func (script *RemediationScript) Write(db int, commands [][]interface{}) error {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+	if !script.Cluster && db != script.db {
+		if err := script.write("select", db); err != nil {
+			return err
+		}
+		script.db = db
+	}
+	for _, v := range commands {
+		if err := script.write(v...); err != nil {
+			return err
+		}
+		script.commands++
+	}
+	return nil
+}
+
+//脚本中的命令数量，不包括SELECT
+func (script *RemediationScript) Commands() int64 {
+	script.mu.Lock()
+	defer script.mu.Unlock()
+	return script.commands
+}
+
+func (script *RemediationScript) Close() error {
+	if script == nil {
+		return nil
+	}
+	if err := script.writer.Flush(); err != nil {
+		script.file.Close()
+		return err
+	}
+	return script.file.Close()
+}
+
+func (script *RemediationScript) write(args ...interface{}) error {
+	var line []byte
+	switch script.Format {
+	case ScriptFormatResp:
+		line = append(line, '*')
+		line = strconv.AppendInt(line, int64(len(args)), 10)
+		line = append(line, '\r', '\n')
+		for _, v := range args {
+			arg := scriptArg(v)
+			line = append(line, '$')
+			line = strconv.AppendInt(line, int64(len(arg)), 10)
+			line = append(line, '\r', '\n')
+			line = append(line, arg...)
+			line = append(line, '\r', '\n')
+		}
+	default:
+		for k, v := range args {
+			if k > 0 {
+				line = append(line, ' ')
+			}
+			line = append(line, QuoteCliArg(scriptArg(v))...)
+		}
+		line = append(line, '\n')
+	}
+	_, err := script.writer.Write(line)
+	return err
+}
+
+//按redis-cli的参数解析规则转义，含空白、引号或不可见字符时以双引号包裹，不可见字符以\xHH表示
+func QuoteCliArg(arg string) string {
+	if arg != "" && !needQuote(arg) {
+		return arg
+	}
+	quoted := []byte{'"'}
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\', '"':
+			quoted = append(quoted, '\\', c)
+		case '\n':
+			quoted = append(quoted, '\\', 'n')
+		case '\r':
+			quoted = append(quoted, '\\', 'r')
+		case '\t':
+			quoted = append(quoted, '\\', 't')
+		default:
+			if c < 0x20 || c >= 0x7f {
+				quoted = append(quoted, fmt.Sprintf("\\x%02x", c)...)
+			} else {
+				quoted = append(quoted, c)
+			}
+		}
+	}
+	return string(append(quoted, '"'))
+}
+
+func needQuote(arg string) bool {
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == '\'' || c == '\\' {
+			return true
+		}
+	}
+	return false
+}
+
+func scriptArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
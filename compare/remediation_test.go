@@ -0,0 +1,98 @@
+package compare
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuoteCliArg(t *testing.T) {
+	cases := map[string]string{
+		"user:1":       "user:1",
+		"":             `""`,
+		"hello world":  `"hello world"`,
+		`say "hi"`:     `"say \"hi\""`,
+		"it's":         `"it's"`,
+		"a\\b":         `"a\\b"`,
+		"line\r\n\t":   `"line\r\n\t"`,
+		"\x00\xff\x7f": `"\x00\xff\x7f"`,
+		"中":            `"\xe4\xb8\xad"`,
+	}
+	for k, v := range cases {
+		if got := QuoteCliArg(k); got != v {
+			t.Errorf("QuoteCliArg(%q) got %s, want %s", k, got, v)
+		}
+	}
+}
+
+func TestRemediationScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remediation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	commands := [][]interface{}{
+		{"del", "k 1"},
+		{"rpush", "k 1", "a\r\nb", "\x00"},
+		{"pexpire", "k 1", int64(1500)},
+	}
+
+	cli, err := NewRemediationScript(filepath.Join(dir, "repair.txt"), ScriptFormatCli, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Write(2, commands)
+	cli.Write(2, [][]interface{}{{"del", "x"}})
+	cli.Write(0, [][]interface{}{{"del", "y"}})
+	if err := cli.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadFile(cli.File)
+	want := "select 2\n" +
+		"del \"k 1\"\n" +
+		"rpush \"k 1\" \"a\\r\\nb\" \"\\x00\"\n" +
+		"pexpire \"k 1\" 1500\n" +
+		"del x\n" +
+		"select 0\n" +
+		"del y\n"
+	if string(got) != want {
+		t.Errorf("got cli script\n%s\nwant\n%s", got, want)
+	}
+	if cli.Commands() != 5 {
+		t.Errorf("got %d commands, want 5", cli.Commands())
+	}
+
+	resp, err := NewRemediationScript(filepath.Join(dir, "repair.resp"), ScriptFormatResp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Write(0, commands[1:2])
+	resp.Close()
+	got, _ = ioutil.ReadFile(resp.File)
+	want = "*2\r\n$6\r\nselect\r\n$1\r\n0\r\n*4\r\n$5\r\nrpush\r\n$3\r\nk 1\r\n$4\r\na\r\nb\r\n$1\r\n\x00\r\n"
+	if string(got) != want {
+		t.Errorf("got resp script %q, want %q", got, want)
+	}
+
+	//cluster不生成SELECT
+	clustercli, err := NewRemediationScript(filepath.Join(dir, "cluster.txt"), ScriptFormatCli, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clustercli.Write(0, commands[:1])
+	clustercli.Close()
+	if got, _ = ioutil.ReadFile(clustercli.File); string(got) != "del \"k 1\"\n" {
+		t.Errorf("got cluster script %q", got)
+	}
+
+	//redis-cli --pipe不按slot路由，cluster不支持resp格式
+	if _, err := NewRemediationScript(filepath.Join(dir, "cluster.resp"), ScriptFormatResp, true); err == nil {
+		t.Error("resp format should be rejected for cluster target")
+	}
+
+	if _, err := NewRemediationScript(filepath.Join(dir, "x"), "json", false); err == nil {
+		t.Error("unknown format should be rejected")
+	}
+}
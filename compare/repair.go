@@ -0,0 +1,513 @@
+package compare
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"rediscompare/commons"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/tidwall/gjson"
+)
+
+//修复动作
+const (
+	RepairRestore = "restore" //DUMP/RESTORE REPLACE复制key
+	RepairRewrite = "rewrite" //RESTORE失败时按类型重写key
+	RepairDelete  = "delete"  //删除目标库中多出的key
+	RepairSkip    = "skip"    //无需或不允许修复
+	RepairError   = "error"   //修复失败
+)
+
+//result文件中需要修复的key
+type RepairEntry struct {
+	Key       string
+	TargetKey string
+	SourceDB  int
+	TargetDB  int
+	KeyType   string
+	Extra     bool //反向比较发现的只存在于目标库的key
+}
+
+//每个key执行的修复动作，逐行记录到修复日志
+type RepairAction struct {
+	Time      string
+	Key       string
+	TargetKey string
+	SourceDB  int
+	TargetDB  int
+	KeyType   string
+	Action    string
+	TTL       int64 //毫秒，0表示不过期
+	DryRun    bool
+	Script    string `json:",omitempty"` //命令写入的脚本文件
+	Reason    string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+}
+
+//根据result或report文件将源key重新复制到目标库
+type Repair struct {
+	Source      func(db int) redis.UniversalClient //按DB返回源client，cluster忽略db
+	Target      func(db int) redis.UniversalClient //按DB返回目标client，cluster忽略db
+	DeleteExtra bool                               //是否删除源中不存在的目标key
+	DryRun      bool                               //只记录将执行的动作，不写目标库
+	BatchSize   int64                              //按类型重写时每批次元素数量
+	LogFile     string                             //逐key记录修复动作的日志文件
+	Script      *RemediationScript                 //非nil时将修复命令写入脚本，不写目标库
+	Summary     map[string]int                     //各动作的key数量
+	done        map[string]bool
+}
+
+//解析result文件中的一行，report文件的元数据行返回false
+func ParseRepairEntry(line string) (RepairEntry, bool) {
+	key := gjson.Get(line, "Key").String()
+	if key == "" {
+		return RepairEntry{}, false
+	}
+	entry := RepairEntry{
+		Key:       key,
+		TargetKey: gjson.Get(line, "TargetKey").String(),
+		SourceDB:  int(gjson.Get(line, "SourceDB").Int()),
+		TargetDB:  int(gjson.Get(line, "TargetDB").Int()),
+		KeyType:   gjson.Get(line, "KeyType").String(),
+	}
+	if entry.TargetKey == "" {
+		entry.TargetKey = key
+	}
+	for _, v := range gjson.Get(line, "KeyDiffReason").Array() {
+		if v.Get("description").String() == ReasonKeyOnlyInTarget {
+			entry.Extra = true
+		}
+	}
+	return entry, true
+}
+
+//依次修复result或report文件中的key，同一key只修复一次，被中断时返回错误
+func (repair *Repair) RepairFiles(ctx context.Context, filespath []string) error {
+	if repair.Summary == nil {
+		repair.Summary = make(map[string]int)
+	}
+	if repair.done == nil {
+		repair.done = make(map[string]bool)
+	}
+
+	for _, v := range filespath {
+		if !strings.HasSuffix(v, ".result") && !strings.HasSuffix(v, ".rep") {
+			return errors.New("File must has suffix '.result' or '.rep'")
+		}
+		fi, err := os.Open(v)
+		if err != nil {
+			return err
+		}
+		defer fi.Close()
+
+		scanner := bufio.NewScanner(fi)
+		//fulldiff模式下单行可能较长
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			entry, ok := ParseRepairEntry(scanner.Text())
+			if !ok {
+				continue
+			}
+			id := strconv.Itoa(entry.TargetDB) + ":" + entry.TargetKey
+			if repair.done[id] {
+				continue
+			}
+			repair.done[id] = true
+
+			action := repair.RepairKey(ctx, entry)
+			repair.Summary[action.Action]++
+			repair.log(action)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//以源当前状态为准修复单个key，源中已不存在时按DeleteExtra删除目标key
+func (repair *Repair) RepairKey(ctx context.Context, entry RepairEntry) *RepairAction {
+	action := &RepairAction{
+		Time:      time.Now().Format("2006-01-02 15:04:05.000"),
+		Key:       entry.Key,
+		TargetKey: entry.TargetKey,
+		SourceDB:  entry.SourceDB,
+		TargetDB:  entry.TargetDB,
+		KeyType:   entry.KeyType,
+		DryRun:    repair.DryRun,
+	}
+	target := repair.Target(entry.TargetDB)
+	//反向比较的key只存在于目标库，多源合并时SourceDB为-1，不查询源库
+	if entry.Extra {
+		return repair.deleteExtra(target, action)
+	}
+	source := repair.Source(entry.SourceDB)
+
+	keytype, err := source.Type(entry.Key).Result()
+	if err != nil {
+		return action.fail(err)
+	}
+	if keytype == "none" {
+		return repair.deleteExtra(target, action)
+	}
+	action.KeyType = keytype
+
+	pttl, err := source.PTTL(entry.Key).Result()
+	if err != nil {
+		return action.fail(err)
+	}
+	//-2为key已过期或被删除，-1为不过期
+	if pttl == -2 {
+		return repair.deleteExtra(target, action)
+	}
+	ttl := time.Duration(0)
+	expireat := time.Time{}
+	if pttl > 0 {
+		ttl = pttl
+		expireat = time.Now().Add(ttl)
+	}
+	action.TTL = int64(ttl / time.Millisecond)
+
+	//生成脚本时按类型输出可审核的命令，不使用RESTORE的二进制payload
+	if repair.Script != nil {
+		action.Action = RepairRewrite
+		action.Script = repair.Script.File
+		if repair.DryRun {
+			return action
+		}
+		//key的命令全部生成后再写入，失败时脚本中不留下部分命令
+		commands, err := repair.rewrite(ctx, source, entry.Key, entry.TargetKey, keytype, expireat)
+		if err != nil {
+			return action.skipOrFail(err)
+		}
+		if err := repair.Script.Write(entry.TargetDB, commands); err != nil {
+			return action.fail(err)
+		}
+		return action
+	}
+
+	dump, err := source.Dump(entry.Key).Result()
+	if err == redis.Nil {
+		return repair.deleteExtra(target, action)
+	}
+	if err != nil {
+		return action.fail(err)
+	}
+
+	action.Action = RepairRestore
+	if repair.DryRun {
+		return action
+	}
+	err = target.RestoreReplace(entry.TargetKey, ttl, dump).Err()
+	if err == nil {
+		return action
+	}
+
+	//不同版本间RDB格式不兼容时RESTORE失败，按类型读取源数据重写
+	//先写入临时key再RENAME覆盖目标key，中途写入失败时目标key保持不变
+	action.Action = RepairRewrite
+	action.Reason = err.Error()
+	tmpkey := repairTempKey(entry.TargetKey)
+	commands, err := repair.rewrite(ctx, source, entry.Key, tmpkey, keytype, expireat)
+	if err != nil {
+		return action.skipOrFail(err)
+	}
+	commands = append(commands, []interface{}{"rename", tmpkey, entry.TargetKey})
+	for _, v := range commands {
+		if err := target.Do(v...).Err(); err != nil {
+			target.Del(tmpkey)
+			return action.fail(err)
+		}
+	}
+	return action
+}
+
+//重写时使用的临时key，与目标key在同一slot，cluster中RENAME要求两个key在同一slot
+func repairTempKey(key string) string {
+	const suffix = ":rediscompare:repair"
+	//key中已有hash tag时追加后缀不改变slot
+	if start := strings.Index(key, "{"); start >= 0 {
+		if end := strings.Index(key[start+1:], "}"); end > 0 {
+			return key + suffix
+		}
+	}
+	//没有hash tag时整个key作为hash tag，key中含'}'时无法保持slot，cluster中RENAME失败，目标key不变
+	return "{" + key + "}" + suffix
+}
+
+func (repair *Repair) deleteExtra(target redis.UniversalClient, action *RepairAction) *RepairAction {
+	action.Reason = "Source key not exists"
+	exists, err := target.Exists(action.TargetKey).Result()
+	if err != nil {
+		return action.fail(err)
+	}
+	if exists == 0 {
+		action.Action = RepairSkip
+		action.Reason = "Source and target key not exist"
+		return action
+	}
+	if !repair.DeleteExtra {
+		action.Action = RepairSkip
+		return action
+	}
+
+	action.Action = RepairDelete
+	if repair.DryRun {
+		return action
+	}
+	if repair.Script != nil {
+		action.Script = repair.Script.File
+		if err := repair.Script.Write(action.TargetDB, [][]interface{}{{"del", action.TargetKey}}); err != nil {
+			return action.fail(err)
+		}
+		return action
+	}
+	if err := target.Del(action.TargetKey).Err(); err != nil {
+		return action.fail(err)
+	}
+	return action
+}
+
+//无法按类型重写的key，修复动作记录为skip
+type repairSkipError struct {
+	reason string
+}
+
+func (err *repairSkipError) Error() string {
+	return err.reason
+}
+
+//按批次读取源数据生成删除目标key以及重新写入的命令，源数据全部读取成功后才返回，由调用方执行或写入脚本
+func (repair *Repair) rewrite(ctx context.Context, source redis.UniversalClient, key string, targetkey string, keytype string, expireat time.Time) ([][]interface{}, error) {
+	batch := repair.BatchSize
+	if batch <= 0 {
+		batch = 100
+	}
+	commands := [][]interface{}{{"del", targetkey}}
+	write := func(args ...interface{}) {
+		commands = append(commands, args)
+	}
+
+	switch keytype {
+	case "string":
+		val, err := source.Get(key).Result()
+		if err != nil {
+			return nil, err
+		}
+		write("set", targetkey, val)
+	case "hash":
+		//HMSET兼容4.0以下版本
+		err := scanMembers(ctx, func(cursor uint64) ([]string, uint64, error) {
+			return source.HScan(key, cursor, "*", batch).Result()
+		}, func(members []string) error {
+			write(commandArgs("hmset", targetkey, members)...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case "set":
+		err := scanMembers(ctx, func(cursor uint64) ([]string, uint64, error) {
+			return source.SScan(key, cursor, "*", batch).Result()
+		}, func(members []string) error {
+			write(commandArgs("sadd", targetkey, members)...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case "zset":
+		//ZSCAN返回member、score，ZADD参数为score、member
+		err := scanMembers(ctx, func(cursor uint64) ([]string, uint64, error) {
+			return source.ZScan(key, cursor, "*", batch).Result()
+		}, func(members []string) error {
+			pairs := make([]string, 0, len(members))
+			for i := 0; i+1 < len(members); i += 2 {
+				pairs = append(pairs, members[i+1], members[i])
+			}
+			write(commandArgs("zadd", targetkey, pairs)...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case "list":
+		for start := int64(0); ; start += batch {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			vals, err := source.LRange(key, start, start+batch-1).Result()
+			if err != nil {
+				return nil, err
+			}
+			if len(vals) > 0 {
+				write(commandArgs("rpush", targetkey, vals)...)
+			}
+			if int64(len(vals)) < batch {
+				break
+			}
+		}
+	case "stream":
+		streamcommands, err := rewriteStream(ctx, source, key, targetkey, batch)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, streamcommands...)
+	default:
+		return nil, errors.New("Unsupported key type " + keytype)
+	}
+
+	//以读取PTTL时计算的绝对过期时间设置，读取源数据以及执行脚本的耗时不会延长过期时间
+	if !expireat.IsZero() {
+		write("pexpireat", targetkey, expireat.UnixNano()/int64(time.Millisecond))
+	}
+	return commands, nil
+}
+
+//XADD复制entry，XSETID恢复last-generated-id，XGROUP CREATE重建consumer group，有pending entry的group无法恢复PEL时跳过
+func rewriteStream(ctx context.Context, source redis.UniversalClient, key string, targetkey string, batch int64) ([][]interface{}, error) {
+	info := source.Do("xinfo", "stream", key)
+	lastid, err := StreamInfoField(info, "last-generated-id")
+	if err != nil {
+		return nil, err
+	}
+	groups, err := StreamGroupsInfo(source.Do("xinfo", "groups", key))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(groups))
+	for name, group := range groups {
+		if pending, _ := group["pending"].(int64); pending > 0 {
+			return nil, &repairSkipError{reason: "Stream group " + name + " has pending entries"}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var commands [][]interface{}
+	start := "-"
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		msgs, err := source.XRangeN(key, start, "+", batch).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range msgs {
+			fields := make([]string, 0, len(v.Values))
+			for field := range v.Values {
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			args := []interface{}{"xadd", targetkey, v.ID}
+			for _, field := range fields {
+				args = append(args, field, v.Values[field])
+			}
+			commands = append(commands, args)
+		}
+		if int64(len(msgs)) < batch {
+			break
+		}
+		start, err = NextStreamID(msgs[len(msgs)-1].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	//没有entry也没有group时无法创建空stream
+	if len(commands) == 0 && len(names) == 0 {
+		return nil, &repairSkipError{reason: "Empty stream without consumer group"}
+	}
+
+	for _, name := range names {
+		group := groups[name]
+		args := []interface{}{"xgroup", "create", targetkey, name, group["last-delivered-id"]}
+		//7.0以上版本记录entries-read，用于计算lag
+		if entriesread, ok := group["entries-read"].(int64); ok {
+			args = append(args, "entriesread", entriesread)
+		}
+		if len(commands) == 0 {
+			args = append(args, "mkstream")
+		}
+		commands = append(commands, args)
+	}
+
+	args := []interface{}{"xsetid", targetkey, lastid}
+	if entriesadded, err := StreamInfoField(info, "entries-added"); err == nil {
+		args = append(args, "entriesadded", entriesadded)
+	}
+	if maxdeleted, err := StreamInfoField(info, "max-deleted-entry-id"); err == nil {
+		args = append(args, "maxdeletedid", maxdeleted)
+	}
+	return append(commands, args), nil
+}
+
+func commandArgs(name string, key string, values []string) []interface{} {
+	args := make([]interface{}, 0, len(values)+2)
+	args = append(args, name, key)
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
+
+//cursor类命令逐批读取并写入，直到cursor为0
+func scanMembers(ctx context.Context, scan func(cursor uint64) ([]string, uint64, error), write func(members []string) error) error {
+	cursor := uint64(0)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		members, c, err := scan(cursor)
+		if err != nil {
+			return err
+		}
+		if len(members) > 0 {
+			if err := write(members); err != nil {
+				return err
+			}
+		}
+		cursor = c
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+//无法重写的key记录为skip，其余错误记录为error
+func (action *RepairAction) skipOrFail(err error) *RepairAction {
+	if skip, ok := err.(*repairSkipError); ok {
+		action.Action = RepairSkip
+		action.Reason = skip.reason
+		return action
+	}
+	return action.fail(err)
+}
+
+func (action *RepairAction) fail(err error) *RepairAction {
+	action.Action = RepairError
+	action.Error = err.Error()
+	return action
+}
+
+func (repair *Repair) log(action *RepairAction) {
+	if action.Action == RepairError {
+		zaplogger.Sugar().Error(action.TargetKey, " ", action.Error)
+	}
+	if repair.LogFile == "" {
+		return
+	}
+	jsonBytes, _ := json.Marshal(action)
+	commons.AppendLineToFile(bytes.NewBuffer(jsonBytes), repair.LogFile)
+}
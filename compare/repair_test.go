@@ -0,0 +1,207 @@
+package compare
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+func TestParseRepairEntry(t *testing.T) {
+	entry, ok := ParseRepairEntry(`{"IsEqual":false,"Source":"127.0.0.1:6379","Target":"127.0.0.1:6380","KeyDiffReason":[{"description":"Field value not equal"}],"KeyType":"hash","Key":"user:1","TargetKey":"tenant:user:1","SourceDB":2,"TargetDB":0}`)
+	if !ok {
+		t.Fatal("result line should be parsed")
+	}
+	want := RepairEntry{Key: "user:1", TargetKey: "tenant:user:1", SourceDB: 2, TargetDB: 0, KeyType: "hash"}
+	if entry != want {
+		t.Errorf("got %+v, want %+v", entry, want)
+	}
+
+	//未映射的key目标key与源key相同
+	entry, _ = ParseRepairEntry(`{"Key":"order:1","KeyDiffReason":[{"description":"Key only exists in Target"}]}`)
+	if entry.TargetKey != "order:1" || !entry.Extra {
+		t.Errorf("got %+v", entry)
+	}
+
+	//report文件的元数据行
+	if _, ok := ParseRepairEntry(`[{"Source":"127.0.0.1:6379","BatchSize":50}]`); ok {
+		t.Error("report metadata line should be skipped")
+	}
+}
+
+func TestRepairFilesSuffix(t *testing.T) {
+	repair := &Repair{DryRun: true}
+	if err := repair.RepairFiles(context.Background(), []string{"compare.log"}); err == nil {
+		t.Error("file without .result or .rep suffix should be rejected")
+	}
+}
+
+func TestRepairExtraEntry(t *testing.T) {
+	target := newFakeRedis(t)
+	target.Set(0, "db2:a", "1")
+
+	//多源合并时反向比较的SourceDB为-1，不应查询源库
+	file := tempResultFile(t)
+	line := `{"IsEqual":false,"KeyDiffReason":[{"description":"` + ReasonKeyOnlyInTarget + `"}],"KeyType":"string","Key":"a","TargetKey":"db2:a","SourceDB":-1,"TargetDB":0}`
+	if err := ioutil.WriteFile(file, []byte(line+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repair := &Repair{
+		Source: func(db int) redis.UniversalClient {
+			t.Fatalf("source db %d should not be queried", db)
+			return nil
+		},
+		Target: func(db int) redis.UniversalClient {
+			return target.Client(db)
+		},
+	}
+	if err := repair.RepairFiles(context.Background(), []string{file}); err != nil {
+		t.Fatal(err)
+	}
+	if repair.Summary[RepairSkip] != 1 || target.Get(0, "db2:a") == nil {
+		t.Errorf("extra key should be skipped without --deleteextra, got %v", repair.Summary)
+	}
+
+	repair.DeleteExtra = true
+	action := repair.RepairKey(context.Background(), RepairEntry{Key: "a", TargetKey: "db2:a", SourceDB: -1, Extra: true})
+	if action.Action != RepairDelete || target.Get(0, "db2:a") != nil {
+		t.Errorf("got %+v", action)
+	}
+}
+
+func TestRepairRewriteStream(t *testing.T) {
+	source := newFakeRedis(t)
+	repair := &Repair{BatchSize: 1}
+	ctx := context.Background()
+	stream := &fakeStream{
+		entries: []redis.XMessage{
+			{ID: "1-0", Values: map[string]interface{}{"a": "1"}},
+			{ID: "2-0", Values: map[string]interface{}{"b": "2"}},
+		},
+		lastID: "5-0",
+		groups: []map[string]interface{}{
+			{"name": "g2", "consumers": 0, "pending": 0, "last-delivered-id": "2-0"},
+			{"name": "g1", "consumers": 1, "pending": 0, "last-delivered-id": "1-0"},
+		},
+	}
+	source.Set(0, "s", stream)
+
+	commands, err := repair.rewrite(ctx, source.Client(0), "s", "t", "stream", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"[del t]",
+		"[xadd t 1-0 a 1]",
+		"[xadd t 2-0 b 2]",
+		"[xgroup create t g1 1-0]",
+		"[xgroup create t g2 2-0]",
+		"[xsetid t 5-0]",
+	}
+	if len(commands) != len(want) {
+		t.Fatalf("got %v", commands)
+	}
+	for k, v := range commands {
+		if fmt.Sprint(v) != want[k] {
+			t.Errorf("command %d got %v, want %s", k, v, want[k])
+		}
+	}
+
+	//空stream通过MKSTREAM创建
+	stream.entries = nil
+	commands, err = repair.rewrite(ctx, source.Client(0), "s", "t", "stream", time.Time{})
+	if err != nil || len(commands) != 4 || fmt.Sprint(commands[1]) != "[xgroup create t g1 1-0 mkstream]" {
+		t.Errorf("got %v, %v", commands, err)
+	}
+
+	//PEL无法恢复时跳过
+	stream.groups[0]["pending"] = 2
+	_, err = repair.rewrite(ctx, source.Client(0), "s", "t", "stream", time.Time{})
+	if err == nil {
+		t.Fatal("stream with pending entries should not be rewritten")
+	}
+	if action := (&RepairAction{}).skipOrFail(err); action.Action != RepairSkip || action.Reason != "Stream group g2 has pending entries" {
+		t.Errorf("got %+v", action)
+	}
+}
+
+func TestRepairRewriteReadError(t *testing.T) {
+	source := newFakeRedis(t)
+	source.Set(0, "h", fakeHash{"a": "1"})
+	source.Fail("hscan", "ERR busy")
+
+	//源数据读取失败时不生成任何命令，目标key不会被删除
+	commands, err := (&Repair{}).rewrite(context.Background(), source.Client(0), "h", "h", "hash", time.Time{})
+	if err == nil || commands != nil {
+		t.Errorf("got %v, %v", commands, err)
+	}
+}
+
+func TestRepairRewriteExpireAt(t *testing.T) {
+	source := newFakeRedis(t)
+	source.Set(0, "k", "v")
+
+	//TTL以绝对时间写入，脚本延迟执行时不会延长过期时间
+	expireat := time.Unix(1600000000, 500*int64(time.Millisecond))
+	commands, err := (&Repair{}).rewrite(context.Background(), source.Client(0), "k", "t", "string", expireat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 3 || fmt.Sprint(commands[2]) != "[pexpireat t 1600000000500]" {
+		t.Errorf("got %v", commands)
+	}
+}
+
+func TestRepairRewriteAtomic(t *testing.T) {
+	source := newFakeRedis(t)
+	target := newFakeRedis(t)
+	source.Set(0, "h", fakeHash{"a": "1", "b": "2"})
+	target.Set(0, "h", fakeHash{"a": "old"})
+	repair := &Repair{
+		BatchSize: 1,
+		Source: func(db int) redis.UniversalClient {
+			return source.Client(db)
+		},
+		Target: func(db int) redis.UniversalClient {
+			return target.Client(db)
+		},
+	}
+	ctx := context.Background()
+	tmpkey := repairTempKey("h")
+
+	//写入过期时间时失败，已写入的临时key被删除，目标key保持原值
+	source.SetTTL(0, "h", 60000)
+	target.Fail("pexpireat", "ERR write failed")
+	action := repair.RepairKey(ctx, RepairEntry{Key: "h", TargetKey: "h", KeyType: "hash"})
+	if action.Action != RepairError || countCalls(target, "0 hmset "+tmpkey) != 1 {
+		t.Errorf("got %+v, calls %v", action, target.Calls())
+	}
+	if h, _ := target.Get(0, "h").(fakeHash); len(h) != 1 || h["a"] != "old" || target.Get(0, tmpkey) != nil {
+		t.Errorf("target should be unchanged, got %v and temp key %v", target.Get(0, "h"), target.Get(0, tmpkey))
+	}
+
+	target.Fail("pexpireat", "")
+	action = repair.RepairKey(ctx, RepairEntry{Key: "h", TargetKey: "h", KeyType: "hash"})
+	h, _ := target.Get(0, "h").(fakeHash)
+	if action.Action != RepairRewrite || len(h) != 2 || h["b"] != "2" || target.Get(0, tmpkey) != nil {
+		t.Errorf("got %+v, target %v", action, h)
+	}
+	if ttl := target.Client(0).PTTL("h").Val(); ttl <= 0 {
+		t.Errorf("TTL should be renamed with the key, got %v", ttl)
+	}
+}
+
+func TestRepairTempKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"user:1":   "{user:1}:rediscompare:repair",
+		"{user}:1": "{user}:1:rediscompare:repair",
+		"a{b}c":    "a{b}c:rediscompare:repair",
+	} {
+		if got := repairTempKey(key); got != want {
+			t.Errorf("got %s for %s, want %s", got, key, want)
+		}
+	}
+}
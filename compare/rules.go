@@ -0,0 +1,242 @@
+package compare
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-redis/redis/v7"
+)
+
+//按key glob绑定的比较规则
+//ignore为忽略的hash field、set/zset member或stream field，支持glob
+//fields为field到表达式的映射，key支持glob；value为string、list元素及未在fields中匹配的field使用的表达式
+type EqualRule struct {
+	Pattern string            `json:"pattern"`
+	Ignore  []string          `json:"ignore"`
+	Fields  map[string]string `json:"fields"`
+	Value   string            `json:"value"`
+}
+
+type compiledRule struct {
+	pattern *regexp.Regexp
+	ignore  []*regexp.Regexp
+	exact   map[string]*Expr
+	globs   []*regexp.Regexp
+	exprs   []*Expr
+	value   *Expr
+}
+
+//规则文件，按顺序匹配，key使用第一条匹配的规则，nil时不生效
+type EqualRules struct {
+	File  string      `json:"file"`
+	Rules []EqualRule `json:"rules"`
+
+	compiled []*compiledRule
+}
+
+//读取yaml或json格式的规则文件，文件未设置时返回nil
+func LoadEqualRules(file string) (*EqualRules, error) {
+	if file == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	jsonbytes, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, err
+	}
+	var ruleFile struct {
+		Rules []EqualRule `json:"rules"`
+	}
+	if err := json.Unmarshal(jsonbytes, &ruleFile); err != nil {
+		return nil, err
+	}
+	rules, err := NewEqualRules(ruleFile.Rules)
+	if err != nil {
+		return nil, errors.New(file + ": " + err.Error())
+	}
+	if rules != nil {
+		rules.File = file
+	}
+	return rules, nil
+}
+
+//编译规则，规则为空时返回nil
+func NewEqualRules(rules []EqualRule) (*EqualRules, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	equalrules := &EqualRules{Rules: rules}
+	for _, v := range rules {
+		if v.Pattern == "" {
+			return nil, errors.New("equal rule without pattern")
+		}
+		pattern, err := regexp.Compile(GlobToRegexp(v.Pattern))
+		if err != nil {
+			return nil, err
+		}
+		rule := &compiledRule{pattern: pattern, exact: map[string]*Expr{}}
+		for _, ignore := range v.Ignore {
+			re, err := regexp.Compile(GlobToRegexp(ignore))
+			if err != nil {
+				return nil, err
+			}
+			rule.ignore = append(rule.ignore, re)
+		}
+
+		//精确field优先，glob field按字典序匹配
+		var fields []string
+		for field := range v.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			expr, err := CompileExpr(v.Fields[field])
+			if err != nil {
+				return nil, errors.New(v.Pattern + " field " + field + ": " + err.Error())
+			}
+			if !hasGlobMeta(field) {
+				rule.exact[field] = expr
+				continue
+			}
+			re, err := regexp.Compile(GlobToRegexp(field))
+			if err != nil {
+				return nil, err
+			}
+			rule.globs = append(rule.globs, re)
+			rule.exprs = append(rule.exprs, expr)
+		}
+		if v.Value != "" {
+			if rule.value, err = CompileExpr(v.Value); err != nil {
+				return nil, errors.New(v.Pattern + " value: " + err.Error())
+			}
+		}
+		equalrules.compiled = append(equalrules.compiled, rule)
+	}
+	return equalrules, nil
+}
+
+func hasGlobMeta(s string) bool {
+	for _, c := range s {
+		if c == '*' || c == '?' || c == '[' {
+			return true
+		}
+	}
+	return false
+}
+
+//返回key匹配的第一条规则
+func (rules *EqualRules) ruleOf(key string) *compiledRule {
+	if rules == nil {
+		return nil
+	}
+	for _, v := range rules.compiled {
+		if v.pattern.MatchString(key) {
+			return v
+		}
+	}
+	return nil
+}
+
+//判断key是否配置了忽略的field或member，此时长度与摘要比较不再适用
+func (rules *EqualRules) HasIgnore(key string) bool {
+	rule := rules.ruleOf(key)
+	return rule != nil && len(rule.ignore) > 0
+}
+
+//判断key是否配置了value表达式
+func (rules *EqualRules) HasValue(key string) bool {
+	rule := rules.ruleOf(key)
+	return rule != nil && rule.value != nil
+}
+
+//判断field或member是否被忽略
+func (rules *EqualRules) Ignored(key, field string) bool {
+	rule := rules.ruleOf(key)
+	if rule == nil {
+		return false
+	}
+	for _, v := range rule.ignore {
+		if v.MatchString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+//按规则判断源与目标value是否相等，未匹配规则或表达式求值失败时返回false
+func (rules *EqualRules) Equal(key, field, source, target string) bool {
+	rule := rules.ruleOf(key)
+	if rule == nil {
+		return false
+	}
+	expr, ok := rule.exact[field]
+	if !ok {
+		for k, v := range rule.globs {
+			if v.MatchString(field) {
+				expr = rule.exprs[k]
+				break
+			}
+		}
+	}
+	if expr == nil {
+		expr = rule.value
+	}
+	if expr == nil {
+		return false
+	}
+	equal, err := expr.Bool(&ExprEnv{Key: key, Field: field, Source: source, Target: target})
+	return err == nil && equal
+}
+
+//string value不一致时按value表达式比较，未配置value表达式时返回false
+func (rules *EqualRules) StringEqual(source, target redis.Cmdable, key, targetkey string) bool {
+	if !rules.HasValue(key) {
+		return false
+	}
+	sourceval, err := source.Get(key).Result()
+	if err != nil {
+		return false
+	}
+	targetval, err := target.Get(targetkey).Result()
+	if err != nil {
+		return false
+	}
+	return rules.Equal(key, "", sourceval, targetval)
+}
+
+//按规则比较stream entry的field，忽略的field不参与比较，其余field需一致或满足表达式
+func (rules *EqualRules) MapEqual(key string, source, target map[string]interface{}) bool {
+	if rules.ruleOf(key) == nil {
+		return false
+	}
+	for field, v := range source {
+		if rules.Ignored(key, field) {
+			continue
+		}
+		t, ok := target[field]
+		if !ok {
+			return false
+		}
+		s, sok := v.(string)
+		tv, tok := t.(string)
+		if !sok || !tok {
+			return false
+		}
+		if s != tv && !rules.Equal(key, field, s, tv) {
+			return false
+		}
+	}
+	for field := range target {
+		if _, ok := source[field]; !ok && !rules.Ignored(key, field) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package compare
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadEqualRules(t *testing.T) {
+	if rules, err := LoadEqualRules(""); rules != nil || err != nil || rules.HasIgnore("a") || rules.Equal("a", "", "1", "1") {
+		t.Error("unset rule file should not take effect")
+	}
+
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rules.yml")
+	content := `rules:
+  - pattern: "user:*"
+    ignore: ["updated_at", "tmp_*"]
+    fields:
+      score: "abs(s - t) <= 0.5"
+      "ts_*": "abs(s - t) < 60"
+      name: "lower(s) == lower(t)"
+    value: "match(t, '^[0-9]+$')"
+  - pattern: "*"
+    value: "trim(s) == trim(t)"
+`
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadEqualRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.File != file || len(rules.Rules) != 2 {
+		t.Errorf("got %+v", rules)
+	}
+
+	if !rules.HasIgnore("user:1") || rules.HasIgnore("order:1") || !rules.HasValue("order:1") {
+		t.Error("rule should be matched by key pattern in order")
+	}
+	if !rules.Ignored("user:1", "tmp_a") || rules.Ignored("user:1", "score") || rules.Ignored("order:1", "updated_at") {
+		t.Error("ignored fields should follow the matched rule")
+	}
+
+	cases := []struct {
+		key, field, source, target string
+		equal                      bool
+	}{
+		{"user:1", "score", "1.2", "1.5", true},
+		{"user:1", "score", "1.2", "2", false},
+		{"user:1", "ts_login", "1000", "1030", true},
+		{"user:1", "ts_login", "1000", "2000", false},
+		{"user:1", "name", "Bob", "bob", true},
+		//未配置表达式的field使用value表达式
+		{"user:1", "age", "x", "42", true},
+		{"user:1", "age", "42", "x", false},
+		{"order:1", "", " a ", "a", true},
+		{"order:1", "", "a", "b", false},
+	}
+	for _, v := range cases {
+		if got := rules.Equal(v.key, v.field, v.source, v.target); got != v.equal {
+			t.Errorf("%+v got %v", v, got)
+		}
+	}
+
+	//stream field比较
+	source := map[string]interface{}{"name": "Bob", "updated_at": "1", "score": "1"}
+	target := map[string]interface{}{"name": "bob", "tmp_x": "y", "score": "1.4"}
+	if !rules.MapEqual("user:1", source, target) {
+		t.Error("stream fields should be equal by rules")
+	}
+	target["score"] = "3"
+	if rules.MapEqual("user:1", source, target) {
+		t.Error("stream fields should not be equal")
+	}
+
+	//string value
+	sourceclient := &stringClient{values: map[string]string{"order:1": "a "}}
+	targetclient := &stringClient{values: map[string]string{"order:1": " a"}}
+	if !rules.StringEqual(sourceclient, targetclient, "order:1", "order:1") {
+		t.Error("string values should be equal by value expression")
+	}
+	targetclient.values["order:1"] = "b"
+	if rules.StringEqual(sourceclient, targetclient, "order:1", "order:1") {
+		t.Error("string values should not be equal")
+	}
+}
+
+func TestNewEqualRulesErrors(t *testing.T) {
+	invalid := [][]EqualRule{
+		{{Value: "s == t"}},
+		{{Pattern: "*", Value: "s =="}},
+		{{Pattern: "*", Fields: map[string]string{"a": "abs("}}},
+	}
+	for _, v := range invalid {
+		if _, err := NewEqualRules(v); err == nil {
+			t.Errorf("%+v should be rejected", v)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package compare
+
+import (
+	"encoding/binary"
+	"github.com/go-redis/redis/v7"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	SampleModeScan      = "scan"      //scan全库并按比例跳过key
+	SampleModeRandomKey = "randomkey" //通过RANDOMKEY抽取固定数量的key
+)
+
+const DefaultSampleConfidence = 0.95
+
+//抽样比较，只比较部分key并估算全库的不一致比例
+type Sampler struct {
+	Rate       float64 //抽样比例，取值(0,1)，Size大于0时忽略
+	Size       int64   //固定抽样数量，大于0时使用RANDOMKEY抽样
+	Seed       int64   //随机种子，非0时按key哈希抽样，相同种子抽样结果可复现
+	Confidence float64 //置信水平，默认0.95
+
+	compared   int64
+	mismatched int64
+	rechecking int32
+	short      int32 //RANDOMKEY尝试次数用完时抽取的key不足Size
+	mu         sync.Mutex
+	rand       *rand.Rand
+}
+
+//抽样结果统计，置信区间为Wilson score interval
+type SampleStats struct {
+	Mode            string
+	Rate            float64
+	Seed            int64
+	RequestedSize   int64 //RANDOMKEY模式要求的抽样数量
+	SampleSize      int64 //实际完成比较的key数量，用于计算置信区间
+	SampleShort     bool  //过滤后可抽取的key不足，SampleSize小于RequestedSize
+	Mismatched      int64
+	MismatchRate    float64
+	ConfidenceLevel float64
+	ConfidenceLow   float64
+	ConfidenceHigh  float64
+}
+
+//rate不在(0,1)范围且size不大于0时不抽样，返回nil
+func NewSampler(rate float64, size int64, seed int64, confidence float64) *Sampler {
+	if size <= 0 && (rate <= 0 || rate >= 1) {
+		return nil
+	}
+	if confidence <= 0 || confidence >= 1 {
+		confidence = DefaultSampleConfidence
+	}
+
+	sampler := &Sampler{
+		Rate:       rate,
+		Size:       size,
+		Seed:       seed,
+		Confidence: confidence,
+	}
+	if seed == 0 {
+		sampler.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return sampler
+}
+
+func (sampler *Sampler) Mode() string {
+	if sampler.UseRandomKey() {
+		return SampleModeRandomKey
+	}
+	return SampleModeScan
+}
+
+func (sampler *Sampler) UseRandomKey() bool {
+	return sampler != nil && sampler.Size > 0
+}
+
+//按比例从scan结果中抽取key
+func (sampler *Sampler) Pick(keys []string) []string {
+	if sampler == nil || sampler.UseRandomKey() {
+		return keys
+	}
+
+	picked := keys[:0:0]
+	for _, v := range keys {
+		if sampler.hit(v) {
+			picked = append(picked, v)
+		}
+	}
+	return picked
+}
+
+func (sampler *Sampler) hit(key string) bool {
+	if sampler.Seed == 0 {
+		sampler.mu.Lock()
+		defer sampler.mu.Unlock()
+		return sampler.rand.Float64() < sampler.Rate
+	}
+
+	//相同种子下key是否被抽中只取决于key本身，与scan顺序无关
+	h := fnv.New64a()
+	seed := make([]byte, 8)
+	binary.LittleEndian.PutUint64(seed, uint64(sampler.Seed))
+	h.Write(seed)
+	h.Write([]byte(key))
+	return float64(mix64(h.Sum64()))/math.MaxUint64 < sampler.Rate
+}
+
+//fnv高位分布不均，使用splitmix64的混淆步骤打散
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+//通过RANDOMKEY抽取Size个不重复的key并按batchsize分批，key数量不足时抽取全部key
+func (sampler *Sampler) RandomKeyBatches(client *redis.Client, filter *KeyFilter, batchsize int64) ([][]string, error) {
+	dbsize, err := client.DBSize().Result()
+	if err != nil {
+		return nil, err
+	}
+
+	size := sampler.Size
+	if size > dbsize {
+		size = dbsize
+	}
+
+	//RANDOMKEY可能重复命中同一key，限制尝试次数避免key被过滤时无法结束
+	picked := make(map[string]bool)
+	var batches [][]string
+	var batch []string
+	attempts := int64(0)
+	for ; int64(len(picked)) < size && attempts < size*10; attempts++ {
+		key, err := client.RandomKey().Result()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if picked[key] || !filter.MatchKey(key) {
+			continue
+		}
+		//按类型过滤时在抽样阶段判断，避免比较时被过滤导致样本不足
+		if filter.HasTypeRules() {
+			keytype, err := client.Type(key).Result()
+			if err != nil {
+				return nil, err
+			}
+			if !filter.MatchType(keytype) {
+				continue
+			}
+		}
+		picked[key] = true
+		batch = append(batch, key)
+		if int64(len(batch)) >= batchsize {
+			batches = append(batches, batch)
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	if int64(len(picked)) < sampler.Size {
+		atomic.StoreInt32(&sampler.short, 1)
+		zaplogger.Sugar().Warn("RANDOMKEY sampling picked ", len(picked), " of ", sampler.Size, " keys after ", attempts, " attempts, the confidence interval uses the picked keys only")
+	}
+	return batches, nil
+}
+
+//记录一个抽样key的比较结果，复查轮次只更新不一致数量
+func (sampler *Sampler) Record(equal bool) {
+	if sampler == nil {
+		return
+	}
+	if atomic.LoadInt32(&sampler.rechecking) == 0 {
+		atomic.AddInt64(&sampler.compared, 1)
+	}
+	if !equal {
+		atomic.AddInt64(&sampler.mismatched, 1)
+	}
+}
+
+//开始新一轮复查，不一致数量以最后一轮为准
+func (sampler *Sampler) NewRound() {
+	if sampler == nil {
+		return
+	}
+	atomic.StoreInt32(&sampler.rechecking, 1)
+	atomic.StoreInt64(&sampler.mismatched, 0)
+}
+
+func (sampler *Sampler) Stats() *SampleStats {
+	if sampler == nil {
+		return nil
+	}
+
+	compared := atomic.LoadInt64(&sampler.compared)
+	mismatched := atomic.LoadInt64(&sampler.mismatched)
+	stats := &SampleStats{
+		Mode:            sampler.Mode(),
+		Rate:            sampler.Rate,
+		Seed:            sampler.Seed,
+		RequestedSize:   sampler.Size,
+		SampleSize:      compared,
+		SampleShort:     atomic.LoadInt32(&sampler.short) == 1 || (sampler.Size > 0 && compared < sampler.Size),
+		Mismatched:      mismatched,
+		ConfidenceLevel: sampler.Confidence,
+	}
+	if compared > 0 {
+		stats.MismatchRate = float64(mismatched) / float64(compared)
+	}
+	stats.ConfidenceLow, stats.ConfidenceHigh = WilsonInterval(mismatched, compared, sampler.Confidence)
+	return stats
+}
+
+//计算比例的Wilson score置信区间，样本为空时返回[0,1]
+func WilsonInterval(hits int64, total int64, confidence float64) (float64, float64) {
+	if total <= 0 {
+		return 0, 1
+	}
+
+	z := math.Sqrt2 * math.Erfinv(confidence)
+	n := float64(total)
+	p := float64(hits) / n
+	denominator := 1 + z*z/n
+	center := (p + z*z/(2*n)) / denominator
+	margin := z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / denominator
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
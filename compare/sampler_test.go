@@ -0,0 +1,110 @@
+package compare
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestSamplerPickSeeded(t *testing.T) {
+	var keys []string
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, "key:"+strconv.Itoa(i))
+	}
+
+	first := NewSampler(0.1, 0, 42, 0).Pick(keys)
+	second := NewSampler(0.1, 0, 42, 0).Pick(keys)
+	if len(first) != len(second) {
+		t.Fatalf("same seed picked %d and %d keys", len(first), len(second))
+	}
+	for k := range first {
+		if first[k] != second[k] {
+			t.Fatalf("same seed picked different keys %s and %s", first[k], second[k])
+		}
+	}
+	if len(first) < 800 || len(first) > 1200 {
+		t.Errorf("picked %d keys, want about 1000", len(first))
+	}
+}
+
+func TestSamplerNil(t *testing.T) {
+	sampler := NewSampler(0, 0, 0, 0)
+	if sampler != nil {
+		t.Fatal("sampler without rate and size should be nil")
+	}
+	if len(sampler.Pick([]string{"a", "b"})) != 2 || sampler.Stats() != nil {
+		t.Error("nil sampler should keep all keys")
+	}
+	sampler.Record(false)
+}
+
+func TestSamplerStats(t *testing.T) {
+	sampler := NewSampler(0.5, 0, 1, 0)
+	for i := 0; i < 100; i++ {
+		sampler.Record(i%10 != 0)
+	}
+	//复查轮次只更新不一致数量
+	sampler.NewRound()
+	for i := 0; i < 5; i++ {
+		sampler.Record(false)
+	}
+
+	stats := sampler.Stats()
+	if stats.SampleSize != 100 || stats.Mismatched != 5 {
+		t.Errorf("got sample size %d mismatched %d, want 100 and 5", stats.SampleSize, stats.Mismatched)
+	}
+	if stats.ConfidenceLow > stats.MismatchRate || stats.ConfidenceHigh < stats.MismatchRate {
+		t.Errorf("mismatch rate %f not in [%f,%f]", stats.MismatchRate, stats.ConfidenceLow, stats.ConfidenceHigh)
+	}
+}
+
+func TestWilsonInterval(t *testing.T) {
+	low, high := WilsonInterval(10, 100, 0.95)
+	if math.Abs(low-0.0552) > 0.001 || math.Abs(high-0.1744) > 0.001 {
+		t.Errorf("got [%f,%f], want [0.0552,0.1744]", low, high)
+	}
+
+	low, high = WilsonInterval(0, 0, 0.95)
+	if low != 0 || high != 1 {
+		t.Errorf("empty sample got [%f,%f], want [0,1]", low, high)
+	}
+}
+
+func TestSamplerRandomKeyFiltered(t *testing.T) {
+	server := newFakeRedis(t)
+	for i := 0; i < 8; i++ {
+		server.Set(0, "b:"+strconv.Itoa(i), "v")
+	}
+	server.Set(0, "a:1", "v")
+	server.Set(0, "a:2", fakeHash{"f": "v"})
+	server.Set(0, "a:3", "v")
+
+	filter, err := NewKeyFilter([]string{"a:*"}, nil, nil, nil, []string{"string"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sampler := NewSampler(0, 5, 0, 0)
+	batches, err := sampler.RandomKeyBatches(server.Client(0), filter, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//类型过滤在抽样时生效，尝试次数用完时只抽到a:1、a:3
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("got batches %v", batches)
+	}
+	for _, v := range batches[0] {
+		sampler.Record(true)
+		if v == "a:2" {
+			t.Error("hash key should be filtered by type")
+		}
+	}
+
+	stats := sampler.Stats()
+	if stats.RequestedSize != 5 || stats.SampleSize != 2 || !stats.SampleShort {
+		t.Errorf("got stats %+v", stats)
+	}
+	low, high := WilsonInterval(0, 2, DefaultSampleConfidence)
+	if stats.ConfidenceLow != low || stats.ConfidenceHigh != high {
+		t.Errorf("interval should use achieved sample size, got %+v", stats)
+	}
+}
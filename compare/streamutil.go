@@ -0,0 +1,94 @@
+package compare
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v7"
+	"strconv"
+	"strings"
+)
+
+//获取stream XINFO STREAM 返回值中的指定字段
+func StreamInfoField(cmd *redis.Cmd, field string) (interface{}, error) {
+	info, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	fields, ok := info.([]interface{})
+	if !ok {
+		return nil, errors.New("unexpected xinfo stream reply")
+	}
+
+	for i := 0; i+1 < len(fields); i = i + 2 {
+		if name, ok := fields[i].(string); ok && name == field {
+			return fields[i+1], nil
+		}
+	}
+	return nil, errors.New("xinfo stream field " + field + " not found")
+}
+
+//返回紧随给定stream id之后的id，用于分批xrange
+func NextStreamID(id string) (string, error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return "", errors.New("invalid stream id " + id)
+	}
+
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return "", err
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", err
+	}
+
+	if seq == ^uint64(0) {
+		return fmt.Sprintf("%d-%d", ms+1, 0), nil
+	}
+	return fmt.Sprintf("%d-%d", ms, seq+1), nil
+}
+
+//比较两条stream entry的field/value是否一致
+func StreamValuesEqual(source map[string]interface{}, target map[string]interface{}) bool {
+	if len(source) != len(target) {
+		return false
+	}
+	for k, v := range source {
+		tv, ok := target[k]
+		if !ok || fmt.Sprint(tv) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+//解析XINFO GROUPS 返回值，以group name为key
+func StreamGroupsInfo(cmd *redis.Cmd) (map[string]map[string]interface{}, error) {
+	info, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, ok := info.([]interface{})
+	if !ok {
+		return nil, errors.New("unexpected xinfo groups reply")
+	}
+
+	m := make(map[string]map[string]interface{})
+	for _, v := range groups {
+		fields, ok := v.([]interface{})
+		if !ok {
+			return nil, errors.New("unexpected xinfo groups reply")
+		}
+		group := make(map[string]interface{})
+		for i := 0; i+1 < len(fields); i = i + 2 {
+			if name, ok := fields[i].(string); ok {
+				group[name] = fields[i+1]
+			}
+		}
+		m[fmt.Sprint(group["name"])] = group
+	}
+	return m, nil
+}
@@ -0,0 +1,58 @@
+package compare
+
+import (
+	"github.com/go-redis/redis/v7"
+	"testing"
+)
+
+func TestNextStreamID(t *testing.T) {
+	cases := map[string]string{
+		"1526919030474-55":                   "1526919030474-56",
+		"0-0":                                "0-1",
+		"1526919030474-18446744073709551615": "1526919030475-0",
+	}
+	for id, want := range cases {
+		next, err := NextStreamID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != want {
+			t.Errorf("NextStreamID(%s) = %s, want %s", id, next, want)
+		}
+	}
+
+	if _, err := NextStreamID("1526919030474"); err == nil {
+		t.Error("NextStreamID should fail on invalid id")
+	}
+}
+
+func TestStreamValuesEqual(t *testing.T) {
+	source := map[string]interface{}{"name": "a", "age": "1"}
+	if !StreamValuesEqual(source, map[string]interface{}{"age": "1", "name": "a"}) {
+		t.Error("same values should be equal")
+	}
+	if StreamValuesEqual(source, map[string]interface{}{"name": "a", "age": "2"}) {
+		t.Error("different values should not be equal")
+	}
+	if StreamValuesEqual(source, map[string]interface{}{"name": "a"}) {
+		t.Error("different length should not be equal")
+	}
+}
+
+func TestStreamGroupsInfo(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{"name", "mygroup", "consumers", int64(2), "pending", int64(3), "last-delivered-id", "1588152489012-0"},
+		[]interface{}{"name", "other", "consumers", int64(0), "pending", int64(0), "last-delivered-id", "0-0"},
+	}
+
+	groups, err := StreamGroupsInfo(redis.NewCmdResult(reply, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+	if groups["mygroup"]["last-delivered-id"] != "1588152489012-0" || groups["mygroup"]["pending"] != int64(3) {
+		t.Errorf("unexpected group info %v", groups["mygroup"])
+	}
+}
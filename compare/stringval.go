@@ -0,0 +1,190 @@
+package compare
+
+import (
+	"context"
+	"encoding/hex"
+	"unicode/utf8"
+
+	"github.com/go-redis/redis/v7"
+)
+
+//string分段比较时每次GETRANGE读取的字节数
+const DefaultStringChunkSize = 1 << 20
+
+//差异预览的字节数
+const StringPreviewSize = 64
+
+//在服务端计算string的sha1，避免传输完整value
+const stringSHA1Script = "return redis.sha1hex(redis.call('GET', KEYS[1]))"
+
+//string value比较规则
+type StringCompare struct {
+	ChunkSize   int64        //每次GETRANGE读取的字节数，默认1MB
+	Hash        bool         //长度一致且超过ChunkSize时先比较服务端sha1，一致时不再分段读取
+	Tolerance   *Tolerance   //开启数值比较时格式不同的数字视为一致
+	Normalizers *Normalizers //匹配规则的key读取完整value，规范化后比较
+}
+
+//先比较STRLEN，再分段GETRANGE比较，返回差异原因，一致时返回nil
+//被中断时返回nil，由调用方检查ctx
+func (rule StringCompare) Diff(ctx context.Context, source, target redis.Cmdable, key, targetkey string) map[string]interface{} {
+	chunksize := rule.ChunkSize
+	if chunksize <= 0 {
+		chunksize = DefaultStringChunkSize
+	}
+	if rule.Normalizers.Match(key) {
+		return rule.normalizedDiff(source, target, key, targetkey)
+	}
+	slen := source.StrLen(key).Val()
+	tlen := target.StrLen(targetkey).Val()
+
+	//sha1一致时视为相同，无法执行脚本时退回分段比较
+	if rule.Hash && slen == tlen && slen > chunksize {
+		ssha, serr := source.Eval(stringSHA1Script, []string{key}).Text()
+		tsha, terr := target.Eval(stringSHA1Script, []string{targetkey}).Text()
+		if serr == nil && terr == nil && ssha == tsha {
+			return nil
+		}
+	}
+
+	length := slen
+	if tlen < length {
+		length = tlen
+	}
+	offset := int64(-1)
+	for start := int64(0); start < length; start += chunksize {
+		if ctx.Err() != nil {
+			return nil
+		}
+		stop := start + chunksize
+		if stop > length {
+			stop = length
+		}
+		sourcechunk := source.GetRange(key, start, stop-1).Val()
+		targetchunk := target.GetRange(targetkey, start, stop-1).Val()
+		if i := FirstDiffOffset(sourcechunk, targetchunk); i >= 0 {
+			offset = start + int64(i)
+			break
+		}
+	}
+	//公共部分一致时差异从较短value的末尾开始
+	if offset < 0 {
+		if slen == tlen {
+			return nil
+		}
+		offset = length
+	}
+
+	//较短的value按数值比较
+	if rule.Tolerance != nil && rule.Tolerance.NumericString && slen <= maxNumericLength && tlen <= maxNumericLength {
+		if rule.Tolerance.ValueEqual(source.GetRange(key, 0, -1).Val(), target.GetRange(targetkey, 0, -1).Val()) {
+			return nil
+		}
+	}
+
+	start := previewStart(offset)
+	stop := start + StringPreviewSize - 1
+	sourcepreview := source.GetRange(key, start, stop).Val()
+	targetpreview := target.GetRange(targetkey, start, stop).Val()
+	return previewReason(offset, start, slen, tlen, sourcepreview, targetpreview)
+}
+
+//读取完整value规范化后比较
+func (rule StringCompare) normalizedDiff(source, target redis.Cmdable, key, targetkey string) map[string]interface{} {
+	sourceval := source.Get(key).Val()
+	targetval := target.Get(targetkey).Val()
+	if rule.Normalizers.Equal(key, sourceval, targetval, rule.Tolerance) {
+		return nil
+	}
+	sourceval, _ = rule.Normalizers.Normalize(key, sourceval)
+	targetval, _ = rule.Normalizers.Normalize(key, targetval)
+
+	offset := int64(FirstDiffOffset(sourceval, targetval))
+	if offset < 0 {
+		offset = 0
+	}
+	slen := int64(len(sourceval))
+	tlen := int64(len(targetval))
+	start := previewStart(offset)
+	reason := previewReason(offset, start, slen, tlen, substring(sourceval, start, StringPreviewSize), substring(targetval, start, StringPreviewSize))
+	reason["normalized"] = true
+	return reason
+}
+
+//预览从差异偏移之前的少量字节开始
+func previewStart(offset int64) int64 {
+	start := offset - StringPreviewSize/4
+	if start < 0 {
+		start = 0
+	}
+	return start
+}
+
+//返回从start开始最多length字节的子串
+func substring(s string, start, length int64) string {
+	if start >= int64(len(s)) {
+		return ""
+	}
+	if start+length > int64(len(s)) {
+		return s[start:]
+	}
+	return s[start : start+length]
+}
+
+//生成string差异原因，只记录差异偏移附近的预览
+func previewReason(offset, start, slen, tlen int64, sourcepreview, targetpreview string) map[string]interface{} {
+	stop := start + StringPreviewSize - 1
+	reason := make(map[string]interface{})
+	reason["description"] = "String value not equal"
+	reason["offset"] = offset
+	reason["slen"] = slen
+	reason["tlen"] = tlen
+	sourcepreview = trimPartialRunes(sourcepreview)
+	targetpreview = trimPartialRunes(targetpreview)
+	//bitmap等二进制value以十六进制预览
+	if !utf8.ValidString(sourcepreview) || !utf8.ValidString(targetpreview) {
+		sourcepreview = hex.EncodeToString([]byte(sourcepreview))
+		targetpreview = hex.EncodeToString([]byte(targetpreview))
+		reason["encoding"] = "hex"
+	}
+	reason["sval"] = sourcepreview
+	reason["tval"] = targetpreview
+	if start > 0 || stop < slen-1 || stop < tlen-1 {
+		reason["previewstart"] = start
+		reason["truncated"] = true
+	}
+	return reason
+}
+
+//返回两个字符串第一个不一致字节的下标，一致时返回-1
+func FirstDiffOffset(s, t string) int {
+	n := len(s)
+	if len(t) < n {
+		n = len(t)
+	}
+	for i := 0; i < n; i++ {
+		if s[i] != t[i] {
+			return i
+		}
+	}
+	if len(s) != len(t) {
+		return n
+	}
+	return -1
+}
+
+//去掉预览两端被截断的多字节字符
+func trimPartialRunes(s string) string {
+	for i := 0; i < utf8.UTFMax-1 && len(s) > 0 && !utf8.RuneStart(s[0]); i++ {
+		s = s[1:]
+	}
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				s = s[:i]
+			}
+			break
+		}
+	}
+	return s
+}
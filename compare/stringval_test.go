@@ -0,0 +1,97 @@
+package compare
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+)
+
+//只实现string比较所需命令的redis客户端
+type stringClient struct {
+	redis.Cmdable
+	values map[string]string
+	reads  int64
+}
+
+func (client *stringClient) StrLen(key string) *redis.IntCmd {
+	return redis.NewIntResult(int64(len(client.values[key])), nil)
+}
+
+func (client *stringClient) Get(key string) *redis.StringCmd {
+	client.reads += int64(len(client.values[key]))
+	return redis.NewStringResult(client.values[key], nil)
+}
+
+func (client *stringClient) GetRange(key string, start, end int64) *redis.StringCmd {
+	value := client.values[key]
+	if end < 0 {
+		end += int64(len(value))
+	}
+	if end >= int64(len(value)) {
+		end = int64(len(value)) - 1
+	}
+	if start > end {
+		return redis.NewStringResult("", nil)
+	}
+	client.reads += end - start + 1
+	return redis.NewStringResult(value[start:end+1], nil)
+}
+
+func TestStringCompareDiff(t *testing.T) {
+	value := strings.Repeat("abcdefgh", 1000)
+	source := &stringClient{values: map[string]string{"k": value}}
+	target := &stringClient{values: map[string]string{"k": value[:5000] + "X" + value[5001:]}}
+	rule := StringCompare{ChunkSize: 1024}
+
+	reason := rule.Diff(context.Background(), source, target, "k", "k")
+	if reason == nil || reason["offset"] != int64(5000) || reason["truncated"] != true {
+		t.Fatalf("got reason %v", reason)
+	}
+	if preview := reason["tval"].(string); len(preview) != StringPreviewSize || preview[StringPreviewSize/4] != 'X' {
+		t.Errorf("got preview %q", preview)
+	}
+	//读取到差异所在chunk后停止
+	if source.reads > 5*1024+StringPreviewSize {
+		t.Errorf("read %d bytes", source.reads)
+	}
+
+	//长度不一致时差异从较短value的末尾开始
+	target.values["k"] = value[:100]
+	if reason = rule.Diff(context.Background(), source, target, "k", "k"); reason["offset"] != int64(100) || reason["tlen"] != int64(100) {
+		t.Errorf("got reason %v", reason)
+	}
+
+	target.values["k"] = value
+	if reason = rule.Diff(context.Background(), source, target, "k", "k"); reason != nil {
+		t.Errorf("equal values got reason %v", reason)
+	}
+
+	//二进制value以十六进制预览
+	source.values["b"] = "\xff\x00"
+	target.values["b"] = "\xff\x01"
+	if reason = rule.Diff(context.Background(), source, target, "b", "b"); reason["encoding"] != "hex" || reason["sval"] != "ff00" {
+		t.Errorf("got reason %v", reason)
+	}
+}
+
+func TestFirstDiffOffset(t *testing.T) {
+	cases := []struct {
+		s, t string
+		want int
+	}{
+		{"abc", "abc", -1},
+		{"abc", "abd", 2},
+		{"abc", "ab", 2},
+		{"", "a", 0},
+	}
+	for _, v := range cases {
+		if got := FirstDiffOffset(v.s, v.t); got != v.want {
+			t.Errorf("FirstDiffOffset(%q, %q) got %d, want %d", v.s, v.t, got, v.want)
+		}
+	}
+	if got := trimPartialRunes("\xa0中文\xe4\xb8"); got != "中文" {
+		t.Errorf("got %q", got)
+	}
+}
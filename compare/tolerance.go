@@ -0,0 +1,61 @@
+package compare
+
+import (
+	"math"
+	"strconv"
+)
+
+//按数值比较的字符串最大长度，超过时不尝试解析
+const maxNumericLength = 64
+
+//数值比较容差，nil时要求完全一致
+type Tolerance struct {
+	AbsEpsilon    float64 //允许的绝对误差
+	RelEpsilon    float64 //允许的相对误差，相对于两者中绝对值较大的一个
+	NumericString bool    //string、hash field value以及list元素均为数字时按数值比较
+}
+
+//未设置任何容差时返回nil
+func NewTolerance(abs, rel float64, numeric bool) *Tolerance {
+	if abs <= 0 && rel <= 0 && !numeric {
+		return nil
+	}
+	return &Tolerance{AbsEpsilon: abs, RelEpsilon: rel, NumericString: numeric}
+}
+
+//判断两个zset score是否在容差范围内
+func (tolerance *Tolerance) ScoreEqual(source, target float64) bool {
+	if source == target {
+		return true
+	}
+	if tolerance == nil || math.IsNaN(source) || math.IsNaN(target) || math.IsInf(source, 0) || math.IsInf(target, 0) {
+		return false
+	}
+	diff := math.Abs(source - target)
+	if diff <= tolerance.AbsEpsilon {
+		return true
+	}
+	return diff <= tolerance.RelEpsilon*math.Max(math.Abs(source), math.Abs(target))
+}
+
+//判断两个字符串value是否一致，开启数值比较时"1.0"与"1"等格式不同的数字视为一致
+func (tolerance *Tolerance) ValueEqual(source, target string) bool {
+	if source == target {
+		return true
+	}
+	if tolerance == nil || !tolerance.NumericString {
+		return false
+	}
+	if len(source) > maxNumericLength || len(target) > maxNumericLength {
+		return false
+	}
+	sourcenum, err := strconv.ParseFloat(source, 64)
+	if err != nil || math.IsNaN(sourcenum) {
+		return false
+	}
+	targetnum, err := strconv.ParseFloat(target, 64)
+	if err != nil || math.IsNaN(targetnum) {
+		return false
+	}
+	return tolerance.ScoreEqual(sourcenum, targetnum)
+}
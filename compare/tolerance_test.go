@@ -0,0 +1,66 @@
+package compare
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestToleranceScoreEqual(t *testing.T) {
+	var exact *Tolerance
+	if !exact.ScoreEqual(1.5, 1.5) || exact.ScoreEqual(1.5, 1.5000001) {
+		t.Error("nil tolerance should require exact scores")
+	}
+
+	abs := NewTolerance(0.001, 0, false)
+	if !abs.ScoreEqual(10, 10.0005) || abs.ScoreEqual(10, 10.01) {
+		t.Error("absolute epsilon not applied")
+	}
+
+	//geohash score迁移后末位不同
+	rel := NewTolerance(0, 1e-12, false)
+	if !rel.ScoreEqual(3471579339700058, 3471579339700058+1) || rel.ScoreEqual(1, 1.001) {
+		t.Error("relative epsilon not applied")
+	}
+	if rel.ScoreEqual(math.Inf(1), 1e308) || !rel.ScoreEqual(math.Inf(-1), math.Inf(-1)) {
+		t.Error("infinite scores should only equal themselves")
+	}
+
+	if NewTolerance(0, 0, false) != nil {
+		t.Error("tolerance without settings should be nil")
+	}
+}
+
+func TestToleranceValueEqual(t *testing.T) {
+	numeric := NewTolerance(0, 0, true)
+	cases := []struct {
+		s, t string
+		want bool
+	}{
+		{"1.0", "1", true},
+		{"1e2", "100", true},
+		{"0.10", ".1", true},
+		{"1", "2", false},
+		{"abc", "abc", true},
+		{"abc", "ABC", false},
+		{"NaN", "nan", false},
+	}
+	for _, v := range cases {
+		if got := numeric.ValueEqual(v.s, v.t); got != v.want {
+			t.Errorf("ValueEqual(%q, %q) got %v, want %v", v.s, v.t, got, v.want)
+		}
+	}
+	if NewTolerance(0.1, 0, false).ValueEqual("1.0", "1") {
+		t.Error("numeric strings should be compared as text unless enabled")
+	}
+
+	//string value开启数值比较
+	source := &stringClient{values: map[string]string{"k": "3.140"}}
+	target := &stringClient{values: map[string]string{"k": "3.14"}}
+	if reason := (StringCompare{Tolerance: numeric}).Diff(context.Background(), source, target, "k", "k"); reason != nil {
+		t.Errorf("got reason %v", reason)
+	}
+	if reason := (StringCompare{}).Diff(context.Background(), source, target, "k", "k"); reason == nil {
+		t.Error("numeric strings should differ unless enabled")
+	}
+}
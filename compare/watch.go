@@ -0,0 +1,412 @@
+package compare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"rediscompare/commons"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/panjf2000/ants/v2"
+)
+
+//保留最近的延迟样本用于计算分位数
+const watchLagSamples = 10000
+
+//watch模式比较key所需的方法，CompareSingle2Single与CompareSingle2Cluster均满足
+type WatchCompare interface {
+	CompareKeys(ctx context.Context, keys []string) error
+	TargetKey(key string) string
+}
+
+//订阅源的keyspace通知，变化的key延迟Delay后与目标比较，持续输出差异以及延迟统计
+type Watch struct {
+	Source        *redis.Client         //源redis single
+	Target        redis.UniversalClient //目标redis，用于确认源中已删除的key
+	TargetDB      int                   //目标redis DB number
+	Compare       WatchCompare          //比较变化的key，差异通过OnDiff回调到Diff
+	Filter        *KeyFilter            //key过滤规则，nil时比较所有key
+	Delay         time.Duration         //收到通知后等待复制的时间
+	Threads       int                   //比较线程数量
+	BatchSize     int                   //每次比较的key数量
+	MaxQueue      int                   //待比较key数量上限，超过时丢弃通知
+	EnableNotify  bool                  //notify-keyspace-events未开启时是否通过CONFIG SET开启
+	ResultFile    string                //差异记录文件
+	Feed          io.Writer             //逐行输出差异以及统计，nil时只写日志
+	StatsInterval time.Duration         //统计输出间隔
+
+	events   int64
+	dropped  int64
+	compared int64
+	diffs    int64
+
+	mu       sync.Mutex
+	queue    []watchKey
+	pending  map[string]time.Time
+	inflight map[string]time.Time
+	lags     []time.Duration
+	lagIndex int
+	lagMax   time.Duration
+}
+
+type watchKey struct {
+	key      string
+	notified time.Time
+}
+
+//watch运行统计，延迟为收到通知到比较完成的时间，包括Delay
+type WatchStats struct {
+	Events   int64 //收到的通知数量
+	Dropped  int64 //队列已满丢弃的通知数量
+	Compared int64 //已比较的key数量
+	Diffs    int64 //差异key数量
+	Queue    int   //待比较key数量
+	LagP50Ms int64
+	LagP99Ms int64
+	LagMaxMs int64
+}
+
+//订阅keyspace通知并持续比较，ctx取消时等待正在比较的key完成后返回
+func (watch *Watch) Run(ctx context.Context) error {
+	if err := watch.checkNotify(); err != nil {
+		return err
+	}
+	watch.pending = make(map[string]time.Time)
+	watch.inflight = make(map[string]time.Time)
+	if watch.ResultFile == "" {
+		watch.ResultFile = "./" + "compare_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".result"
+	}
+	if watch.BatchSize <= 0 {
+		watch.BatchSize = 10
+	}
+	if watch.MaxQueue <= 0 {
+		watch.MaxQueue = 100000
+	}
+	if watch.StatsInterval <= 0 {
+		watch.StatsInterval = 10 * time.Second
+	}
+	threads := runtime.NumCPU()
+	if watch.Threads > 0 {
+		threads = watch.Threads
+	}
+
+	prefix := "__keyspace@" + strconv.Itoa(watch.Source.Options().DB) + "__:"
+	pubsub := watch.Source.PSubscribe(prefix + "*")
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(); err != nil {
+		return err
+	}
+	messages := pubsub.Channel()
+
+	pool, err := ants.NewPool(threads)
+	if err != nil {
+		return err
+	}
+	defer pool.Release()
+	wg := sync.WaitGroup{}
+
+	//独立goroutine提交比较，pool满时只阻塞该goroutine，事件循环继续接收通知，超出MaxQueue的通知计为丢弃
+	dispatchctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	dispatched := make(chan error, 1)
+	go func() {
+		dispatched <- watch.dispatch(dispatchctx, pool, &wg)
+	}()
+
+	zaplogger.Sugar().Info("Watch begin ", prefix+"*")
+	stats := time.NewTicker(watch.StatsInterval)
+	defer stats.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			<-dispatched
+			wg.Wait()
+			watch.printStats()
+			zaplogger.Sugar().Info("Watch End")
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				cancel()
+				<-dispatched
+				wg.Wait()
+				return errors.New("Keyspace notification subscription closed")
+			}
+			watch.Push(strings.TrimPrefix(msg.Channel, prefix), time.Now())
+		case err := <-dispatched:
+			wg.Wait()
+			return err
+		case <-stats.C:
+			watch.printStats()
+		}
+	}
+}
+
+//定期取出已到期的key提交到pool，pool满时Submit阻塞直到有空闲worker，ctx取消时返回nil
+func (watch *Watch) dispatch(ctx context.Context, pool *ants.Pool, wg *sync.WaitGroup) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			for _, v := range watch.Due(now) {
+				if ctx.Err() != nil {
+					return nil
+				}
+				keys := v
+				wg.Add(1)
+				if err := pool.Submit(func() {
+					defer wg.Done()
+					watch.compareKeys(ctx, keys)
+				}); err != nil {
+					wg.Done()
+					return err
+				}
+			}
+		}
+	}
+}
+
+//登记发生变化的key，已在队列中的key不重复登记，返回是否登记
+func (watch *Watch) Push(key string, notified time.Time) bool {
+	atomic.AddInt64(&watch.events, 1)
+	if !watch.Filter.MatchKey(key) {
+		return false
+	}
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	if watch.pending == nil {
+		watch.pending = make(map[string]time.Time)
+	}
+	if _, ok := watch.pending[key]; ok {
+		return false
+	}
+	if len(watch.queue) >= watch.MaxQueue {
+		atomic.AddInt64(&watch.dropped, 1)
+		return false
+	}
+	watch.pending[key] = notified
+	watch.queue = append(watch.queue, watchKey{key: key, notified: notified})
+	return true
+}
+
+//取出已等待Delay的key，按BatchSize分批
+func (watch *Watch) Due(now time.Time) [][]watchKey {
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	n := 0
+	for n < len(watch.queue) && now.Sub(watch.queue[n].notified) >= watch.Delay {
+		delete(watch.pending, watch.queue[n].key)
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	due := watch.queue[:n]
+	watch.queue = append([]watchKey{}, watch.queue[n:]...)
+
+	var batches [][]watchKey
+	for len(due) > 0 {
+		size := watch.BatchSize
+		if size <= 0 || size > len(due) {
+			size = len(due)
+		}
+		batches = append(batches, due[:size])
+		due = due[size:]
+	}
+	return batches
+}
+
+func (watch *Watch) compareKeys(ctx context.Context, keys []watchKey) {
+	watch.mu.Lock()
+	for _, v := range keys {
+		watch.inflight[v.key] = v.notified
+	}
+	watch.mu.Unlock()
+
+	//源中已删除的key只需确认目标中也不存在
+	pipe := watch.Source.Pipeline()
+	exists := make([]*redis.IntCmd, len(keys))
+	for k, v := range keys {
+		exists[k] = pipe.Exists(v.key)
+	}
+	pipe.Exec()
+
+	var changed []string
+	for k, v := range keys {
+		if exists[k].Err() == nil && exists[k].Val() == 0 {
+			watch.compareDeleted(v.key)
+			continue
+		}
+		changed = append(changed, v.key)
+	}
+	if len(changed) > 0 {
+		if err := watch.Compare.CompareKeys(ctx, changed); err != nil {
+			zaplogger.Sugar().Error(err)
+		}
+	}
+
+	now := time.Now()
+	watch.mu.Lock()
+	for _, v := range keys {
+		delete(watch.inflight, v.key)
+		watch.addLag(now.Sub(v.notified))
+	}
+	watch.mu.Unlock()
+	atomic.AddInt64(&watch.compared, int64(len(keys)))
+}
+
+func (watch *Watch) compareDeleted(key string) {
+	targetkey := watch.Compare.TargetKey(key)
+	n, err := watch.Target.Exists(targetkey).Result()
+	if err != nil {
+		zaplogger.Sugar().Error(err)
+		return
+	}
+	if n == 0 {
+		return
+	}
+	result := NewCompareResult()
+	result.IsEqual = false
+	result.Key = key
+	result.TargetKey = targetkey
+	result.Source = watch.Source.Options().Addr
+	result.Target = universalAddr(watch.Target)
+	result.SourceDB = watch.Source.Options().DB
+	result.TargetDB = watch.TargetDB
+	reason := make(map[string]interface{})
+	reason["description"] = "Source or Target key not exists"
+	reason["source"] = false
+	reason["target"] = true
+	result.KeyDiffReason = append(result.KeyDiffReason, reason)
+	watch.Diff(&result)
+}
+
+//记录差异并输出到差异流，作为比较的OnDiff回调
+func (watch *Watch) Diff(result *CompareResult) {
+	atomic.AddInt64(&watch.diffs, 1)
+	jsonBytes, _ := json.Marshal(result)
+	commons.AppendLineToFile(bytes.NewBuffer(jsonBytes), watch.ResultFile)
+
+	watch.mu.Lock()
+	notified, ok := watch.inflight[result.Key]
+	watch.mu.Unlock()
+	lag := ""
+	if ok {
+		lag = time.Since(notified).Round(time.Millisecond).String()
+	}
+	feed, _ := json.Marshal(map[string]interface{}{
+		"Time":          time.Now().Format("2006-01-02 15:04:05.000"),
+		"Lag":           lag,
+		"CompareResult": result,
+	})
+	watch.print(string(feed))
+}
+
+//统计快照
+func (watch *Watch) Stats() WatchStats {
+	watch.mu.Lock()
+	lags := append([]time.Duration{}, watch.lags...)
+	stats := WatchStats{
+		Queue:    len(watch.queue),
+		LagMaxMs: int64(watch.lagMax / time.Millisecond),
+	}
+	watch.mu.Unlock()
+
+	stats.Events = atomic.LoadInt64(&watch.events)
+	stats.Dropped = atomic.LoadInt64(&watch.dropped)
+	stats.Compared = atomic.LoadInt64(&watch.compared)
+	stats.Diffs = atomic.LoadInt64(&watch.diffs)
+	if len(lags) > 0 {
+		sort.Slice(lags, func(i, j int) bool { return lags[i] < lags[j] })
+		stats.LagP50Ms = int64(lags[(len(lags)-1)*50/100] / time.Millisecond)
+		stats.LagP99Ms = int64(lags[(len(lags)-1)*99/100] / time.Millisecond)
+	}
+	return stats
+}
+
+func (watch *Watch) addLag(lag time.Duration) {
+	if len(watch.lags) < watchLagSamples {
+		watch.lags = append(watch.lags, lag)
+	} else {
+		watch.lags[watch.lagIndex] = lag
+		watch.lagIndex = (watch.lagIndex + 1) % watchLagSamples
+	}
+	if lag > watch.lagMax {
+		watch.lagMax = lag
+	}
+}
+
+func (watch *Watch) printStats() {
+	stats := watch.Stats()
+	watch.print(fmt.Sprintf("watch events %d compared %d diffs %d queue %d dropped %d lag p50 %dms p99 %dms max %dms",
+		stats.Events, stats.Compared, stats.Diffs, stats.Queue, stats.Dropped, stats.LagP50Ms, stats.LagP99Ms, stats.LagMaxMs))
+}
+
+func (watch *Watch) print(line string) {
+	zaplogger.Sugar().Info(line)
+	if watch.Feed != nil {
+		watch.mu.Lock()
+		fmt.Fprintln(watch.Feed, line)
+		watch.mu.Unlock()
+	}
+}
+
+//确认源开启了keyspace通知，EnableNotify时自动开启，无法执行CONFIG时只记录警告
+func (watch *Watch) checkNotify() error {
+	vals, err := watch.Source.ConfigGet("notify-keyspace-events").Result()
+	if err != nil {
+		zaplogger.Sugar().Warn("Can not verify notify-keyspace-events: ", err)
+		return nil
+	}
+	flags := ""
+	if len(vals) == 2 {
+		flags, _ = vals[1].(string)
+	}
+	if NotifyKeyspaceEnabled(flags) {
+		return nil
+	}
+	if !watch.EnableNotify {
+		return errors.New("notify-keyspace-events of source is '" + flags + "', set it to 'KA' or use --watchnotify")
+	}
+	zaplogger.Sugar().Info("Set notify-keyspace-events of source to ", flags+"KA")
+	return watch.Source.ConfigSet("notify-keyspace-events", flags+"KA").Err()
+}
+
+//notify-keyspace-events需包含K以及A或全部数据类型的事件，t为stream事件，x为过期事件
+func NotifyKeyspaceEnabled(flags string) bool {
+	if !strings.Contains(flags, "K") {
+		return false
+	}
+	if strings.Contains(flags, "A") {
+		return true
+	}
+	for _, v := range "g$lshztxe" {
+		if !strings.ContainsRune(flags, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func universalAddr(client redis.UniversalClient) interface{} {
+	switch v := client.(type) {
+	case *redis.Client:
+		return v.Options().Addr
+	case *redis.ClusterClient:
+		return v.Options().Addrs
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package compare
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/panjf2000/ants/v2"
+)
+
+func TestWatchQueue(t *testing.T) {
+	filter, _ := NewKeyFilter(nil, []string{"tmp:*"}, nil, nil, nil, nil)
+	watch := &Watch{Delay: time.Second, BatchSize: 2, MaxQueue: 3, Filter: filter}
+	start := time.Now()
+
+	if !watch.Push("a", start) || watch.Push("a", start.Add(time.Millisecond)) {
+		t.Error("key already queued should not be queued again")
+	}
+	if watch.Push("tmp:1", start) {
+		t.Error("filtered key should not be queued")
+	}
+	watch.Push("b", start.Add(100*time.Millisecond))
+	watch.Push("c", start.Add(200*time.Millisecond))
+	if watch.Push("d", start.Add(300*time.Millisecond)) {
+		t.Error("key should be dropped when queue is full")
+	}
+
+	if due := watch.Due(start.Add(500 * time.Millisecond)); len(due) != 0 {
+		t.Errorf("got %d batches before delay", len(due))
+	}
+	due := watch.Due(start.Add(1150 * time.Millisecond))
+	if len(due) != 1 || len(due[0]) != 2 || due[0][0].key != "a" || due[0][1].key != "b" {
+		t.Fatalf("got due %v", due)
+	}
+	//比较开始后再次变化的key重新排队
+	if !watch.Push("a", start.Add(1200*time.Millisecond)) {
+		t.Error("key changed again should be queued")
+	}
+
+	stats := watch.Stats()
+	if stats.Events != 7 || stats.Dropped != 1 || stats.Queue != 2 {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+//比较时阻塞直到release或ctx取消
+type blockingWatchCompare struct {
+	started chan string
+	release chan struct{}
+}
+
+func (compare *blockingWatchCompare) CompareKeys(ctx context.Context, keys []string) error {
+	select {
+	case compare.started <- keys[0]:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-compare.release:
+	case <-ctx.Done():
+	}
+	return ctx.Err()
+}
+
+func (compare *blockingWatchCompare) TargetKey(key string) string {
+	return key
+}
+
+func TestWatchDispatch(t *testing.T) {
+	server := newFakeRedis(t)
+	for _, v := range []string{"a", "b", "c", "d"} {
+		server.Set(0, v, "1")
+	}
+	compare := &blockingWatchCompare{started: make(chan string), release: make(chan struct{})}
+	watch := &Watch{Source: server.Client(0), Compare: compare, BatchSize: 1, MaxQueue: 2, inflight: map[string]time.Time{}}
+	pool, err := ants.NewPool(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	dispatched := make(chan error, 1)
+	watch.Push("a", time.Now())
+	watch.Push("b", time.Now())
+	go func() {
+		dispatched <- watch.dispatch(ctx, pool, &wg)
+	}()
+	if key := <-compare.started; key != "a" {
+		t.Errorf("got %s", key)
+	}
+
+	//worker全部忙时新通知仍进入有界队列，超出MaxQueue时丢弃
+	watch.Push("c", time.Now())
+	watch.Push("d", time.Now())
+	if watch.Push("e", time.Now()) || watch.Stats().Dropped != 1 {
+		t.Errorf("got stats %+v", watch.Stats())
+	}
+
+	cancel()
+	select {
+	case err := <-dispatched:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("dispatch should return after ctx is canceled")
+	}
+	wg.Wait()
+}
+
+func TestWatchStatsAndDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	feed := &bytes.Buffer{}
+	watch := &Watch{ResultFile: filepath.Join(dir, "watch.result"), Feed: feed, inflight: map[string]time.Time{}}
+	for i := 1; i <= 100; i++ {
+		watch.addLag(time.Duration(i) * time.Millisecond)
+	}
+	watch.inflight["user:1"] = time.Now().Add(-2 * time.Second)
+
+	result := NewCompareResult()
+	result.IsEqual = false
+	result.Key = "user:1"
+	watch.Diff(&result)
+
+	stats := watch.Stats()
+	if stats.LagP50Ms != 50 || stats.LagP99Ms != 99 || stats.LagMaxMs != 100 || stats.Diffs != 1 {
+		t.Errorf("got stats %+v", stats)
+	}
+	if line := feed.String(); !strings.Contains(line, `"Key":"user:1"`) || !strings.Contains(line, `"Lag":"2`) {
+		t.Errorf("got feed %s", line)
+	}
+	if lines, _ := ioutil.ReadFile(watch.ResultFile); !strings.Contains(string(lines), `"Key":"user:1"`) {
+		t.Errorf("diff should be recorded in result file, got %s", lines)
+	}
+}
+
+func TestNotifyKeyspaceEnabled(t *testing.T) {
+	cases := map[string]bool{
+		"":           false,
+		"KEA":        true,
+		"Ex":         false,
+		"Kg$lshze":   false,
+		"Kg$lshztxe": true,
+		"Kxe$gzhslt": true,
+		"Kg$":        false,
+	}
+	for k, v := range cases {
+		if NotifyKeyspaceEnabled(k) != v {
+			t.Errorf("NotifyKeyspaceEnabled(%q) should be %v", k, v)
+		}
+	}
+}
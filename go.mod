@@ -8,16 +8,17 @@ require (
 	github.com/chzyer/test v0.0.0-20180213035817-a1ea475d72b1 // indirect
 	github.com/ghodss/yaml v1.0.0
 	github.com/go-redis/redis/v7 v7.4.0
+	github.com/golang/snappy v0.0.1
 	github.com/mattn/go-shellwords v1.0.10
 	github.com/olekukonko/tablewriter v0.0.4
 	github.com/panjf2000/ants/v2 v2.4.1
 	github.com/pkg/errors v0.8.1
+	github.com/prometheus/client_golang v1.7.1
 	github.com/satori/go.uuid v1.2.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.1
 	github.com/tidwall/gjson v1.6.0
 	go.uber.org/zap v1.10.0
-	golang.org/x/sys v0.0.0-20191120155948-bd437916bb0e // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 	gopkg.in/yaml.v2 v2.3.0
 )
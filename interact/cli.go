@@ -1,6 +1,7 @@
 package interact
 
 import (
+	"context"
 	"fmt"
 	"github.com/chzyer/readline"
 	"github.com/mattn/go-shellwords"
@@ -79,7 +80,7 @@ func cliRun(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 		cmd.Println(banner)
-		cmd.Println("Input 'help;' for usage. \nCommand must end with ';'. \n'tab' for command complete.\n^C or exit to quit.")
+		cmd.Println("Input 'help;' for usage. \nCommand must end with ';'. \nCommand end with '&;' runs in background, 'compare progress;' shows its progress. \n'tab' for command complete.\n^C or exit to quit.")
 		loop()
 		return
 	}
@@ -154,18 +155,23 @@ func hiddenFlag(cmd *cobra.Command) {
 
 // MainStart start main command
 func MainStart(args []string) {
-	startCmd(getMainCmd, args)
+	startCmd(context.Background(), getMainCmd, args)
 }
 
 // Start start interact command
 func Start(args []string) {
-	startCmd(getInteractCmd, args)
+	startCmd(context.Background(), getInteractCmd, args)
 }
 
-func startCmd(getCmd func([]string) *cobra.Command, args []string) {
+// StartBackground start interact command in background
+func StartBackground(args []string) {
+	startCmd(commons.WithBackground(context.Background()), getInteractCmd, args)
+}
+
+func startCmd(ctx context.Context, getCmd func([]string) *cobra.Command, args []string) {
 	rootCmd := getCmd(args)
 
-	if err := rootCmd.Execute(); err != nil {
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		rootCmd.Println(err)
 	}
 }
@@ -218,6 +224,11 @@ func loop() {
 		line, err := rl.Readline()
 		if err != nil {
 			if err == readline.ErrInterrupt {
+				//有后台比较时先中断后台比较
+				if commons.Interrupt() {
+					fmt.Println("Background compare interrupted, generating partial report")
+					continue
+				}
 				break
 			} else if err == io.EOF {
 				break
@@ -243,11 +254,21 @@ func loop() {
 		rl.SetPrompt("RedisCompare> ")
 		rl.SaveHistory(cmd)
 
+		//以'&'结尾的命令在后台执行，执行期间可通过'compare progress;'查看进度
+		background := strings.HasSuffix(strings.TrimSpace(strings.TrimSuffix(cmd, ";")), "&")
+		if background {
+			cmd = strings.TrimSuffix(strings.TrimSpace(strings.TrimSuffix(cmd, ";")), "&")
+		}
+
 		args, err := shellwords.Parse(cmd)
 		if err != nil {
 			fmt.Printf("parse command err: %v\n", err)
 			continue
 		}
+		if background {
+			go StartBackground(args)
+			continue
+		}
 		Start(args)
 	}
 }
@@ -5,7 +5,7 @@ Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
 You may obtain a copy of the License at
 
-    http://www.apache.org/licenses/LICENSE-2.0
+	http://www.apache.org/licenses/LICENSE-2.0
 
 Unless required by applicable law or agreed to in writing, software
 distributed under the License is distributed on an "AS IS" BASIS,
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/signal"
+	"rediscompare/commons"
 	"rediscompare/interact"
 	"strings"
 	"syscall"
@@ -43,13 +44,19 @@ func main() {
 		syscall.SIGQUIT)
 
 	go func() {
-		sig := <-sc
-		fmt.Printf("\nGot signal [%v] to exit.\n", sig)
-		switch sig {
-		case syscall.SIGTERM:
-			os.Exit(0)
-		default:
-			os.Exit(1)
+		for sig := range sc {
+			//先中断正在执行的比较，等待worker结束并生成部分报告，再次收到信号时直接退出
+			if commons.Interrupt() {
+				fmt.Printf("\nGot signal [%v], stopping compare and generating partial report, send again to exit immediately.\n", sig)
+				continue
+			}
+			fmt.Printf("\nGot signal [%v] to exit.\n", sig)
+			switch sig {
+			case syscall.SIGTERM:
+				os.Exit(0)
+			default:
+				os.Exit(1)
+			}
 		}
 	}()
 